@@ -9,20 +9,34 @@ import (
 	"time"
 
 	"doclet/services/collab"
+	"doclet/shared/broker"
+	"doclet/shared/tracing"
 )
 
 func main() {
 	cfg := collab.LoadConfig()
+	shutdownTracing, err := tracing.Init(context.Background(), "doclet-collab", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("tracing setup failed: %v", err)
+	}
 
 	hub := collab.NewHub()
-	broker, err := collab.NewNatsBroker(cfg.NATSURL)
+	bus, err := broker.NewNats(cfg.NATSURL)
 	if err != nil {
 		log.Fatalf("nats connection failed: %v", err)
 	}
-	defer broker.Close()
+	defer bus.Close()
+	if cfg.JetStream {
+		jsCtx, jsCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := bus.EnableJetStream(jsCtx, cfg.StreamMaxAge)
+		jsCancel()
+		if err != nil {
+			log.Fatalf("jetstream setup failed: %v", err)
+		}
+	}
 
-	server := collab.NewServer(hub, broker)
-	if err := server.SubscribeNATS(); err != nil {
+	server := collab.NewServer(hub, bus, collab.NewRemoteAuthorizer(cfg.DocumentURL), collab.NewRemoteLoader(cfg.DocumentURL), cfg)
+	if err := server.Subscribe(); err != nil {
 		log.Fatalf("nats subscribe failed: %v", err)
 	}
 
@@ -46,4 +60,8 @@ func main() {
 	shutdownCtx, shutdownCancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer shutdownCancel()
 	_ = httpServer.Shutdown(shutdownCtx)
+	// Flushing spans to an unreachable collector must not hold up exit.
+	tracingCtx, tracingCancel := context.WithTimeout(shutdownCtx, 5*time.Second)
+	defer tracingCancel()
+	_ = shutdownTracing(tracingCtx)
 }
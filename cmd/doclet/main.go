@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"doclet/services/collab"
+	"doclet/services/document"
+	"doclet/shared/access"
+	"doclet/shared/broker"
+	"doclet/shared/tracing"
+	"github.com/google/uuid"
+)
+
+// doclet runs the document and collab services in one process, connected by
+// an in-memory broker instead of NATS. It suits small single-node installs.
+func main() {
+	docCfg := document.LoadConfig()
+	collabCfg := collab.LoadConfig()
+	if docCfg.DatabaseURL == "" {
+		log.Fatal("DOCLET_DATABASE_URL is required")
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), "doclet", docCfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("tracing setup failed: %v", err)
+	}
+
+	db, err := document.OpenDatabase(docCfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("database connection failed: %v", err)
+	}
+	if err := document.RunMigrations(db); err != nil {
+		log.Fatalf("database migration failed: %v", err)
+	}
+	store := document.NewStore(db)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	bus := broker.NewMemory()
+	defer bus.Close()
+
+	if err := document.StartConsumers(ctx, store, bus); err != nil {
+		log.Fatalf("document subscribe failed: %v", err)
+	}
+	go document.RunCompactor(ctx, store, docCfg.CompactionInterval)
+	go document.RunVersioner(ctx, store, docCfg.VersionInterval, docCfg.VersionRetention)
+	go document.RunPurger(ctx, store, docCfg.PurgeInterval, docCfg.TrashRetention)
+
+	collabServer := collab.NewServer(collab.NewHub(), bus, storeAuthorizer(store), storeLoader(store), collabCfg)
+	if err := collabServer.Subscribe(); err != nil {
+		log.Fatalf("collab subscribe failed: %v", err)
+	}
+
+	servers := []*http.Server{
+		{
+			Addr:              docCfg.HTTPAddr,
+			Handler:           document.NewServer(store, document.NewPublisher(bus), docCfg).Router(),
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		{
+			Addr:              collabCfg.HTTPAddr,
+			Handler:           collabServer.Router(),
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Printf("doclet listening on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("doclet failed: %v", err)
+			}
+		}(srv)
+	}
+
+	<-ctx.Done()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	for _, srv := range servers {
+		_ = srv.Shutdown(shutdownCtx)
+	}
+	// Flushing spans to an unreachable collector must not hold up exit, and
+	// slow HTTP shutdowns must not leave it no time.
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer tracingCancel()
+	_ = shutdownTracing(tracingCtx)
+}
+
+// Share tokens are checked and document state is loaded against the store
+// directly instead of over HTTP.
+func storeAuthorizer(store *document.Store) collab.Authorizer {
+	return collab.AuthorizerFunc(func(ctx context.Context, documentID, token string) (collab.Grant, error) {
+		id, err := uuid.Parse(documentID)
+		if err != nil {
+			return collab.Grant{}, access.ErrDenied
+		}
+		role, err := store.ResolveShare(ctx, id, token)
+		if document.IsNotFound(err) {
+			return collab.Grant{}, collab.ErrDocumentNotFound
+		}
+		if err != nil {
+			return collab.Grant{}, err
+		}
+		return collab.Grant{Role: role, AuthorID: document.AuthorID(token)}, nil
+	})
+}
+
+func storeLoader(store *document.Store) collab.Loader {
+	return collab.LoaderFunc(func(ctx context.Context, documentID string, _ collab.Credentials) ([]byte, error) {
+		id, err := uuid.Parse(documentID)
+		if err != nil {
+			return nil, collab.ErrDocumentNotFound
+		}
+		doc, err := store.GetDocument(ctx, id)
+		if document.IsNotFound(err) {
+			return nil, collab.ErrDocumentNotFound
+		}
+		return doc.Content, err
+	})
+}
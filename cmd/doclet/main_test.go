@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"doclet/services/collab"
+	"doclet/services/document"
+	"doclet/shared/access"
+	"doclet/shared/broker"
+	"doclet/shared/yjs"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// startDoclet wires a SQLite store, the document consumers and a collab
+// server up as main does.
+func startDoclet(t *testing.T, cfg collab.Config) (*gorm.DB, *document.Store, *httptest.Server) {
+	t.Helper()
+	db, err := document.OpenDatabase("sqlite::memory:")
+	if err == nil {
+		err = document.RunMigrations(db)
+	}
+	if err != nil {
+		t.Skipf("sqlite unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	store := document.NewStore(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	bus := broker.NewMemory()
+	t.Cleanup(bus.Close)
+	if err := document.StartConsumers(ctx, store, bus); err != nil {
+		t.Fatal(err)
+	}
+	collabServer := collab.NewServer(collab.NewHub(), bus, storeAuthorizer(store), storeLoader(store), cfg)
+	if err := collabServer.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(collabServer.Router())
+	t.Cleanup(ts.Close)
+	return db, store, ts
+}
+
+// sendUpdate connects to ts with the values and sends an update inserting
+// a paragraph with text.
+func sendUpdate(t *testing.T, ts *httptest.Server, values url.Values, text string) {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?" + values.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	update := yjs.EncodeXmlFragment("default", 1, []*yjs.XmlNode{{
+		Name:     "paragraph",
+		Children: []*yjs.XmlNode{{Runs: []yjs.TextRun{{Text: text}}}},
+	}})
+	if err := conn.WriteJSON(collab.Message{
+		Type:       "yjs_update",
+		DocumentID: values.Get("document_id"),
+		ClientID:   values.Get("client_id"),
+		Payload:    base64.StdEncoding.EncodeToString(update),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// eventually polls check until it reports true, failing after a while.
+func eventually(t *testing.T, check func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestUpdateReachesStore sends an edit to the collab server and waits for
+// its snapshot to be written to the documents table.
+func TestUpdateReachesStore(t *testing.T) {
+	db, store, ts := startDoclet(t, collab.Config{
+		SnapshotDelay:   20 * time.Millisecond,
+		SnapshotMaxWait: time.Second,
+		SuggestionDelay: time.Hour,
+	})
+	doc, token, err := store.CreateDocument(context.Background(), "Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUpdate(t, ts, url.Values{
+		"document_id": {doc.DocumentID.String()},
+		"client_id":   {"alice"},
+		"token":       {token.Token},
+	}, "persisted")
+
+	var text string
+	eventually(t, func() bool {
+		if err := db.Table("documents").Select("text_content").
+			Where("document_id = ?", doc.DocumentID).Scan(&text).Error; err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(text, "persisted")
+	}, "the edit was not stored")
+}
+
+// TestSuggestionAuthorFromToken checks that suggestions are attributed to
+// the share token of the connection, not the client ID it claims.
+func TestSuggestionAuthorFromToken(t *testing.T) {
+	_, store, ts := startDoclet(t, collab.Config{
+		SnapshotDelay:   time.Hour,
+		SnapshotMaxWait: time.Hour,
+		SuggestionDelay: 20 * time.Millisecond,
+	})
+	ctx := context.Background()
+	doc, _, err := store.CreateDocument(ctx, "Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commenter, err := store.CreateShare(ctx, doc.DocumentID, access.RoleCommenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUpdate(t, ts, url.Values{
+		"document_id": {doc.DocumentID.String()},
+		"client_id":   {"victim"},
+		"token":       {commenter.Token},
+		"mode":        {"suggest"},
+	}, "suggested")
+
+	var suggestions []document.Suggestion
+	eventually(t, func() bool {
+		suggestions, err = store.ListSuggestions(ctx, doc.DocumentID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(suggestions) > 0
+	}, "the suggestion was not stored")
+	if want := document.AuthorID(commenter.Token); suggestions[0].AuthorID != want {
+		t.Fatalf("suggestion author = %q, want %q", suggestions[0].AuthorID, want)
+	}
+}
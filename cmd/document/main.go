@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"doclet/services/document"
+	"doclet/shared/broker"
+	"doclet/shared/tracing"
 )
 
 func main() {
@@ -16,6 +18,10 @@ func main() {
 	if cfg.DatabaseURL == "" {
 		log.Fatal("DOCLET_DATABASE_URL is required")
 	}
+	shutdownTracing, err := tracing.Init(context.Background(), "doclet-document", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("tracing setup failed: %v", err)
+	}
 
 	db, err := document.OpenDatabase(cfg.DatabaseURL)
 	if err != nil {
@@ -30,15 +36,27 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	nc, err := document.StartSnapshotConsumer(ctx, store, cfg.NATSURL)
+	bus, err := broker.NewNats(cfg.NATSURL)
 	if err != nil {
 		log.Fatalf("nats connection failed: %v", err)
 	}
-	defer nc.Close()
+	defer bus.Close()
+	if cfg.JetStream {
+		if err := bus.EnableJetStream(ctx, cfg.StreamMaxAge); err != nil {
+			log.Fatalf("jetstream setup failed: %v", err)
+		}
+	}
+	if err := document.StartConsumers(ctx, store, bus); err != nil {
+		log.Fatalf("nats subscribe failed: %v", err)
+	}
+
+	go document.RunCompactor(ctx, store, cfg.CompactionInterval)
+	go document.RunVersioner(ctx, store, cfg.VersionInterval, cfg.VersionRetention)
+	go document.RunPurger(ctx, store, cfg.PurgeInterval, cfg.TrashRetention)
 
 	srv := &http.Server{
 		Addr:              cfg.HTTPAddr,
-		Handler:           document.NewServer(store).Router(),
+		Handler:           document.NewServer(store, document.NewPublisher(bus), cfg).Router(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -53,4 +71,8 @@ func main() {
 	shutdownCtx, shutdownCancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer shutdownCancel()
 	_ = srv.Shutdown(shutdownCtx)
+	// Flushing spans to an unreachable collector must not hold up exit.
+	tracingCtx, tracingCancel := context.WithTimeout(shutdownCtx, 5*time.Second)
+	defer tracingCancel()
+	_ = shutdownTracing(tracingCtx)
 }
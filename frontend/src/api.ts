@@ -4,6 +4,22 @@ export type DocumentListItem = {
   document_id: string
   displayName: string
   updated_at: string
+  deleted_at?: string
+  folder_id?: string
+  tags?: string[]
+  snippet?: string
+}
+
+export type Workspace = {
+  workspace_id: string
+  name: string
+}
+
+export type Folder = {
+  folder_id: string
+  workspace_id: string
+  parent_id?: string
+  name: string
 }
 
 export type DocumentResponse = {
@@ -12,20 +28,78 @@ export type DocumentResponse = {
   content: string
   created_at: string
   updated_at: string
+  folder_id?: string
+  tags?: string[]
+  metadata?: Record<string, unknown>
+  share_token?: string
+}
+
+export type Role = 'viewer' | 'commenter' | 'editor' | 'owner'
+
+const tokenPrefix = 'doclet_token_'
+const tokenKey = (documentId: string) => `${tokenPrefix}${documentId}`
+
+export function getShareToken(documentId: string): string | null {
+  return localStorage.getItem(tokenKey(documentId))
+}
+
+export function setShareToken(documentId: string, token: string) {
+  localStorage.setItem(tokenKey(documentId), token)
+}
+
+function authHeaders(documentId: string): Record<string, string> {
+  const token = getShareToken(documentId)
+  return token ? { Authorization: `Bearer ${token}` } : {}
+}
+
+// listHeaders carries every token under prefix this browser holds, so
+// listings show what they open.
+function listHeaders(prefix = tokenPrefix): Record<string, string> {
+  const tokens: string[] = []
+  for (let i = 0; i < localStorage.length; i++) {
+    const key = localStorage.key(i)
+    const token = key?.startsWith(prefix) ? localStorage.getItem(key) : null
+    if (token) {
+      tokens.push(token)
+    }
+  }
+  return tokens.length > 0 ? { Authorization: `Bearer ${tokens.join(',')}` } : {}
+}
+
+const workspaceTokenPrefix = 'doclet_workspace_token_'
+
+export function setWorkspaceToken(workspaceId: string, token: string) {
+  localStorage.setItem(`${workspaceTokenPrefix}${workspaceId}`, token)
+}
+
+function workspaceHeaders(workspaceId: string): Record<string, string> {
+  const token = localStorage.getItem(`${workspaceTokenPrefix}${workspaceId}`)
+  return token ? { Authorization: `Bearer ${token}` } : {}
+}
+
+export type DocumentPage = {
+  items: DocumentListItem[]
+  nextCursor?: string
 }
 
-export async function listDocuments(query: string): Promise<DocumentListItem[]> {
+export async function listDocuments(query: string, cursor?: string, folderId?: string): Promise<DocumentPage> {
   const config = await loadConfig()
   const url = new URL(`${config.docServiceUrl}/documents`)
   if (query) {
     url.searchParams.set('query', query)
   }
-  const res = await fetch(url.toString())
+  if (cursor) {
+    url.searchParams.set('cursor', cursor)
+  }
+  if (folderId) {
+    url.searchParams.set('folder_id', folderId)
+  }
+  const res = await fetch(url.toString(), { headers: listHeaders() })
   if (!res.ok) {
     throw new Error('Failed to load documents')
   }
   const data = await res.json()
-  return data.items || []
+  return { items: data.items || [], nextCursor: data.next_cursor }
 }
 
 export async function createDocument(displayName: string): Promise<DocumentResponse> {
@@ -38,23 +112,87 @@ export async function createDocument(displayName: string): Promise<DocumentRespo
   if (!res.ok) {
     throw new Error('Failed to create document')
   }
-  return res.json()
+  const doc: DocumentResponse = await res.json()
+  if (doc.share_token) {
+    setShareToken(doc.document_id, doc.share_token)
+  }
+  return doc
 }
 
 export async function getDocument(documentId: string): Promise<DocumentResponse> {
   const config = await loadConfig()
-  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}`)
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}`, {
+    headers: authHeaders(documentId),
+  })
+  if (res.status === 401 || res.status === 403) {
+    throw new Error('You need a share link to open this document')
+  }
   if (!res.ok) {
     throw new Error('Document not found')
   }
   return res.json()
 }
 
+// Access is what this browser's token grants. authorId is who the server
+// attributes the token's comments and suggestions to.
+export type Access = {
+  role: Role
+  authorId: string
+}
+
+export async function getAccess(documentId: string): Promise<Access> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/access`, {
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error('You need a share link to open this document')
+  }
+  const data = await res.json()
+  return { role: data.role, authorId: data.author_id }
+}
+
+// createCollabTicket asks for a signed collab session ticket, returning null
+// when the document service does not issue them.
+export async function createCollabTicket(documentId: string, clientId: string): Promise<string | null> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/tickets`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({ client_id: clientId }),
+  })
+  if (res.status === 404) {
+    const data = await res.json().catch(() => null)
+    if (data?.error === 'tickets_disabled') {
+      return null
+    }
+  }
+  if (!res.ok) {
+    throw new Error('Failed to join document')
+  }
+  const data = await res.json()
+  return data.ticket
+}
+
+export async function createShareToken(documentId: string, role: Role): Promise<string> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/shares`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({ role }),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to create share link')
+  }
+  const data = await res.json()
+  return data.token
+}
+
 export async function updateDocumentTitle(documentId: string, displayName: string): Promise<void> {
   const config = await loadConfig()
   const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/title`, {
     method: 'PUT',
-    headers: { 'Content-Type': 'application/json' },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
     body: JSON.stringify({ displayName }),
   })
   if (!res.ok) {
@@ -66,12 +204,243 @@ export async function deleteDocument(documentId: string): Promise<void> {
   const config = await loadConfig()
   const res = await fetch(`${config.docServiceUrl}/documents/${documentId}`, {
     method: 'DELETE',
+    headers: authHeaders(documentId),
   })
   if (!res.ok) {
     throw new Error('Failed to delete document')
   }
 }
 
+export async function listTrash(): Promise<DocumentListItem[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/trash`, { headers: listHeaders() })
+  if (!res.ok) {
+    throw new Error('Failed to load trash')
+  }
+  const data = await res.json()
+  return data.items || []
+}
+
+export async function restoreDocument(documentId: string): Promise<void> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/restore`, {
+    method: 'POST',
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to restore document')
+  }
+}
+
+export async function listWorkspaces(): Promise<Workspace[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/workspaces`, {
+    headers: listHeaders(workspaceTokenPrefix),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to load workspaces')
+  }
+  const data = await res.json()
+  return data.items || []
+}
+
+export async function listFolders(workspaceId: string): Promise<Folder[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/workspaces/${workspaceId}/folders`, {
+    headers: workspaceHeaders(workspaceId),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to load folders')
+  }
+  const data = await res.json()
+  return data.items || []
+}
+
+export async function moveDocument(documentId: string, folderId: string | null): Promise<void> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/folder`, {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({ folder_id: folderId }),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to move document')
+  }
+}
+
+export async function addTags(documentId: string, tags: string[]): Promise<string[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/tags`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({ tags }),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to add tags')
+  }
+  const data = await res.json()
+  return data.tags || []
+}
+
+export async function removeTag(documentId: string, tag: string): Promise<string[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/tags/${encodeURIComponent(tag)}`, {
+    method: 'DELETE',
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to remove tag')
+  }
+  const data = await res.json()
+  return data.tags || []
+}
+
+export type ThreadAnchor = {
+  start: string
+  end: string
+}
+
+export type ThreadComment = {
+  comment_id: string
+  author_id: string
+  author_name?: string
+  body: string
+  created_at: string
+  updated_at: string
+}
+
+export type CommentThread = {
+  thread_id: string
+  document_id: string
+  anchor: ThreadAnchor
+  quote?: string
+  resolved: boolean
+  resolved_at?: string
+  resolved_by?: string
+  comments: ThreadComment[]
+  created_at: string
+  updated_at: string
+}
+
+export async function listThreads(documentId: string): Promise<CommentThread[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/threads`, {
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to load comments')
+  }
+  const data = await res.json()
+  return data.items || []
+}
+
+export async function createThread(
+  documentId: string,
+  anchor: ThreadAnchor,
+  quote: string,
+  comment: { authorName: string; body: string },
+): Promise<CommentThread> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/threads`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({
+      anchor,
+      quote,
+      author_name: comment.authorName,
+      body: comment.body,
+    }),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to add comment')
+  }
+  return res.json()
+}
+
+export async function replyToThread(
+  documentId: string,
+  threadId: string,
+  comment: { authorName: string; body: string },
+): Promise<CommentThread> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/threads/${threadId}/comments`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(documentId) },
+    body: JSON.stringify({
+      author_name: comment.authorName,
+      body: comment.body,
+    }),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to reply')
+  }
+  return res.json()
+}
+
+export async function setThreadResolved(
+  documentId: string,
+  threadId: string,
+  resolved: boolean,
+): Promise<CommentThread> {
+  const config = await loadConfig()
+  const action = resolved ? 'resolve' : 'reopen'
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/threads/${threadId}/${action}`, {
+    method: 'POST',
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error(`Failed to ${action} comment`)
+  }
+  return res.json()
+}
+
+export type Suggestion = {
+  suggestion_id: string
+  document_id: string
+  author_id: string
+  anchor?: ThreadAnchor
+  status: 'pending' | 'accepted' | 'rejected'
+  resolved_at?: string
+  resolved_by?: string
+  created_at: string
+  updated_at: string
+}
+
+export async function listSuggestions(documentId: string): Promise<Suggestion[]> {
+  const config = await loadConfig()
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/suggestions?status=pending`, {
+    headers: authHeaders(documentId),
+  })
+  if (!res.ok) {
+    throw new Error('Failed to load suggestions')
+  }
+  const data = await res.json()
+  return data.items || []
+}
+
+export async function resolveSuggestion(
+  documentId: string,
+  suggestionId: string,
+  accept: boolean,
+): Promise<Suggestion> {
+  const config = await loadConfig()
+  const action = accept ? 'accept' : 'reject'
+  const res = await fetch(`${config.docServiceUrl}/documents/${documentId}/suggestions/${suggestionId}/${action}`, {
+    method: 'POST',
+    headers: authHeaders(documentId),
+  })
+  if (res.status === 409) {
+    const data = await res.json().catch(() => ({}))
+    if (data.error === 'suggestion_conflict') {
+      throw new Error('This suggestion builds on another suggestion that has not been accepted.')
+    }
+  }
+  if (!res.ok) {
+    throw new Error(`Failed to ${action} suggestion`)
+  }
+  return res.json()
+}
+
 export async function getCollabWsUrl(): Promise<string> {
   const config = await loadConfig()
   return config.collabWsUrl || 'ws://localhost:8090/ws'
@@ -0,0 +1,150 @@
+import { useState } from 'react'
+import type { Editor } from '@tiptap/react'
+import { CommentThread, createThread, replyToThread, setThreadResolved } from '../api'
+import { resolveAnchor, selectionAnchor } from './anchors'
+
+type Props = {
+  documentId: string
+  userName: string
+  editor: Editor | null
+  canComment: boolean
+  threads: CommentThread[]
+  onThread: (thread: CommentThread) => void
+}
+
+export default function CommentsPanel({
+  documentId,
+  userName,
+  editor,
+  canComment,
+  threads,
+  onThread,
+}: Props) {
+  const [draft, setDraft] = useState('')
+  const [replies, setReplies] = useState<Record<string, string>>({})
+  const [showResolved, setShowResolved] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+
+  const author = { authorName: userName }
+  const visible = threads.filter((thread) => showResolved || !thread.resolved)
+
+  const run = async (action: () => Promise<CommentThread>) => {
+    setError(null)
+    try {
+      onThread(await action())
+      return true
+    } catch (err) {
+      setError((err as Error).message)
+      return false
+    }
+  }
+
+  const onCreate = async (event: React.FormEvent) => {
+    event.preventDefault()
+    const selection = editor ? selectionAnchor(editor) : null
+    if (!selection) {
+      setError('Select some text to comment on.')
+      return
+    }
+    if (await run(() => createThread(documentId, selection.anchor, selection.quote, { ...author, body: draft }))) {
+      setDraft('')
+    }
+  }
+
+  const onReply = async (threadId: string) => {
+    const body = replies[threadId] ?? ''
+    if (await run(() => replyToThread(documentId, threadId, { ...author, body }))) {
+      setReplies((prev) => ({ ...prev, [threadId]: '' }))
+    }
+  }
+
+  const onSelectThread = (thread: CommentThread) => {
+    const range = editor ? resolveAnchor(editor, thread.anchor) : null
+    if (editor && range) {
+      editor.chain().focus().setTextSelection(range).scrollIntoView().run()
+    }
+  }
+
+  return (
+    <div className="doclet-card p-6">
+      <div className="flex items-center justify-between">
+        <h3 className="text-lg font-semibold text-zinc-900">Comments</h3>
+        <label className="flex items-center gap-2 text-xs text-zinc-500">
+          <input
+            type="checkbox"
+            checked={showResolved}
+            onChange={(event) => setShowResolved(event.target.checked)}
+          />
+          Show resolved
+        </label>
+      </div>
+      {error ? <div className="mt-2 text-sm text-rose-500">{error}</div> : null}
+      {canComment ? (
+        <form onSubmit={onCreate} className="mt-4 flex gap-2">
+          <input
+            className="doclet-input flex-1"
+            placeholder="Comment on the selected text"
+            value={draft}
+            onChange={(event) => setDraft(event.target.value)}
+          />
+          <button className="doclet-button-secondary" type="submit" disabled={draft.trim() === ''}>
+            Comment
+          </button>
+        </form>
+      ) : null}
+      {visible.length === 0 ? <div className="mt-4 text-sm text-zinc-500">No comments yet.</div> : null}
+      <div className="mt-4 grid gap-3">
+        {visible.map((thread) => (
+          <div key={thread.thread_id} className={`doclet-row ${thread.resolved ? 'opacity-60' : ''}`}>
+            {thread.quote ? (
+              <button
+                type="button"
+                className="text-left text-xs italic text-zinc-500 hover:text-emerald-600"
+                onClick={() => onSelectThread(thread)}
+              >
+                “{thread.quote}”
+              </button>
+            ) : null}
+            <div className="mt-2 grid gap-2">
+              {thread.comments.map((comment) => (
+                <div key={comment.comment_id} className="text-sm">
+                  <span className="font-semibold text-zinc-900">{comment.author_name || 'Anonymous'}</span>{' '}
+                  <span className="text-zinc-700">{comment.body}</span>
+                </div>
+              ))}
+            </div>
+            {canComment ? (
+              <div className="mt-2 flex gap-2">
+                {!thread.resolved ? (
+                  <input
+                    className="doclet-input flex-1 py-1 text-xs"
+                    placeholder="Reply"
+                    value={replies[thread.thread_id] ?? ''}
+                    onChange={(event) =>
+                      setReplies((prev) => ({ ...prev, [thread.thread_id]: event.target.value }))
+                    }
+                    onKeyDown={(event) => {
+                      if (event.key === 'Enter') {
+                        event.preventDefault()
+                        onReply(thread.thread_id)
+                      }
+                    }}
+                  />
+                ) : null}
+                <button
+                  className="doclet-button-secondary text-xs"
+                  type="button"
+                  onClick={() =>
+                    run(() => setThreadResolved(documentId, thread.thread_id, !thread.resolved))
+                  }
+                >
+                  {thread.resolved ? 'Reopen' : 'Resolve'}
+                </button>
+              </div>
+            ) : null}
+          </div>
+        ))}
+      </div>
+    </div>
+  )
+}
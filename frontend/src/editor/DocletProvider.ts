@@ -5,15 +5,27 @@ import {
   encodeAwarenessUpdate,
 } from 'y-protocols/awareness'
 import { base64ToBytes, bytesToBase64 } from '../utils'
+import type { CommentThread, Suggestion } from '../api'
 
 export type ProviderOptions = {
   documentId: string
   clientId: string
+  token?: string | null
+  ticket?: string | null
+  readOnly?: boolean
+  // suggesting connections send their edits as suggestions, which the
+  // local doc keeps but nobody else sees until they are accepted.
+  suggesting?: boolean
   wsUrl: string
   doc: Y.Doc
   user: { name: string; color: string }
   onStatus?: (status: 'connected' | 'disconnected') => void
   onUserName?: (clientId: string, name: string) => void
+  onReadOnly?: (clientId: string, readOnly: boolean) => void
+  onError?: (code: string) => void
+  onTags?: (tags: string[]) => void
+  onComment?: (event: string, thread: CommentThread) => void
+  onSuggestion?: (event: string, suggestion: Suggestion) => void
 }
 
 type SocketMessage = {
@@ -21,27 +33,54 @@ type SocketMessage = {
   document_id: string
   client_id: string
   payload: string
+  read_only?: boolean
+  tags?: string[]
+  thread?: CommentThread
+  suggestion?: Suggestion
 }
 
+// Reconnect delays after the server closes the connection, in milliseconds.
+const minRetryDelay = 1000
+const maxRetryDelay = 30000
+
 export class DocletProvider {
   awareness: Awareness
 
   private doc: Y.Doc
   private ws: WebSocket | null = null
+  private destroyed = false
+  private retryDelay = minRetryDelay
   private documentId: string
   private clientId: string
+  private token?: string | null
+  private ticket?: string | null
+  private readOnly: boolean
+  private suggesting: boolean
   private wsUrl: string
   private onStatus?: (status: 'connected' | 'disconnected') => void
   private onUserName?: (clientId: string, name: string) => void
-  private snapshotTimer: number | null = null
+  private onReadOnly?: (clientId: string, readOnly: boolean) => void
+  private onError?: (code: string) => void
+  private onTags?: (tags: string[]) => void
+  private onComment?: (event: string, thread: CommentThread) => void
+  private onSuggestion?: (event: string, suggestion: Suggestion) => void
 
   constructor(options: ProviderOptions) {
     this.doc = options.doc
     this.documentId = options.documentId
     this.clientId = options.clientId
+    this.token = options.token
+    this.ticket = options.ticket
+    this.readOnly = options.readOnly ?? false
+    this.suggesting = options.suggesting ?? false
     this.wsUrl = options.wsUrl
     this.onStatus = options.onStatus
     this.onUserName = options.onUserName
+    this.onReadOnly = options.onReadOnly
+    this.onError = options.onError
+    this.onTags = options.onTags
+    this.onComment = options.onComment
+    this.onSuggestion = options.onSuggestion
     this.awareness = new Awareness(this.doc)
     this.awareness.setLocalStateField('user', {
       ...options.user,
@@ -60,18 +99,55 @@ export class DocletProvider {
     })
   }
 
+  private reconnect(delay: number) {
+    setTimeout(() => {
+      if (!this.destroyed) {
+        this.connect()
+      }
+    }, delay)
+  }
+
   private connect() {
     const url = new URL(this.wsUrl)
     url.searchParams.set('document_id', this.documentId)
     url.searchParams.set('client_id', this.clientId)
+    if (this.ticket) {
+      url.searchParams.set('ticket', this.ticket)
+    } else if (this.token) {
+      url.searchParams.set('token', this.token)
+    }
+    if (this.readOnly) {
+      url.searchParams.set('mode', 'readonly')
+    } else if (this.suggesting) {
+      url.searchParams.set('mode', 'suggest')
+    }
 
     this.ws = new WebSocket(url.toString())
     this.ws.onopen = () => {
+      this.retryDelay = minRetryDelay
       this.onStatus?.('connected')
-      this.sendSnapshot()
+      if (!this.readOnly && !this.suggesting) {
+        this.sendSnapshot()
+      }
     }
-    this.ws.onclose = () => {
+    this.ws.onclose = (event) => {
       this.onStatus?.('disconnected')
+      if (event.code === 4408) {
+        // Disconnected for falling behind: the next connection starts with
+        // the full state again.
+        this.reconnect(minRetryDelay)
+      } else if (event.code === 4503) {
+        // The replica could not load the document; back off so a struggling
+        // document service is not hammered by every open tab.
+        this.reconnect(this.retryDelay)
+        this.retryDelay = Math.min(this.retryDelay * 2, maxRetryDelay)
+      } else if (event.code === 4410) {
+        this.onError?.('document_deleted')
+      } else if (event.code === 4429) {
+        this.onError?.('rate_limited')
+      } else if (event.code === 4430) {
+        this.onError?.('too_many_connections')
+      }
     }
     this.ws.onmessage = (event) => {
       this.handleMessage(event.data)
@@ -88,10 +164,35 @@ export class DocletProvider {
     if (!msg || msg.document_id !== this.documentId) {
       return
     }
+    if (msg.type === 'error') {
+      this.onError?.(msg.payload)
+      return
+    }
+    if (msg.type.startsWith('comment_')) {
+      if (msg.thread) {
+        this.onComment?.(msg.type, msg.thread)
+      }
+      return
+    }
+    if (msg.type.startsWith('suggestion_')) {
+      if (msg.suggestion) {
+        this.onSuggestion?.(msg.type, msg.suggestion)
+      }
+      return
+    }
+    if (msg.type === 'tags') {
+      this.onTags?.(msg.tags ?? [])
+      return
+    }
     if (msg.type === 'user_name') {
       if (msg.payload) {
         this.onUserName?.(msg.client_id, msg.payload)
       }
+      this.onReadOnly?.(msg.client_id, !!msg.read_only)
+      return
+    }
+    if (msg.type === 'yjs_sync') {
+      Y.applyUpdate(this.doc, base64ToBytes(msg.payload), 'remote')
       return
     }
     if (msg.client_id === this.clientId) {
@@ -103,17 +204,17 @@ export class DocletProvider {
       return
     }
     if (msg.type === 'presence') {
+      this.onReadOnly?.(msg.client_id, !!msg.read_only)
       const update = base64ToBytes(msg.payload)
       applyAwarenessUpdate(this.awareness, update, 'remote')
     }
   }
 
   private handleDocUpdate = (update: Uint8Array, origin: unknown) => {
-    if (origin === 'remote') {
+    if (origin === 'remote' || this.readOnly) {
       return
     }
     this.sendMessage('yjs_update', bytesToBase64(update))
-    this.scheduleSnapshot()
   }
 
   private handleAwarenessUpdate = (
@@ -124,15 +225,6 @@ export class DocletProvider {
     this.sendMessage('presence', bytesToBase64(update))
   }
 
-  private scheduleSnapshot() {
-    if (this.snapshotTimer) {
-      window.clearTimeout(this.snapshotTimer)
-    }
-    this.snapshotTimer = window.setTimeout(() => {
-      this.sendSnapshot()
-    }, 1500)
-  }
-
   private sendSnapshot() {
     const update = Y.encodeStateAsUpdate(this.doc)
     this.sendMessage('yjs_snapshot', bytesToBase64(update))
@@ -152,14 +244,12 @@ export class DocletProvider {
   }
 
   destroy() {
+    this.destroyed = true
     this.doc.off('update', this.handleDocUpdate)
     this.awareness.off('update', this.handleAwarenessUpdate)
     if (this.ws) {
       this.ws.close()
       this.ws = null
     }
-    if (this.snapshotTimer) {
-      window.clearTimeout(this.snapshotTimer)
-    }
   }
 }
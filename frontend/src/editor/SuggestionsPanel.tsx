@@ -0,0 +1,79 @@
+import { useState } from 'react'
+import type { Editor } from '@tiptap/react'
+import { Suggestion, resolveSuggestion } from '../api'
+import { resolveAnchor } from './anchors'
+
+type Props = {
+  documentId: string
+  authorId: string
+  editor: Editor | null
+  canResolve: boolean
+  suggestions: Suggestion[]
+  onResolved: (suggestion: Suggestion) => void
+}
+
+export default function SuggestionsPanel({
+  documentId,
+  authorId,
+  editor,
+  canResolve,
+  suggestions,
+  onResolved,
+}: Props) {
+  const [error, setError] = useState<string | null>(null)
+
+  const onResolve = async (suggestion: Suggestion, accept: boolean) => {
+    setError(null)
+    try {
+      onResolved(await resolveSuggestion(documentId, suggestion.suggestion_id, accept))
+    } catch (err) {
+      setError((err as Error).message)
+    }
+  }
+
+  // Suggestions that insert text are only visible in their author's editor,
+  // so showing one selects the text around the place it changes.
+  const onShow = (suggestion: Suggestion) => {
+    const range = editor && suggestion.anchor ? resolveAnchor(editor, suggestion.anchor) : null
+    if (editor && range) {
+      editor.chain().focus().setTextSelection(range).scrollIntoView().run()
+    }
+  }
+
+  if (suggestions.length === 0) {
+    return null
+  }
+
+  return (
+    <div className="doclet-card p-6">
+      <h3 className="text-lg font-semibold text-zinc-900">Suggestions</h3>
+      {error ? <div className="mt-2 text-sm text-rose-500">{error}</div> : null}
+      <div className="mt-4 grid gap-3">
+        {suggestions.map((suggestion) => (
+          <div key={suggestion.suggestion_id} className="doclet-row flex items-center justify-between gap-3">
+            <button
+              type="button"
+              className="text-left text-sm text-zinc-700 hover:text-emerald-600"
+              onClick={() => onShow(suggestion)}
+            >
+              <span className="font-semibold text-zinc-900">
+                {suggestion.author_id === authorId ? 'You' : 'Someone'}
+              </span>{' '}
+              suggested an edit
+            </button>
+            {canResolve ? (
+              <div className="flex gap-2">
+                <button className="doclet-button-secondary text-xs" type="button" onClick={() => onResolve(suggestion, true)}>
+                  Accept
+                </button>
+                <button className="doclet-button-secondary text-xs" type="button" onClick={() => onResolve(suggestion, false)}>
+                  Reject
+                </button>
+              </div>
+            ) : null}
+          </div>
+        ))}
+      </div>
+    </div>
+  )
+}
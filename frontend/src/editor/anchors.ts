@@ -0,0 +1,56 @@
+import * as Y from 'yjs'
+import type { Editor } from '@tiptap/react'
+import {
+  absolutePositionToRelativePosition,
+  relativePositionToAbsolutePosition,
+  ySyncPluginKey,
+} from 'y-prosemirror'
+import { base64ToBytes, bytesToBase64 } from '../utils'
+import type { ThreadAnchor } from '../api'
+
+// Comment anchors are Yjs relative positions, so a thread keeps pointing at
+// the same text while others edit around it.
+
+export function selectionAnchor(editor: Editor): { anchor: ThreadAnchor; quote: string } | null {
+  const { from, to, empty } = editor.state.selection
+  const sync = ySyncPluginKey.getState(editor.state)
+  if (empty || !sync?.binding) {
+    return null
+  }
+  const { type, mapping } = sync.binding
+  const start = absolutePositionToRelativePosition(from, type, mapping)
+  const end = absolutePositionToRelativePosition(to, type, mapping)
+  return {
+    anchor: {
+      start: bytesToBase64(Y.encodeRelativePosition(start)),
+      end: bytesToBase64(Y.encodeRelativePosition(end)),
+    },
+    quote: editor.state.doc.textBetween(from, to, ' '),
+  }
+}
+
+// resolveAnchor returns the current editor range of an anchor, or null when
+// its text was deleted.
+export function resolveAnchor(editor: Editor, anchor: ThreadAnchor): { from: number; to: number } | null {
+  const sync = ySyncPluginKey.getState(editor.state)
+  if (!sync?.binding) {
+    return null
+  }
+  const { doc, type, mapping } = sync.binding
+  const from = relativePositionToAbsolutePosition(
+    doc,
+    type,
+    Y.decodeRelativePosition(base64ToBytes(anchor.start)),
+    mapping,
+  )
+  const to = relativePositionToAbsolutePosition(
+    doc,
+    type,
+    Y.decodeRelativePosition(base64ToBytes(anchor.end)),
+    mapping,
+  )
+  if (from === null || to === null || to <= from) {
+    return null
+  }
+  return { from, to }
+}
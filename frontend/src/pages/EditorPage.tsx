@@ -1,5 +1,5 @@
 import { useEffect, useMemo, useState } from 'react'
-import { Link, useNavigate, useParams } from 'react-router-dom'
+import { Link, useNavigate, useParams, useSearchParams } from 'react-router-dom'
 import { EditorContent, useEditor } from '@tiptap/react'
 import StarterKit from '@tiptap/starter-kit'
 import Collaboration from '@tiptap/extension-collaboration'
@@ -7,8 +7,27 @@ import CollaborationCursor from '@tiptap/extension-collaboration-cursor'
 import Underline from '@tiptap/extension-underline'
 import LinkExtension from '@tiptap/extension-link'
 import * as Y from 'yjs'
-import { getDocument, getCollabWsUrl, updateDocumentTitle, deleteDocument } from '../api'
+import {
+  getDocument,
+  getAccess,
+  getCollabWsUrl,
+  createCollabTicket,
+  getShareToken,
+  setShareToken,
+  createShareToken,
+  updateDocumentTitle,
+  deleteDocument,
+  addTags,
+  removeTag,
+  listThreads,
+  listSuggestions,
+  CommentThread,
+  Role,
+  Suggestion,
+} from '../api'
 import { DocletProvider } from '../editor/DocletProvider'
+import CommentsPanel from '../editor/CommentsPanel'
+import SuggestionsPanel from '../editor/SuggestionsPanel'
 import {
   base64ToBytes,
   colorFromSeed,
@@ -17,10 +36,18 @@ import {
 
 export default function EditorPage() {
   const { documentId } = useParams()
+  const [searchParams] = useSearchParams()
   const navigate = useNavigate()
+  const [role, setRole] = useState<Role>('viewer')
+  const [authorId, setAuthorId] = useState('')
+  const [shareError, setShareError] = useState<string | null>(null)
   const [displayName, setDisplayName] = useState('')
   const [isEditingTitle, setIsEditingTitle] = useState(false)
   const [titleError, setTitleError] = useState<string | null>(null)
+  const [tags, setTags] = useState<string[]>([])
+  const [newTag, setNewTag] = useState('')
+  const [threads, setThreads] = useState<CommentThread[]>([])
+  const [suggestions, setSuggestions] = useState<Suggestion[]>([])
   const [deleteError, setDeleteError] = useState<string | null>(null)
   const [error, setError] = useState<string | null>(null)
   const [status, setStatus] = useState<'connected' | 'disconnected'>('disconnected')
@@ -28,7 +55,8 @@ export default function EditorPage() {
   const [provider, setProvider] = useState<DocletProvider | null>(null)
   const [userName, setUserName] = useState('Anonymous')
   const [userNames, setUserNames] = useState<Record<string, string>>({})
-  const [activeUsers, setActiveUsers] = useState<Array<{ id: number; name: string }>>([])
+  const [readOnlyClients, setReadOnlyClients] = useState<Record<string, boolean>>({})
+  const [activeUsers, setActiveUsers] = useState<Array<{ id: number; name: string; readOnly: boolean }>>([])
 
   const clientId = useMemo(() => getSessionClientId(), [])
   const ydoc = useMemo(() => new Y.Doc(), [documentId])
@@ -38,13 +66,27 @@ export default function EditorPage() {
       return
     }
     let isMounted = true
+    const linkToken = searchParams.get('token')
+    if (linkToken) {
+      setShareToken(documentId, linkToken)
+    }
     const loadDoc = async () => {
       try {
-        const doc = await getDocument(documentId)
+        const [doc, access, docThreads, docSuggestions] = await Promise.all([
+          getDocument(documentId),
+          getAccess(documentId),
+          listThreads(documentId),
+          listSuggestions(documentId),
+        ])
         if (!isMounted) {
           return
         }
+        setRole(access.role)
+        setAuthorId(access.authorId)
         setDisplayName(doc.displayName)
+        setTags(doc.tags ?? [])
+        setThreads(docThreads)
+        setSuggestions(docSuggestions)
         const update = base64ToBytes(doc.content)
         if (update.length > 0) {
           Y.applyUpdate(ydoc, update)
@@ -59,7 +101,11 @@ export default function EditorPage() {
     return () => {
       isMounted = false
     }
-  }, [documentId, ydoc])
+  }, [documentId, ydoc, searchParams])
+
+  const canEdit = role === 'editor' || role === 'owner'
+  // Commenters always suggest; editors opt in with ?mode=suggest.
+  const suggesting = role === 'commenter' || (canEdit && searchParams.get('mode') === 'suggest')
 
   useEffect(() => {
     if (!ready || !documentId) {
@@ -73,13 +119,25 @@ export default function EditorPage() {
     let nextProvider: DocletProvider | null = null
 
     const connect = async () => {
-      const wsUrl = await getCollabWsUrl()
+      let wsUrl: string
+      let ticket: string | null
+      try {
+        wsUrl = await getCollabWsUrl()
+        ticket = await createCollabTicket(documentId, clientId)
+      } catch (err) {
+        setError((err as Error).message)
+        return
+      }
       if (cancelled) {
         return
       }
       nextProvider = new DocletProvider({
         documentId,
         clientId,
+        token: getShareToken(documentId),
+        ticket,
+        readOnly: !canEdit && !suggesting,
+        suggesting,
         wsUrl,
         doc: ydoc,
         user,
@@ -90,6 +148,42 @@ export default function EditorPage() {
             setUserName(name || 'Anonymous')
           }
         },
+        onTags: setTags,
+        onComment: (event, thread) => {
+          if (event === 'comment_thread_deleted') {
+            setThreads((prev) => prev.filter((t) => t.thread_id !== thread.thread_id))
+          } else {
+            setThreads((prev) => upsertThread(prev, thread))
+          }
+        },
+        onSuggestion: (event, suggestion) => {
+          if (event === 'suggestion_created') {
+            setSuggestions((prev) => upsertSuggestion(prev, suggestion))
+            return
+          }
+          setSuggestions((prev) => prev.filter((s) => s.suggestion_id !== suggestion.suggestion_id))
+          if (event === 'suggestion_rejected' && suggestion.author_id === authorId) {
+            // The rejected edit only lives in this tab's copy of the
+            // document; reloading drops it.
+            window.location.reload()
+          }
+        },
+        onReadOnly: (id, readOnly) => {
+          setReadOnlyClients((prev) => (prev[id] === readOnly ? prev : { ...prev, [id]: readOnly }))
+        },
+        onError: (code) => {
+          if (code === 'read_only') {
+            setError('This document is view-only.')
+          } else if (code === 'document_deleted') {
+            setError('This document was deleted.')
+          } else if (code === 'rate_limited') {
+            setError('You were disconnected for sending changes too quickly. Reload to continue.')
+          } else if (code === 'too_many_connections') {
+            setError('Too many people have this document open. Try again later.')
+          } else {
+            setError(code)
+          }
+        },
       })
       setProvider(nextProvider)
     }
@@ -103,7 +197,7 @@ export default function EditorPage() {
       setProvider(null)
       setStatus('disconnected')
     }
-  }, [ready, documentId, clientId, ydoc, userName])
+  }, [ready, documentId, clientId, authorId, ydoc, userName, role, canEdit, suggesting])
 
   useEffect(() => {
     if (!provider) {
@@ -120,7 +214,7 @@ export default function EditorPage() {
       return
     }
     const updateUsers = () => {
-      const users: Array<{ id: number; name: string }> = []
+      const users: Array<{ id: number; name: string; readOnly: boolean }> = []
       const selfId = provider.awareness.clientID
       provider.awareness.getStates().forEach((state, id) => {
         if (id === selfId) {
@@ -129,7 +223,7 @@ export default function EditorPage() {
         const nameFromState = state?.user?.name
         const clientIdFromState = state?.user?.clientId
         const name = nameFromState || userNames[clientIdFromState] || 'Anonymous'
-        users.push({ id, name })
+        users.push({ id, name, readOnly: !!readOnlyClients[clientIdFromState] })
       })
       setActiveUsers(users)
     }
@@ -138,11 +232,14 @@ export default function EditorPage() {
     return () => {
       provider.awareness.off('update', updateUsers)
     }
-  }, [provider, userNames])
+  }, [provider, userNames, readOnlyClients])
+
+  const viewerCount = activeUsers.filter((user) => user.readOnly).length
 
   const editor = useEditor(
     provider
       ? {
+        editable: canEdit || suggesting,
         extensions: [
           StarterKit.configure({ history: false }),
           Underline,
@@ -183,7 +280,7 @@ export default function EditorPage() {
         extensions: [StarterKit.configure({ history: false }), Underline, LinkExtension],
         editable: false,
       },
-    [provider]
+    [provider, canEdit, suggesting]
   )
 
   if (!documentId) {
@@ -247,12 +344,60 @@ export default function EditorPage() {
               ) : (
                 <button
                   className="text-left text-3xl font-semibold text-zinc-900 hover:text-emerald-600"
-                  onClick={() => setIsEditingTitle(true)}
+                  onClick={() => setIsEditingTitle(canEdit)}
                   type="button"
                 >
                   {displayName || 'Untitled'}
                 </button>
               )}
+              <div className="mt-2 flex flex-wrap items-center gap-2">
+                {tags.map((tag) => (
+                  <span key={tag} className="doclet-pill text-xs">
+                    {tag}
+                    {canEdit ? (
+                      <button
+                        type="button"
+                        aria-label={`Remove tag ${tag}`}
+                        className="text-zinc-400 hover:text-rose-500"
+                        onClick={async () => {
+                          try {
+                            setTags(await removeTag(documentId, tag))
+                            setTitleError(null)
+                          } catch (err) {
+                            setTitleError((err as Error).message)
+                          }
+                        }}
+                      >
+                        ×
+                      </button>
+                    ) : null}
+                  </span>
+                ))}
+                {canEdit ? (
+                  <form
+                    onSubmit={async (event) => {
+                      event.preventDefault()
+                      if (newTag.trim() === '') {
+                        return
+                      }
+                      try {
+                        setTags(await addTags(documentId, [newTag.trim()]))
+                        setNewTag('')
+                        setTitleError(null)
+                      } catch (err) {
+                        setTitleError((err as Error).message)
+                      }
+                    }}
+                  >
+                    <input
+                      className="doclet-input py-1 text-xs"
+                      placeholder="Add tag"
+                      value={newTag}
+                      onChange={(event) => setNewTag(event.target.value)}
+                    />
+                  </form>
+                ) : null}
+              </div>
             </div>
           </div>
           <div>
@@ -267,7 +412,9 @@ export default function EditorPage() {
             <div className="mt-1 text-xs text-zinc-500">
               {activeUsers.length === 0
                 ? "You're the only one here"
-                : `${activeUsers.length} other active collaborator${activeUsers.length > 1 ? 's' : ''}`}
+                : `${activeUsers.length} other active collaborator${activeUsers.length > 1 ? 's' : ''}${
+                  viewerCount > 0 ? ` (${viewerCount} view-only)` : ''
+                }`}
             </div>
           </div>
         </div>
@@ -337,7 +484,31 @@ export default function EditorPage() {
             >
               Link
             </button>
+            {canEdit ? (
+              <button
+                className="doclet-toolbar-button ml-auto"
+                type="button"
+                onClick={() => {
+                  // Suggested edits stay in the local document, so switching
+                  // modes starts over from the shared one.
+                  const url = new URL(window.location.href)
+                  if (suggesting) {
+                    url.searchParams.delete('mode')
+                  } else {
+                    url.searchParams.set('mode', 'suggest')
+                  }
+                  window.location.assign(url.toString())
+                }}
+              >
+                {suggesting ? 'Edit directly' : 'Suggest edits'}
+              </button>
+            ) : null}
           </div>
+          {suggesting ? (
+            <div className="mt-3 text-xs text-zinc-500">
+              You are suggesting. Your edits reach others once an editor accepts them.
+            </div>
+          ) : null}
           <div
             className="mt-4 min-h-[460px] rounded-2xl border border-zinc-200 bg-white p-4"
             onClick={() => editor?.commands.focus()}
@@ -346,30 +517,93 @@ export default function EditorPage() {
           </div>
         </div>
 
-        <div className="flex justify-end">
-          <button
-            className="doclet-button-secondary border-rose-200 text-rose-600 hover:border-rose-400 hover:text-rose-700"
-            type="button"
-            onClick={async () => {
-              if (!documentId) {
-                return
-              }
-              const confirmed = window.confirm('Delete this document? This cannot be undone.')
-              if (!confirmed) {
-                return
-              }
-              try {
-                await deleteDocument(documentId)
-                navigate('/')
-              } catch (err) {
-                setDeleteError((err as Error).message)
-              }
-            }}
-          >
-            Delete document
-          </button>
-        </div>
+        <SuggestionsPanel
+          documentId={documentId}
+          authorId={authorId}
+          editor={editor}
+          canResolve={canEdit}
+          suggestions={suggestions}
+          onResolved={(suggestion) =>
+            setSuggestions((prev) => prev.filter((s) => s.suggestion_id !== suggestion.suggestion_id))
+          }
+        />
+
+        <CommentsPanel
+          documentId={documentId}
+          userName={userName}
+          editor={editor}
+          canComment={role !== 'viewer'}
+          threads={threads}
+          onThread={(thread) => setThreads((prev) => upsertThread(prev, thread))}
+        />
+
+        {role === 'owner' && (
+          <div className="flex items-center justify-end gap-3">
+            {shareError && <span className="text-sm text-rose-600">{shareError}</span>}
+            <button
+              className="doclet-button-secondary"
+              type="button"
+              onClick={async () => {
+                if (!documentId) {
+                  return
+                }
+                const requested = window.prompt('Share as viewer, commenter, editor or owner?', 'viewer')
+                if (!requested) {
+                  return
+                }
+                try {
+                  const token = await createShareToken(documentId, requested.trim() as Role)
+                  const link = `${window.location.origin}/doc/${documentId}?token=${token}`
+                  window.prompt('Share link', link)
+                  setShareError(null)
+                } catch (err) {
+                  setShareError((err as Error).message)
+                }
+              }}
+            >
+              Share
+            </button>
+            <button
+              className="doclet-button-secondary border-rose-200 text-rose-600 hover:border-rose-400 hover:text-rose-700"
+              type="button"
+              onClick={async () => {
+                if (!documentId) {
+                  return
+                }
+                const confirmed = window.confirm('Delete this document? This cannot be undone.')
+                if (!confirmed) {
+                  return
+                }
+                try {
+                  await deleteDocument(documentId)
+                  navigate('/')
+                } catch (err) {
+                  setDeleteError((err as Error).message)
+                }
+              }}
+            >
+              Delete document
+            </button>
+          </div>
+        )}
       </div>
     </div>
   )
 }
+
+function upsertThread(threads: CommentThread[], thread: CommentThread) {
+  const index = threads.findIndex((t) => t.thread_id === thread.thread_id)
+  if (index < 0) {
+    return threads.concat(thread)
+  }
+  const next = threads.slice()
+  next[index] = thread
+  return next
+}
+
+function upsertSuggestion(suggestions: Suggestion[], suggestion: Suggestion) {
+  if (suggestions.some((s) => s.suggestion_id === suggestion.suggestion_id)) {
+    return suggestions
+  }
+  return suggestions.concat(suggestion)
+}
@@ -1,23 +1,45 @@
 import { useEffect, useMemo, useState } from 'react'
-import { Link, useNavigate } from 'react-router-dom'
-import { createDocument, listDocuments, DocumentListItem } from '../api'
+import { Link, useNavigate, useSearchParams } from 'react-router-dom'
+import {
+  createDocument,
+  listDocuments,
+  listFolders,
+  listTrash,
+  listWorkspaces,
+  restoreDocument,
+  setWorkspaceToken,
+  DocumentListItem,
+  Folder,
+} from '../api'
 
 export default function HomePage() {
   const navigate = useNavigate()
+  const [searchParams] = useSearchParams()
   const [query, setQuery] = useState('')
   const [docs, setDocs] = useState<DocumentListItem[]>([])
+  const [trash, setTrash] = useState<DocumentListItem[]>([])
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
+  const [listedQuery, setListedQuery] = useState('')
+  const [folders, setFolders] = useState<Folder[]>([])
+  const [folderId, setFolderId] = useState('')
   const [loading, setLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
   const [displayName, setDisplayName] = useState('')
 
   const searchLabel = useMemo(() => (query ? `Results for "${query}"` : 'Recent documents'), [query])
 
-  const refresh = async (nextQuery: string) => {
+  const refresh = async (nextQuery: string, nextFolderId = folderId) => {
     setLoading(true)
     setError(null)
     try {
-      const items = await listDocuments(nextQuery)
-      setDocs(items)
+      const [page, trashed] = await Promise.all([
+        listDocuments(nextQuery, undefined, nextFolderId),
+        listTrash(),
+      ])
+      setDocs(page.items)
+      setNextCursor(page.nextCursor)
+      setListedQuery(nextQuery)
+      setTrash(trashed)
     } catch (err) {
       setError((err as Error).message)
     } finally {
@@ -27,13 +49,52 @@ export default function HomePage() {
 
   useEffect(() => {
     refresh('')
+    // Workspace links carry the workspace's token like share links do.
+    const linkWorkspace = searchParams.get('workspace_id')
+    const linkToken = searchParams.get('workspace_token')
+    if (linkWorkspace && linkToken) {
+      setWorkspaceToken(linkWorkspace, linkToken)
+    }
+    listWorkspaces()
+      .then((workspaces) => Promise.all(workspaces.map((ws) => listFolders(ws.workspace_id))))
+      .then((lists) => setFolders(lists.flat()))
+      .catch((err) => setError((err as Error).message))
   }, [])
 
+  const onSelectFolder = (nextFolderId: string) => {
+    setFolderId(nextFolderId)
+    refresh(query, nextFolderId)
+  }
+
   const onSearch = (event: React.FormEvent) => {
     event.preventDefault()
     refresh(query)
   }
 
+  const onLoadMore = async () => {
+    setLoading(true)
+    setError(null)
+    try {
+      const page = await listDocuments(listedQuery, nextCursor, folderId)
+      setDocs((prev) => prev.concat(page.items))
+      setNextCursor(page.nextCursor)
+    } catch (err) {
+      setError((err as Error).message)
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const onRestore = async (documentId: string) => {
+    setError(null)
+    try {
+      await restoreDocument(documentId)
+      await refresh(query)
+    } catch (err) {
+      setError((err as Error).message)
+    }
+  }
+
   const onCreate = async (event: React.FormEvent) => {
     event.preventDefault()
     setLoading(true)
@@ -91,10 +152,24 @@ export default function HomePage() {
             <form onSubmit={onSearch} className="flex flex-wrap gap-3">
               <input
                 className="doclet-input flex-1"
-                placeholder="Search by document name"
+                placeholder="Search by title or content"
                 value={query}
                 onChange={(event) => setQuery(event.target.value)}
               />
+              {folders.length > 0 ? (
+                <select
+                  className="doclet-input"
+                  value={folderId}
+                  onChange={(event) => onSelectFolder(event.target.value)}
+                >
+                  <option value="">All folders</option>
+                  {folders.map((folder) => (
+                    <option key={folder.folder_id} value={folder.folder_id}>
+                      {folder.name}
+                    </option>
+                  ))}
+                </select>
+              ) : null}
               <button className="doclet-button-secondary" type="submit">Search</button>
             </form>
           </div>
@@ -119,12 +194,63 @@ export default function HomePage() {
                   >
                     Updated {formatRelativeTime(doc.updated_at)}
                   </div>
+                  {doc.tags && doc.tags.length > 0 ? (
+                    <div className="mt-1 flex flex-wrap gap-1">
+                      {doc.tags.map((tag) => (
+                        <span key={tag} className="doclet-pill text-xs">{tag}</span>
+                      ))}
+                    </div>
+                  ) : null}
+                  {doc.snippet ? (
+                    // The server escapes snippets and only adds <mark> tags.
+                    <div
+                      className="mt-1 text-xs text-zinc-600"
+                      dangerouslySetInnerHTML={{ __html: doc.snippet }}
+                    />
+                  ) : null}
                 </div>
                 <span className="text-sm font-semibold text-emerald-500">Open →</span>
               </Link>
             ))}
           </div>
+          {nextCursor ? (
+            <button
+              className="doclet-button-secondary mt-4"
+              type="button"
+              disabled={loading}
+              onClick={onLoadMore}
+            >
+              Load more
+            </button>
+          ) : null}
         </div>
+
+        {trash.length > 0 ? (
+          <div className="mt-10 doclet-card p-6">
+            <h3 className="text-lg font-semibold text-zinc-900">Trash</h3>
+            <div className="mt-4 grid gap-3">
+              {trash.map((doc) => (
+                <div key={doc.document_id} className="doclet-row flex items-center justify-between gap-4">
+                  <div>
+                    <div className="text-sm font-semibold text-zinc-900">
+                      {doc.displayName || 'Untitled'}
+                    </div>
+                    <div className="text-xs text-zinc-500">
+                      Deleted {doc.deleted_at ? formatRelativeTime(doc.deleted_at) : ''}
+                    </div>
+                  </div>
+                  <button
+                    className="doclet-button-secondary"
+                    type="button"
+                    onClick={() => onRestore(doc.document_id)}
+                  >
+                    Restore
+                  </button>
+                </div>
+              ))}
+            </div>
+          </div>
+        ) : null}
       </div>
     </div>
   )
@@ -0,0 +1,90 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"doclet/shared/access"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Grant is what a share token allows on a document. AuthorID is the
+// identity the document service derives from the token; suggestions are
+// attributed to it rather than to the client ID a connection picks.
+type Grant struct {
+	Role     access.Role
+	AuthorID string
+}
+
+// Authorizer resolves what a share token grants on a document. It returns
+// access.ErrDenied when the token grants nothing and ErrDocumentNotFound
+// when the document is missing or in the trash.
+type Authorizer interface {
+	Authorize(ctx context.Context, documentID, token string) (Grant, error)
+}
+
+type AuthorizerFunc func(ctx context.Context, documentID, token string) (Grant, error)
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, documentID, token string) (Grant, error) {
+	return f(ctx, documentID, token)
+}
+
+// remoteAuthorizer asks the document service's access endpoint.
+type remoteAuthorizer struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRemoteAuthorizer authorizes tokens against the document service at
+// baseURL.
+func NewRemoteAuthorizer(baseURL string) Authorizer {
+	return &remoteAuthorizer{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (a *remoteAuthorizer) Authorize(ctx context.Context, documentID, token string) (Grant, error) {
+	endpoint := a.baseURL + "/documents/" + url.PathEscape(documentID) + "/access"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Grant{}, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Grant{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Grant{}, ErrDocumentNotFound
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return Grant{}, access.ErrDenied
+	default:
+		return Grant{}, fmt.Errorf("document service returned %s", resp.Status)
+	}
+	var body struct {
+		Role     string `json:"role"`
+		AuthorID string `json:"author_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Grant{}, err
+	}
+	role, ok := access.ParseRole(body.Role)
+	if !ok {
+		return Grant{}, fmt.Errorf("unknown role %q", body.Role)
+	}
+	return Grant{Role: role, AuthorID: body.AuthorID}, nil
+}
@@ -0,0 +1,59 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"doclet/shared/broker"
+)
+
+// publishMessage encodes msg as JSON and publishes it on subject.
+func publishMessage(ctx context.Context, b broker.Broker, subject string, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("broker marshal error: %v", err)
+		return
+	}
+	if err := b.Publish(ctx, subject, data); err != nil {
+		log.Printf("broker publish error: %v", err)
+	}
+}
+
+func subscribeMessages(b broker.Broker, subject string, handler func(Message)) error {
+	_, err := b.Subscribe(subject, func(_ context.Context, _ string, data []byte) {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("broker decode error: %v", err)
+			return
+		}
+		handler(msg)
+	})
+	return err
+}
+
+// replayMessages replays retained messages when the broker keeps any.
+func replayMessages(ctx context.Context, b broker.Broker, subject string, since time.Time, handler func(Message)) error {
+	replayer, ok := b.(broker.Replayer)
+	if !ok {
+		return nil
+	}
+	return replayer.Replay(ctx, subject, since, func(data []byte) {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("broker replay decode error: %v", err)
+			return
+		}
+		handler(msg)
+	})
+}
+
+func SubjectForDocument(docID, suffix string) string {
+	clean := strings.TrimSpace(docID)
+	if clean == "" {
+		clean = "unknown"
+	}
+	return "doclet.documents." + clean + "." + suffix
+}
@@ -1,21 +1,108 @@
 package collab
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 const (
-	defaultHTTPAddr = ":8090"
-	defaultNATSURL  = "nats://127.0.0.1:4222"
+	defaultHTTPAddr        = ":8090"
+	defaultNATSURL         = "nats://127.0.0.1:4222"
+	defaultSnapshotDelay   = 2 * time.Second
+	defaultSnapshotMaxWait = 10 * time.Second
+	defaultSuggestionDelay = 2 * time.Second
+	defaultStreamMaxAge    = 24 * time.Hour
+	defaultReplayWindow    = 15 * time.Minute
+	defaultDocumentURL     = "http://127.0.0.1:8080"
+
+	defaultMaxConnectionsPerDocument = 200
+	defaultMaxConnectionsPerIP       = 50
+)
+
+var (
+	defaultClientLimit = RateLimit{
+		Messages:     50,
+		MessageBurst: 200,
+		Bytes:        512 * 1024,
+		ByteBurst:    4 * 1024 * 1024,
+	}
+	defaultDocumentLimit = RateLimit{
+		Messages:     500,
+		MessageBurst: 2000,
+		Bytes:        4 * 1024 * 1024,
+		ByteBurst:    16 * 1024 * 1024,
+	}
 )
 
 type Config struct {
 	HTTPAddr string
 	NATSURL  string
+	// DocumentURL is the document service that authorizes share tokens.
+	DocumentURL string
+	// TicketKey verifies session tickets signed by the document service.
+	// When set, connections need a ticket instead of a share token.
+	TicketKey string
+	// SnapshotDelay is how long a document must be idle before its merged
+	// state is published as a snapshot; SnapshotMaxWait bounds the delay
+	// while edits keep coming in.
+	SnapshotDelay   time.Duration
+	SnapshotMaxWait time.Duration
+	// SuggestionDelay is how long a suggesting client must pause before
+	// its buffered edits are sent off as one suggestion.
+	SuggestionDelay time.Duration
+	// JetStream stores doclet.documents.> in a stream kept for
+	// StreamMaxAge; the first client joining a document then replays the
+	// updates published during the last ReplayWindow.
+	JetStream    bool
+	StreamMaxAge time.Duration
+	ReplayWindow time.Duration
+	// ClientLimit and DocumentLimit cap what a single client and all
+	// clients of a document may send per second; clients going over are
+	// disconnected. The connection caps count open connections on this
+	// replica. Zero disables a limit.
+	ClientLimit               RateLimit
+	DocumentLimit             RateLimit
+	MaxConnectionsPerDocument int
+	MaxConnectionsPerIP       int
+	// CoalesceUpdates merges the updates a slow client cannot take yet
+	// into one instead of disconnecting it right away.
+	CoalesceUpdates bool
+	// OTLPEndpoint receives traces over OTLP/HTTP; tracing is off when it
+	// is empty.
+	OTLPEndpoint string
 }
 
 func LoadConfig() Config {
 	return Config{
-		HTTPAddr: getenv("DOCLET_COLLAB_ADDR", defaultHTTPAddr),
-		NATSURL:  getenv("DOCLET_NATS_URL", defaultNATSURL),
+		HTTPAddr:        getenv("DOCLET_COLLAB_ADDR", defaultHTTPAddr),
+		NATSURL:         getenv("DOCLET_NATS_URL", defaultNATSURL),
+		DocumentURL:     getenv("DOCLET_DOCUMENT_URL", defaultDocumentURL),
+		TicketKey:       os.Getenv("DOCLET_TICKET_KEY"),
+		SnapshotDelay:   getenvDuration("DOCLET_COLLAB_SNAPSHOT_DELAY", defaultSnapshotDelay),
+		SnapshotMaxWait: getenvDuration("DOCLET_COLLAB_SNAPSHOT_MAX_WAIT", defaultSnapshotMaxWait),
+		SuggestionDelay: getenvDuration("DOCLET_COLLAB_SUGGESTION_DELAY", defaultSuggestionDelay),
+		JetStream:       getenvBool("DOCLET_NATS_JETSTREAM"),
+		StreamMaxAge:    getenvDuration("DOCLET_NATS_STREAM_MAX_AGE", defaultStreamMaxAge),
+		ReplayWindow:    getenvDuration("DOCLET_COLLAB_REPLAY_WINDOW", defaultReplayWindow),
+
+		ClientLimit:               getenvRateLimit("DOCLET_COLLAB_CLIENT", defaultClientLimit),
+		DocumentLimit:             getenvRateLimit("DOCLET_COLLAB_DOCUMENT", defaultDocumentLimit),
+		MaxConnectionsPerDocument: getenvInt("DOCLET_COLLAB_MAX_CONNECTIONS_PER_DOCUMENT", defaultMaxConnectionsPerDocument),
+		MaxConnectionsPerIP:       getenvInt("DOCLET_COLLAB_MAX_CONNECTIONS_PER_IP", defaultMaxConnectionsPerIP),
+		CoalesceUpdates:           getenvBool("DOCLET_COLLAB_COALESCE_UPDATES"),
+		OTLPEndpoint:              os.Getenv("DOCLET_OTLP_ENDPOINT"),
+	}
+}
+
+// getenvRateLimit reads prefix_MESSAGE_RATE, _MESSAGE_BURST, _BYTE_RATE and
+// _BYTE_BURST, falling back to the fields of fallback.
+func getenvRateLimit(prefix string, fallback RateLimit) RateLimit {
+	return RateLimit{
+		Messages:     getenvFloat(prefix+"_MESSAGE_RATE", fallback.Messages),
+		MessageBurst: getenvInt(prefix+"_MESSAGE_BURST", fallback.MessageBurst),
+		Bytes:        getenvFloat(prefix+"_BYTE_RATE", fallback.Bytes),
+		ByteBurst:    getenvInt(prefix+"_BYTE_BURST", fallback.ByteBurst),
 	}
 }
 
@@ -26,3 +113,33 @@ func getenv(key, fallback string) string {
 	}
 	return value
 }
+
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func getenvBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && value
+}
+
+// getenvInt and getenvFloat accept zero, which disables limits.
+func getenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func getenvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
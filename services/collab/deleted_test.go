@@ -0,0 +1,68 @@
+package collab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/gorilla/websocket"
+)
+
+func TestJoinRefusesDocumentNotLoaded(t *testing.T) {
+	ts := startServerWithLoader(t, nil, LoaderFunc(func(context.Context, string, Credentials) ([]byte, error) {
+		return nil, ErrDocumentNotFound
+	}))
+	c := dial(t, ts, loadDocument, "alice")
+	for range c.messages {
+	}
+	if _, _, err := c.conn.ReadMessage(); !websocket.IsCloseError(err, closeDocumentDeleted) {
+		t.Fatalf("read error = %v, want close %d", err, closeDocumentDeleted)
+	}
+}
+
+// TestJoinChecksDeletion covers a replica that missed the deleted and
+// restored events: joins go by what the document service says.
+func TestJoinChecksDeletion(t *testing.T) {
+	var deleted atomic.Bool
+	hub := NewHub()
+	s := NewServer(hub, nil, AuthorizerFunc(func(context.Context, string, string) (Grant, error) {
+		if deleted.Load() {
+			return Grant{}, ErrDocumentNotFound
+		}
+		return Grant{Role: access.RoleEditor}, nil
+	}), nil, Config{SnapshotDelay: time.Hour, SnapshotMaxWait: time.Hour, SuggestionDelay: time.Hour})
+	ts := httptest.NewServer(s.Router())
+	t.Cleanup(ts.Close)
+
+	alice := dial(t, ts, loadDocument, "alice")
+	alice.next(t, messageUserName)
+
+	deleted.Store(true)
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?" + url.Values{
+		"document_id": {loadDocument},
+		"client_id":   {"bob"},
+	}.Encode()
+	_, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("joining a deleted document: err = %v, resp = %v, want 404", err, resp)
+	}
+	for range alice.messages {
+	}
+	if _, _, err := alice.conn.ReadMessage(); !websocket.IsCloseError(err, closeDocumentDeleted) {
+		t.Fatalf("alice read error = %v, want close %d", err, closeDocumentDeleted)
+	}
+
+	// A stale deleted mark does not keep clients out of a restored document.
+	deleted.Store(false)
+	hub.MarkDeleted(loadDocument)
+	dial(t, ts, loadDocument, "carol").next(t, messageUserName)
+	if hub.IsDeleted(loadDocument) {
+		t.Error("document still marked deleted after the service authorized it")
+	}
+}
@@ -1,11 +1,16 @@
 package collab
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"doclet/shared/access"
+	"doclet/shared/yjs"
 	"github.com/gorilla/websocket"
 )
 
@@ -14,80 +19,475 @@ type Message struct {
 	DocumentID string `json:"document_id"`
 	ClientID   string `json:"client_id"`
 	Payload    string `json:"payload"`
+	Origin     string `json:"origin,omitempty"`
+	// AuthorID is the server-derived identity suggestion messages are
+	// attributed to, see Grant.
+	AuthorID string `json:"author_id,omitempty"`
+	// ReadOnly flags presence and user_name messages from read-only clients.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Tags is the document's full tag list in tags messages.
+	Tags []string `json:"tags,omitempty"`
+	// Thread is the comment thread of comment_* messages, relayed as the
+	// document service encoded it.
+	Thread json.RawMessage `json:"thread,omitempty"`
+	// Suggestion is the suggestion of suggestion_* messages, relayed the
+	// same way.
+	Suggestion json.RawMessage `json:"suggestion,omitempty"`
 }
 
+// maxMessageSize is the largest frame a client may send.
+const maxMessageSize = 1024 * 1024
+
+// maxBacklogSize bounds the Yjs updates held back for a slow client when
+// coalescing; beyond it the client is disconnected after all.
+const maxBacklogSize = 8 * 1024 * 1024
+
 type Client struct {
 	conn       *websocket.Conn
 	send       chan []byte
 	documentID string
 	clientID   string
+	// authorID is who the client's suggestions are attributed to.
+	authorID string
+	// ip is the remote address the connection counts against.
+	ip   string
+	role access.Role
+	// readOnly clients receive broadcasts and presence but may not change
+	// the document.
+	readOnly bool
+	// suggesting clients' updates are turned into suggestions instead of
+	// being applied.
+	suggesting bool
+	// binary clients speak the y-websocket protocol instead of the JSON
+	// Message envelope.
+	binary bool
+	// limiter caps what this client may send; limited is set once it or
+	// its document went over and it is being disconnected.
+	limiter *rateLimiter
+	limited atomic.Bool
+	// sentMessages and sentBytes count what the client took from its
+	// document's rate limit since the limit last ran out.
+	sentMessages atomic.Int64
+	sentBytes    atomic.Int64
+	// dropped counts messages that did not fit into send. slow is set once
+	// the client is being disconnected for falling behind.
+	dropped atomic.Int64
+	slow    atomic.Bool
+	// backlog holds Yjs updates that did not fit into send while the hub
+	// coalesces; wake tells WritePump to send them as one merged update.
+	backlogMu   sync.Mutex
+	backlog     [][]byte
+	backlogSize int
+	wake        chan struct{}
 }
 
+var (
+	// errDocumentDeleted is returned by Register for documents in the trash.
+	errDocumentDeleted = errors.New("document deleted")
+	// errConnectionLimit is returned by Register when the document or the
+	// client's IP already has as many connections as allowed.
+	errConnectionLimit = errors.New("too many connections")
+	// errDocumentUnavailable is returned by Server.join when the document's
+	// state could not be loaded.
+	errDocumentUnavailable = errors.New("document unavailable")
+)
+
 type Hub struct {
 	mu      sync.RWMutex
 	clients map[string]map[string]*Client
+	docs    map[string]*docState
+	// deleted holds documents the document service has moved to the trash.
+	deleted map[string]struct{}
+	// ips counts connections per remote IP.
+	ips map[string]int
+	// limiters cap what all clients of a document may send together.
+	limiters map[string]*rateLimiter
+
+	documentLimit  RateLimit
+	maxPerDocument int
+	maxPerIP       int
+	// coalesce holds back updates for clients whose send buffer is full
+	// instead of disconnecting them.
+	coalesce bool
 }
 
 func NewHub() *Hub {
-	return &Hub{clients: make(map[string]map[string]*Client)}
+	return &Hub{
+		clients:  make(map[string]map[string]*Client),
+		docs:     make(map[string]*docState),
+		deleted:  make(map[string]struct{}),
+		ips:      make(map[string]int),
+		limiters: make(map[string]*rateLimiter),
+	}
 }
 
-func (h *Hub) Register(client *Client) {
+// setLimits configures per-document rate limits and connection caps; zero
+// values disable them.
+func (h *Hub) setLimits(documentLimit RateLimit, maxPerDocument, maxPerIP int) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	if h.clients[client.documentID] == nil {
+	h.documentLimit = documentLimit
+	h.maxPerDocument = maxPerDocument
+	h.maxPerIP = maxPerIP
+}
+
+func (h *Hub) setCoalesce(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.coalesce = enabled
+}
+
+// Register adds the client and reports whether it is the document's first
+// client on this replica. Clients of deleted documents and clients over
+// the connection caps are refused.
+func (h *Hub) Register(client *Client) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.deleted[client.documentID]; ok {
+		return false, errDocumentDeleted
+	}
+	if h.maxPerDocument > 0 && len(h.clients[client.documentID]) >= h.maxPerDocument {
+		return false, errConnectionLimit
+	}
+	if h.maxPerIP > 0 && h.ips[client.ip] >= h.maxPerIP {
+		return false, errConnectionLimit
+	}
+	first := h.clients[client.documentID] == nil
+	if first {
 		h.clients[client.documentID] = make(map[string]*Client)
+		h.docs[client.documentID] = newDocState()
+		h.limiters[client.documentID] = newRateLimiter(h.documentLimit)
+		activeDocuments.Inc()
 	}
 	h.clients[client.documentID][client.clientID] = client
+	h.ips[client.ip]++
+	activeConnections.Inc()
+	return first, nil
 }
 
-func (h *Hub) Unregister(client *Client) {
+// FinishOpen records whether seeding the document's state succeeded and
+// releases the clients waiting in WaitOpen.
+func (h *Hub) FinishOpen(documentID string, err error) {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state != nil {
+		state.finishOpen(err)
+	}
+}
+
+// WaitOpen blocks until the document's first client has seeded its state
+// and returns the error that seeding ended with.
+func (h *Hub) WaitOpen(documentID string) error {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state == nil {
+		return nil
+	}
+	return state.waitOpen()
+}
+
+// Charge takes a message of size bytes from the document's rate limit on
+// behalf of client. When the limit has run out, the client that took the
+// most of the exhausted bucket since it last ran out is returned, so it,
+// and not whoever happened to send next, is disconnected; everyone's count
+// then starts over. Charge returns nil while the limit has room.
+func (h *Hub) Charge(client *Client, size int) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	client.sentMessages.Add(1)
+	client.sentBytes.Add(int64(size))
+	ok, bytes := h.limiters[client.documentID].take(size)
+	if ok {
+		return nil
+	}
+	culprit, most := client, int64(-1)
+	for _, c := range h.clients[client.documentID] {
+		used := c.sentMessages.Load()
+		if bytes {
+			used = c.sentBytes.Load()
+		}
+		if used > most {
+			culprit, most = c, used
+		}
+		c.sentMessages.Store(0)
+		c.sentBytes.Store(0)
+	}
+	return culprit
+}
+
+// MarkDeleted refuses new clients for the document and returns the ones
+// still connected.
+func (h *Hub) MarkDeleted(documentID string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deleted[documentID] = struct{}{}
+	clients := make([]*Client, 0, len(h.clients[documentID]))
+	for _, client := range h.clients[documentID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// MarkRestored lets clients join the document again.
+func (h *Hub) MarkRestored(documentID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.deleted, documentID)
+}
+
+func (h *Hub) IsDeleted(documentID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.deleted[documentID]
+	return ok
+}
+
+// Unregister removes the client. When it was the document's last local
+// client, the in-memory state is dropped and returned so it can be persisted.
+func (h *Hub) Unregister(client *Client) []byte {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if h.ips[client.ip]--; h.ips[client.ip] <= 0 {
+		delete(h.ips, client.ip)
+	}
+	activeConnections.Dec()
 	docClients := h.clients[client.documentID]
 	if docClients == nil {
-		return
+		return nil
 	}
 	delete(docClients, client.clientID)
-	if len(docClients) == 0 {
-		delete(h.clients, client.documentID)
+	if len(docClients) > 0 {
+		return nil
+	}
+	delete(h.clients, client.documentID)
+	delete(h.limiters, client.documentID)
+	activeDocuments.Dec()
+	state := h.docs[client.documentID]
+	delete(h.docs, client.documentID)
+	if state == nil || state.empty() {
+		return nil
+	}
+	return state.encode(nil)
+}
+
+// ApplyUpdate merges a Yjs update into the document's in-memory state. It is
+// a no-op for documents without local clients.
+func (h *Hub) ApplyUpdate(documentID string, update []byte) error {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state == nil {
+		return nil
+	}
+	return state.apply(update)
+}
+
+// ApplySnapshot merges a client's full document state into the document's
+// in-memory state and returns what it added that peers are missing, or nil
+// when nothing was new or the document has no local clients.
+func (h *Hub) ApplySnapshot(documentID string, snapshot []byte) ([]byte, error) {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state == nil {
+		return nil, nil
+	}
+	return state.applyNew(snapshot)
+}
+
+// DocumentState encodes the part of the document's merged Yjs state that a
+// peer at sv is missing (everything when sv is nil), or returns nil when
+// nothing is known about the document yet.
+func (h *Hub) DocumentState(documentID string, sv yjs.StateVector) []byte {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state == nil || state.empty() {
+		return nil
 	}
+	return state.encode(sv)
 }
 
-func (h *Hub) Broadcast(documentID string, payload []byte, senderID string) {
+// StateVector returns the state vector of the document's merged Yjs state.
+func (h *Hub) StateVector(documentID string) yjs.StateVector {
+	h.mu.RLock()
+	state := h.docs[documentID]
+	h.mu.RUnlock()
+	if state == nil {
+		return yjs.StateVector{}
+	}
+	return state.stateVector()
+}
+
+// Broadcast sends msg to every client of its document except senderID,
+// encoding it once per wire protocol in use.
+func (h *Hub) Broadcast(msg Message, senderID string) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	for clientID, client := range h.clients[documentID] {
+	frames := make(map[bool][]byte, 2)
+	for clientID, client := range h.clients[msg.DocumentID] {
 		if clientID == senderID {
 			continue
 		}
+		frame, ok := frames[client.binary]
+		if !ok {
+			frame = client.encode(msg)
+			frames[client.binary] = frame
+		}
+		if frame == nil {
+			continue
+		}
 		select {
-		case client.send <- payload:
+		case client.send <- frame:
+			messagesOut.WithLabelValues(msg.Type).Inc()
 		default:
-			log.Printf("dropping message for client %s", clientID)
+			h.overflow(client, msg)
 		}
 	}
 }
 
-func (h *Hub) ClientIDs(documentID string) []string {
+// overflow handles msg not fitting into the client's send buffer. Losing
+// other messages is survivable, but a client missing a Yjs update never
+// converges again, so it is disconnected to resync from scratch unless
+// the update can be coalesced.
+func (h *Hub) overflow(client *Client, msg Message) {
+	if msg.Type == messageUpdate && h.coalesce && client.holdBack(msg.Payload) {
+		return
+	}
+	dropped := client.dropped.Add(1)
+	messagesDropped.WithLabelValues(msg.Type).Inc()
+	if msg.Type != messageUpdate && msg.Type != messageSync {
+		log.Printf("dropping %s for client %s (%d dropped)", msg.Type, client.clientID, dropped)
+		return
+	}
+	client.disconnectSlow()
+}
+
+func (h *Hub) Clients(documentID string) []*Client {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	docClients := h.clients[documentID]
 	if docClients == nil {
 		return nil
 	}
-	ids := make([]string, 0, len(docClients))
-	for id := range docClients {
-		ids = append(ids, id)
+	clients := make([]*Client, 0, len(docClients))
+	for _, client := range docClients {
+		clients = append(clients, client)
 	}
-	return ids
+	return clients
 }
 
-func (c *Client) ReadPump(handle func(Message)) {
+// Send queues msg for the client without blocking and reports whether it
+// was queued. Messages the client's protocol cannot express are skipped.
+func (c *Client) Send(msg Message) bool {
+	frame := c.encode(msg)
+	if frame == nil {
+		return true
+	}
+	if !c.sendFrame(frame) {
+		c.dropped.Add(1)
+		messagesDropped.WithLabelValues(msg.Type).Inc()
+		return false
+	}
+	messagesOut.WithLabelValues(msg.Type).Inc()
+	return true
+}
+
+// holdBack queues an update for WritePump to merge and send once there is
+// room, and reports false when the backlog is full.
+func (c *Client) holdBack(payload string) bool {
+	update, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	c.backlogMu.Lock()
+	defer c.backlogMu.Unlock()
+	if c.backlogSize+len(update) > maxBacklogSize {
+		return false
+	}
+	c.backlog = append(c.backlog, update)
+	c.backlogSize += len(update)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// takeBacklog merges the held back updates into one update frame, or
+// returns nil when there are none.
+func (c *Client) takeBacklog() []byte {
+	c.backlogMu.Lock()
+	updates := c.backlog
+	c.backlog, c.backlogSize = nil, 0
+	c.backlogMu.Unlock()
+	if len(updates) == 0 {
+		return nil
+	}
+	merged, err := yjs.MergeUpdates(updates...)
+	if err != nil {
+		log.Printf("merging backlog for %s failed: %v", c.clientID, err)
+		c.disconnectSlow()
+		return nil
+	}
+	return c.encode(Message{
+		Type:       messageUpdate,
+		DocumentID: c.documentID,
+		Payload:    base64.StdEncoding.EncodeToString(merged),
+	})
+}
+
+// disconnectSlow closes the connection of a client that fell behind, once.
+func (c *Client) disconnectSlow() {
+	if !c.slow.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("disconnecting slow client %s on %s (%d dropped)", c.clientID, c.documentID, c.dropped.Load())
+	// Broadcast holds the hub lock; closing waits for the close frame.
+	go c.Close(closeSlowConsumer, "slow consumer")
+}
+
+func (c *Client) sendFrame(frame []byte) bool {
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) encode(msg Message) []byte {
+	if c.binary {
+		return encodeSyncFrame(msg)
+	}
+	return mustMarshal(msg)
+}
+
+// ReadPump decodes the client's messages for handle. Frames admit refuses
+// are dropped.
+func (c *Client) ReadPump(admit func(size int) bool, handle func(Message)) {
+	c.readFrames(func(data []byte) {
+		if !admit(len(data)) {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("invalid client message: %v", err)
+			return
+		}
+		msg.DocumentID = c.documentID
+		msg.ClientID = c.clientID
+		handle(msg)
+	})
+}
+
+func (c *Client) readFrames(handle func([]byte)) {
 	defer func() {
 		c.conn.Close()
 	}()
-	c.conn.SetReadLimit(1024 * 1024)
+	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -99,21 +499,26 @@ func (c *Client) ReadPump(handle func(Message)) {
 		if err != nil {
 			break
 		}
-		var msg Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			log.Printf("invalid client message: %v", err)
-			continue
-		}
-		msg.DocumentID = c.documentID
-		msg.ClientID = c.clientID
-		handle(msg)
+		handle(data)
 	}
 }
 
+// Close sends a close frame with code and reason and drops the connection,
+// which ends ReadPump.
+func (c *Client) Close(code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	_ = c.conn.Close()
+}
+
 func (c *Client) WritePump() {
 	defer c.conn.Close()
 	pingTicker := time.NewTicker(30 * time.Second)
 	defer pingTicker.Stop()
+	frameType := websocket.TextMessage
+	if c.binary {
+		frameType = websocket.BinaryMessage
+	}
 
 	for {
 		select {
@@ -122,9 +527,16 @@ func (c *Client) WritePump() {
 				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			if err := c.conn.WriteMessage(frameType, msg); err != nil {
 				return
 			}
+		case <-c.wake:
+			if frame := c.takeBacklog(); frame != nil {
+				messagesOut.WithLabelValues(messageUpdate).Inc()
+				if err := c.conn.WriteMessage(frameType, frame); err != nil {
+					return
+				}
+			}
 		case <-pingTicker.C:
 			if err := c.conn.WriteMessage(websocket.PingMessage, []byte("ping")); err != nil {
 				return
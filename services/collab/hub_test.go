@@ -0,0 +1,71 @@
+package collab
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"doclet/shared/yjs"
+)
+
+// TestCoalesceBacklog checks that updates which do not fit into a slow
+// client's send buffer are held back and sent as one merged update.
+func TestCoalesceBacklog(t *testing.T) {
+	h := NewHub()
+	h.setCoalesce(true)
+	const doc = "0d2b6f4a-7c1e-4e3b-8a9d-5f6c7b8e9a01"
+	client := &Client{
+		send:       make(chan []byte), // always full
+		documentID: doc,
+		clientID:   "slow",
+		wake:       make(chan struct{}, 1),
+	}
+	h.overflow(client, Message{Type: messageUpdate, DocumentID: doc, Payload: testUpdate(1, "one")})
+	h.overflow(client, Message{Type: messageUpdate, DocumentID: doc, Payload: testUpdate(2, "two")})
+	if client.slow.Load() || client.dropped.Load() != 0 {
+		t.Fatal("coalesced updates should not drop or disconnect the client")
+	}
+	select {
+	case <-client.wake:
+	default:
+		t.Fatal("holding back an update should wake WritePump")
+	}
+
+	frame := client.takeBacklog()
+	if frame == nil {
+		t.Fatal("no backlog frame")
+	}
+	var msg Message
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		t.Fatal(err)
+	}
+	update, err := base64.StdEncoding.DecodeString(msg.Payload)
+	if msg.Type != messageUpdate || err != nil {
+		t.Fatalf("backlog frame is %q: %v", msg.Type, err)
+	}
+	merged := yjs.NewDoc()
+	if err := merged.ApplyUpdate(update); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(merged.XmlFragment("default")); got != 2 {
+		t.Fatalf("merged update has %d paragraphs, want 2", got)
+	}
+	if client.takeBacklog() != nil {
+		t.Fatal("backlog not emptied")
+	}
+}
+
+func TestCoalesceBacklogBound(t *testing.T) {
+	client := &Client{wake: make(chan struct{}, 1)}
+	payload := testUpdate(1, "x")
+	if !client.holdBack(payload) {
+		t.Fatal("first update refused")
+	}
+	client.backlogSize = maxBacklogSize
+	if client.holdBack(payload) {
+		t.Fatal("update over maxBacklogSize held back")
+	}
+	if client.holdBack("not base64") {
+		t.Fatal("undecodable update held back")
+	}
+}
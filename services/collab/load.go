@@ -0,0 +1,91 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ErrDocumentNotFound is returned by a Loader for documents that do not
+// exist or are in the trash.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// Credentials are what a client joined with, passed on so the document
+// service can check them again.
+type Credentials struct {
+	Token  string
+	Ticket string
+}
+
+// Loader fetches the persisted Yjs state of a document, its content with
+// the update log merged in. Rooms are seeded with it when their first
+// client joins a replica.
+type Loader interface {
+	Load(ctx context.Context, documentID string, creds Credentials) ([]byte, error)
+}
+
+type LoaderFunc func(ctx context.Context, documentID string, creds Credentials) ([]byte, error)
+
+func (f LoaderFunc) Load(ctx context.Context, documentID string, creds Credentials) ([]byte, error) {
+	return f(ctx, documentID, creds)
+}
+
+// remoteLoader asks the document service's state endpoint.
+type remoteLoader struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRemoteLoader loads document state from the document service at
+// baseURL.
+func NewRemoteLoader(baseURL string) Loader {
+	return &remoteLoader{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (l *remoteLoader) Load(ctx context.Context, documentID string, creds Credentials) ([]byte, error) {
+	endpoint := l.baseURL + "/documents/" + url.PathEscape(documentID) + "/state"
+	if creds.Ticket != "" {
+		endpoint += "?" + url.Values{"ticket": {creds.Ticket}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusNotFound:
+		return nil, ErrDocumentNotFound
+	default:
+		return nil, fmt.Errorf("document service returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// credentials returns the token or ticket the request authenticated with.
+func credentials(r *http.Request) Credentials {
+	return Credentials{
+		Token:  r.URL.Query().Get("token"),
+		Ticket: r.URL.Query().Get("ticket"),
+	}
+}
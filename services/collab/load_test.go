@@ -0,0 +1,89 @@
+package collab
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"doclet/shared/yjs"
+	"github.com/gorilla/websocket"
+)
+
+const loadDocument = "9b3e1d6c-2f4a-4c8e-8a1b-5d7e6f0a9c21"
+
+// next returns the next message of type typ, skipping others.
+func (c *testClient) next(t *testing.T, typ string) Message {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				t.Fatalf("connection closed waiting for %s", typ)
+			}
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no %s message", typ)
+		}
+	}
+}
+
+func TestJoinLoadsState(t *testing.T) {
+	stored, _ := base64.StdEncoding.DecodeString(testUpdate(7, "stored"))
+	var loads atomic.Int32
+	ts := startServerWithLoader(t, nil, LoaderFunc(func(_ context.Context, documentID string, creds Credentials) ([]byte, error) {
+		loads.Add(1)
+		if documentID != loadDocument {
+			t.Errorf("loaded %s, want %s", documentID, loadDocument)
+		}
+		time.Sleep(100 * time.Millisecond)
+		return stored, nil
+	}))
+
+	// The upgrade completes before the state is loaded, so bob joins while
+	// alice's join is still loading.
+	for _, c := range []*testClient{dial(t, ts, loadDocument, "alice"), dial(t, ts, loadDocument, "bob")} {
+		msg := c.next(t, messageSync)
+		state, _ := base64.StdEncoding.DecodeString(msg.Payload)
+		doc := yjs.NewDoc()
+		if err := doc.ApplyUpdate(state); err != nil {
+			t.Fatal(err)
+		}
+		nodes := doc.XmlFragment("default")
+		if len(nodes) != 1 || nodes[0].Children[0].Runs[0].Text != "stored" {
+			t.Fatalf("initial sync = %#v, want the stored paragraph", nodes)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("state loaded %d times, want once", n)
+	}
+}
+
+func TestJoinFailsWhenLoadFails(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	ts := startServerWithLoader(t, nil, LoaderFunc(func(context.Context, string, Credentials) ([]byte, error) {
+		if fail.Load() {
+			return nil, errors.New("document service down")
+		}
+		return nil, nil
+	}))
+
+	c := dial(t, ts, loadDocument, "alice")
+	for range c.messages {
+	}
+	_, _, err := c.conn.ReadMessage()
+	if !websocket.IsCloseError(err, closeUnavailable) {
+		t.Fatalf("read error = %v, want close %d", err, closeUnavailable)
+	}
+
+	// The failed room is dropped, so the next client loads again.
+	fail.Store(false)
+	c = dial(t, ts, loadDocument, "alice")
+	c.next(t, messageUserName)
+}
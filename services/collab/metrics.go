@@ -0,0 +1,40 @@
+package collab
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	activeDocuments = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "doclet_collab_active_documents",
+		Help: "Documents with at least one client connected to this replica.",
+	})
+	activeConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "doclet_collab_active_connections",
+		Help: "Clients connected to this replica.",
+	})
+	messagesIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doclet_collab_messages_received_total",
+		Help: "Messages received from clients, by type.",
+	}, []string{"type"})
+	messagesOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doclet_collab_messages_sent_total",
+		Help: "Messages queued for clients, by type.",
+	}, []string{"type"})
+	messagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doclet_collab_messages_dropped_total",
+		Help: "Messages that did not fit into a client's send buffer, by type.",
+	}, []string{"type"})
+)
+
+// receivedType maps the type of a client message to a label value.
+// Clients choose what they send, so types they may not send share one
+// label.
+func receivedType(t string) string {
+	switch t {
+	case messageUpdate, messageSnapshot, messagePresence:
+		return t
+	}
+	return "unknown"
+}
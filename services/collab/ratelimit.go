@@ -0,0 +1,60 @@
+package collab
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is a pair of token buckets, one counting messages and one
+// counting bytes. A zero rate disables that bucket.
+type RateLimit struct {
+	Messages     float64
+	MessageBurst int
+	Bytes        float64
+	ByteBurst    int
+}
+
+type rateLimiter struct {
+	messages *rate.Limiter
+	bytes    *rate.Limiter
+}
+
+// newRateLimiter returns nil when l limits nothing; a nil limiter allows
+// everything.
+func newRateLimiter(l RateLimit) *rateLimiter {
+	var limiter rateLimiter
+	if l.Messages > 0 {
+		limiter.messages = rate.NewLimiter(rate.Limit(l.Messages), max(l.MessageBurst, 1))
+	}
+	if l.Bytes > 0 {
+		// A single message of the largest size must always be able to pass.
+		limiter.bytes = rate.NewLimiter(rate.Limit(l.Bytes), max(l.ByteBurst, maxMessageSize))
+	}
+	if limiter.messages == nil && limiter.bytes == nil {
+		return nil
+	}
+	return &limiter
+}
+
+// allow takes one message of size bytes from the buckets and reports
+// whether both had room.
+func (l *rateLimiter) allow(size int) bool {
+	ok, _ := l.take(size)
+	return ok
+}
+
+// take is allow that also reports, when a bucket ran out, whether it was
+// the byte bucket, so a shared limit can be charged to whoever drained it.
+func (l *rateLimiter) take(size int) (ok, bytes bool) {
+	if l == nil {
+		return true, false
+	}
+	if l.messages != nil && !l.messages.Allow() {
+		return false, false
+	}
+	if l.bytes != nil && !l.bytes.AllowN(time.Now(), size) {
+		return false, true
+	}
+	return true, false
+}
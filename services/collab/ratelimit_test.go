@@ -0,0 +1,143 @@
+package collab
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"doclet/shared/broker"
+	"github.com/gorilla/websocket"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if l := newRateLimiter(RateLimit{}); l != nil || !l.allow(maxMessageSize) {
+		t.Fatal("zero limit should be nil and allow everything")
+	}
+
+	messages := newRateLimiter(RateLimit{Messages: 0.001, MessageBurst: 2})
+	for i := range 2 {
+		if !messages.allow(1) {
+			t.Fatalf("message %d within the burst refused", i)
+		}
+	}
+	if messages.allow(1) {
+		t.Fatal("message over the burst allowed")
+	}
+
+	bytes := newRateLimiter(RateLimit{Bytes: 0.001, ByteBurst: 10})
+	if !bytes.allow(maxMessageSize) {
+		t.Fatal("a message of the largest size must pass an idle byte bucket")
+	}
+	if bytes.allow(1) {
+		t.Fatal("byte over the burst allowed")
+	}
+}
+
+// dialRaw connects to ts without the reading goroutine of dial, so the
+// test sees the close frame.
+func dialRaw(t *testing.T, ts *httptest.Server, documentID, clientID string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?" + url.Values{
+		"document_id": {documentID},
+		"client_id":   {clientID},
+	}.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// closeCode reads from conn until it is closed and returns the close code.
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				return ce.Code
+			}
+			t.Fatalf("read: %v", err)
+		}
+	}
+}
+
+func TestRateLimitedClientsAreClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"client", Config{ClientLimit: RateLimit{Messages: 0.001, MessageBurst: 2}}},
+		{"document", Config{DocumentLimit: RateLimit{Messages: 0.001, MessageBurst: 2}}},
+	}
+	const doc = "6b7f3c1e-2d4a-4c8e-9f1b-3a5d7e9c1b2f"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SnapshotDelay, tt.cfg.SnapshotMaxWait, tt.cfg.SuggestionDelay = time.Hour, time.Hour, time.Hour
+			s := NewServer(NewHub(), broker.NewMemory(), nil, nil, tt.cfg)
+			if err := s.Subscribe(); err != nil {
+				t.Fatalf("subscribe: %v", err)
+			}
+			ts := httptest.NewServer(s.Router())
+			t.Cleanup(ts.Close)
+
+			conn := dialRaw(t, ts, doc, "alice")
+			for i := range 3 {
+				msg := Message{Type: messageUpdate, DocumentID: doc, ClientID: "alice", Payload: testUpdate(1, string(rune('a'+i)))}
+				if err := conn.WriteJSON(msg); err != nil {
+					t.Fatalf("send: %v", err)
+				}
+			}
+			if code := closeCode(t, conn); code != closeRateLimited {
+				t.Fatalf("close code %d, want %d", code, closeRateLimited)
+			}
+		})
+	}
+}
+
+// TestDocumentLimitClosesFlooder checks that when one client drains the
+// document's limit, it is disconnected rather than the next client to
+// send.
+func TestDocumentLimitClosesFlooder(t *testing.T) {
+	s := NewServer(NewHub(), nil, nil, nil, Config{
+		DocumentLimit:   RateLimit{Messages: 0.001, MessageBurst: 5},
+		SnapshotDelay:   time.Hour,
+		SnapshotMaxWait: time.Hour,
+		SuggestionDelay: time.Hour,
+	})
+	ts := httptest.NewServer(s.Router())
+	t.Cleanup(ts.Close)
+	const doc = "2c8e4a6f-1b3d-4e5f-a7b9-0d1e2f3a4b5c"
+
+	bob := dialRaw(t, ts, doc, "bob")
+	flooder := dialRaw(t, ts, doc, "flooder")
+	for i := range 5 {
+		msg := Message{Type: messageUpdate, DocumentID: doc, ClientID: "flooder", Payload: testUpdate(1, string(rune('a'+i)))}
+		if err := flooder.WriteJSON(msg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	// Let the server take the flooder's frames before bob's.
+	time.Sleep(100 * time.Millisecond)
+	if err := bob.WriteJSON(Message{Type: messageUpdate, DocumentID: doc, ClientID: "bob", Payload: testUpdate(2, "bob")}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if code := closeCode(t, flooder); code != closeRateLimited {
+		t.Fatalf("flooder close code %d, want %d", code, closeRateLimited)
+	}
+	bob.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	for {
+		_, _, err := bob.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if _, closed := err.(*websocket.CloseError); closed {
+			t.Fatalf("bob was disconnected: %v", err)
+		}
+		break
+	}
+}
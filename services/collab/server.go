@@ -1,29 +1,104 @@
 package collab
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"hash/fnv"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"doclet/shared/access"
+	"doclet/shared/broker"
+	"doclet/shared/metrics"
+	"doclet/shared/ticket"
+	"doclet/shared/yjs"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	messageUpdate   = "yjs_update"
 	messageSnapshot = "yjs_snapshot"
+	messageSync     = "yjs_sync"
 	messagePresence = "presence"
 	messageUserName = "user_name"
+	messageError    = "error"
+	// messageTags and comment_* messages are relayed from the document
+	// service to clients.
+	messageTags          = "tags"
+	messageCommentPrefix = "comment_"
+	// Updates from suggesting clients are published as a suggestion
+	// message for the document service, which answers with suggestion_*
+	// messages.
+	messageSuggestion       = "suggestion"
+	messageSuggestionPrefix = "suggestion_"
 )
 
+// Values of the /ws mode query parameter: modeReadOnly connections only
+// watch, and the edits of modeSuggest connections become suggestions.
+const (
+	modeReadOnly = "readonly"
+	modeSuggest  = "suggest"
+)
+
+// WebSocket close codes. closeDocumentDeleted is sent to clients of a
+// document that was moved to the trash, closeSlowConsumer to clients that
+// could not keep up with updates, closeRateLimited to clients that send
+// more than their or their document's rate limit allows, and
+// closeConnectionLimit to connections over the per-document or per-IP cap
+// and closeUnavailable when the document's state could not be loaded.
+const (
+	closeSlowConsumer    = 4408
+	closeDocumentDeleted = 4410
+	closeRateLimited     = 4429
+	closeConnectionLimit = 4430
+	closeUnavailable     = 4503
+)
+
+var tracer = otel.Tracer("doclet/services/collab")
+
 type Server struct {
-	hub    *Hub
-	broker *NatsBroker
+	hub          *Hub
+	broker       broker.Broker
+	auth         Authorizer
+	loader       Loader
+	ticketKey    []byte
+	replicaID    string
+	clientLimit  RateLimit
+	snapshots    *snapshotScheduler
+	suggestions  *suggestionBuffer
+	replayWindow time.Duration
 }
 
-func NewServer(hub *Hub, broker *NatsBroker) *Server {
-	return &Server{hub: hub, broker: broker}
+// NewServer creates the collab server. Connections are checked against
+// session tickets when cfg.TicketKey is set and with auth otherwise; a nil
+// Authorizer lets every connection edit. Rooms are seeded from loader; with
+// a nil Loader they start out empty.
+func NewServer(hub *Hub, b broker.Broker, auth Authorizer, loader Loader, cfg Config) *Server {
+	s := &Server{
+		hub:          hub,
+		broker:       b,
+		auth:         auth,
+		loader:       loader,
+		ticketKey:    []byte(cfg.TicketKey),
+		replicaID:    uuid.NewString(),
+		clientLimit:  cfg.ClientLimit,
+		replayWindow: cfg.ReplayWindow,
+	}
+	hub.setLimits(cfg.DocumentLimit, cfg.MaxConnectionsPerDocument, cfg.MaxConnectionsPerIP)
+	hub.setCoalesce(cfg.CoalesceUpdates)
+	s.snapshots = newSnapshotScheduler(cfg.SnapshotDelay, cfg.SnapshotMaxWait, s.publishSnapshot)
+	s.suggestions = newSuggestionBuffer(cfg.SuggestionDelay, s.publishSuggestion)
+	return s
 }
 
 func (s *Server) Router() http.Handler {
@@ -31,7 +106,9 @@ func (s *Server) Router() http.Handler {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/ws", s.handleWebsocket)
+	mux.HandleFunc("/yjs/", s.handleSyncWebsocket)
 	return logRequests(mux)
 }
 
@@ -42,6 +119,18 @@ func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing document_id or client_id", http.StatusBadRequest)
 		return
 	}
+	grant, _, ok := s.authorize(w, r, documentID, clientID)
+	if !ok {
+		return
+	}
+	readOnly, suggesting, ok := connectionMode(w, r, grant.Role)
+	if !ok {
+		return
+	}
+	if s.hub.IsDeleted(documentID) {
+		http.Error(w, "document deleted", http.StatusGone)
+		return
+	}
 
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(*http.Request) bool { return true },
@@ -57,96 +146,464 @@ func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
 		send:       make(chan []byte, 256),
 		documentID: documentID,
 		clientID:   clientID,
+		authorID:   grant.AuthorID,
+		ip:         remoteIP(r),
+		role:       grant.Role,
+		readOnly:   readOnly,
+		suggesting: suggesting,
+		limiter:    newRateLimiter(s.clientLimit),
+		wake:       make(chan struct{}, 1),
 	}
 
-	s.hub.Register(client)
+	if err := s.join(client, credentials(r)); err != nil {
+		s.refuse(client, err)
+		return
+	}
 	log.Printf("client %s joined %s", clientID, documentID)
 
 	go client.WritePump()
-	s.sendUserNameToClient(client, client.clientID)
-	for _, otherID := range s.hub.ClientIDs(documentID) {
-		if otherID == client.clientID {
+	s.sendDocumentState(client)
+	s.sendUserNameToClient(client, client)
+	for _, other := range s.hub.Clients(documentID) {
+		if other.clientID == client.clientID {
 			continue
 		}
-		s.sendUserNameToClient(client, otherID)
+		s.sendUserNameToClient(client, other)
 	}
 	s.broadcastUserName(client)
-	client.ReadPump(func(msg Message) {
+	client.ReadPump(func(size int) bool {
+		return s.admit(client, size)
+	}, func(msg Message) {
 		s.handleClientMessage(client, msg)
 	})
 
-	s.hub.Unregister(client)
-	close(client.send)
-	log.Printf("client %s left %s", clientID, documentID)
+	s.leave(client)
+	log.Printf("client %s left %s (%d dropped)", clientID, documentID, client.dropped.Load())
 }
 
 func (s *Server) handleClientMessage(client *Client, msg Message) {
+	messagesIn.WithLabelValues(receivedType(msg.Type)).Inc()
+	ctx, span := tracer.Start(context.Background(), "collab.handleClientMessage", trace.WithAttributes(
+		attribute.String("doclet.document_id", client.documentID),
+		attribute.String("doclet.client_id", client.clientID),
+		attribute.String("doclet.message_type", receivedType(msg.Type)),
+	))
+	defer span.End()
+	if (msg.Type == messageUpdate || msg.Type == messageSnapshot) && client.readOnly {
+		log.Printf("rejecting %s from read-only client %s", msg.Type, msg.ClientID)
+		if !client.Send(Message{
+			Type:       messageError,
+			DocumentID: client.documentID,
+			ClientID:   client.clientID,
+			Payload:    "read_only",
+		}) {
+			log.Printf("error send dropped for %s", client.clientID)
+		}
+		return
+	}
+	if client.suggesting && (msg.Type == messageUpdate || msg.Type == messageSnapshot) {
+		s.suggestUpdate(client, msg)
+		return
+	}
 	switch msg.Type {
 	case messageUpdate:
-		if payload := mustMarshal(msg); payload != nil {
-			s.hub.Broadcast(msg.DocumentID, payload, msg.ClientID)
-		}
-		if s.broker != nil {
-			s.broker.Publish(SubjectForDocument(msg.DocumentID, "updates"), msg)
+		if err := s.applyUpdate(msg); err != nil {
+			log.Printf("invalid yjs update from %s: %v", msg.ClientID, err)
+			return
 		}
+		s.snapshots.schedule(msg.DocumentID)
+		s.hub.Broadcast(msg, msg.ClientID)
+		s.publish(ctx, SubjectForDocument(msg.DocumentID, "updates"), msg)
 	case messagePresence:
-		if payload := mustMarshal(msg); payload != nil {
-			s.hub.Broadcast(msg.DocumentID, payload, msg.ClientID)
+		msg.ReadOnly = client.readOnly
+		s.hub.Broadcast(msg, msg.ClientID)
+		s.publish(ctx, SubjectForDocument(msg.DocumentID, "presence"), msg)
+	case messageSnapshot:
+		// Client snapshots only seed the merged state; what gets persisted
+		// is always computed here. A client that reconnects with offline
+		// edits carries them in its snapshot, so whatever it adds goes to
+		// peers as an update.
+		snapshot, err := base64.StdEncoding.DecodeString(msg.Payload)
+		if err != nil {
+			log.Printf("invalid yjs snapshot from %s: %v", msg.ClientID, err)
+			return
 		}
-		if s.broker != nil {
-			s.broker.Publish(SubjectForDocument(msg.DocumentID, "presence"), msg)
+		added, err := s.hub.ApplySnapshot(msg.DocumentID, snapshot)
+		if err != nil {
+			log.Printf("invalid yjs snapshot from %s: %v", msg.ClientID, err)
+			return
 		}
-	case messageSnapshot:
-		if s.broker != nil {
-			s.broker.Publish(SubjectForDocument(msg.DocumentID, "snapshots"), msg)
+		s.snapshots.schedule(msg.DocumentID)
+		if added == nil {
+			return
 		}
+		update := Message{
+			Type:       messageUpdate,
+			DocumentID: msg.DocumentID,
+			ClientID:   msg.ClientID,
+			Payload:    base64.StdEncoding.EncodeToString(added),
+		}
+		s.hub.Broadcast(update, msg.ClientID)
+		s.publish(ctx, SubjectForDocument(msg.DocumentID, "updates"), update)
 	default:
 		log.Printf("unknown message type: %s", msg.Type)
 	}
 }
 
-func (s *Server) sendUserName(client *Client) {
-	s.sendUserNameToClient(client, client.clientID)
+// authorize resolves what the connection is granted, answering with an
+// HTTP error when it has nothing. With a ticket key the ticket query
+// parameter must hold a ticket for this document, and for clientID unless
+// it is empty; the client ID the connection may use is returned. Otherwise
+// the token query parameter is checked with the Authorizer.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, documentID, clientID string) (Grant, string, bool) {
+	if len(s.ticketKey) > 0 {
+		raw := r.URL.Query().Get("ticket")
+		if raw == "" {
+			http.Error(w, "missing ticket", http.StatusUnauthorized)
+			return Grant{}, "", false
+		}
+		t, err := ticket.Verify(s.ticketKey, raw, time.Now())
+		if err == nil && (t.DocumentID != documentID || (clientID != "" && t.ClientID != clientID)) {
+			err = ticket.ErrInvalid
+		}
+		if err != nil {
+			log.Printf("rejecting ticket for %s: %v", documentID, err)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return Grant{}, "", false
+		}
+		return Grant{Role: t.Role, AuthorID: t.AuthorID}, t.ClientID, true
+	}
+	if s.auth == nil {
+		// Without an Authorizer every connection is trusted, and so is the
+		// client ID it picks.
+		return Grant{Role: access.RoleEditor, AuthorID: clientID}, clientID, true
+	}
+	// The document service also knows whether the document is in the
+	// trash, which this replica may have missed while it was down or
+	// disconnected from the broker.
+	grant, err := s.auth.Authorize(r.Context(), documentID, r.URL.Query().Get("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDocumentNotFound):
+			s.disconnectDeleted(documentID, s.hub.Clients(documentID))
+			http.Error(w, "document not found", http.StatusNotFound)
+		case errors.Is(err, access.ErrDenied):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			log.Printf("authorize %s failed: %v", documentID, err)
+			http.Error(w, "authorization unavailable", http.StatusServiceUnavailable)
+		}
+		return Grant{}, "", false
+	}
+	if s.hub.IsDeleted(documentID) {
+		s.hub.MarkRestored(documentID)
+	}
+	return grant, clientID, true
 }
 
-func (s *Server) sendUserNameToClient(client *Client, targetID string) {
-	payload, err := json.Marshal(userNameMessage(client.documentID, targetID))
+// connectionMode reports whether the connection is read-only, either
+// because it asked for mode=readonly or because its role cannot edit, and
+// whether it asked to suggest edits, which commenters may do too.
+func connectionMode(w http.ResponseWriter, r *http.Request, role access.Role) (readOnly, suggesting, ok bool) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "":
+		return !role.CanEdit(), false, true
+	case modeReadOnly:
+		return true, false, true
+	case modeSuggest:
+		if !role.Allows(access.RoleCommenter) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return false, false, false
+		}
+		return false, true, true
+	default:
+		http.Error(w, "unknown mode", http.StatusBadRequest)
+		return false, false, false
+	}
+}
+
+// suggestUpdate buffers an update from a suggesting client instead of
+// applying it. Snapshots of a suggesting client hold its suggestions too,
+// so they are dropped.
+func (s *Server) suggestUpdate(client *Client, msg Message) {
+	if msg.Type == messageSnapshot {
+		return
+	}
+	update, err := base64.StdEncoding.DecodeString(msg.Payload)
+	if err == nil {
+		_, err = yjs.DecodeUpdate(update)
+	}
 	if err != nil {
-		log.Printf("user_name marshal error: %v", err)
+		log.Printf("invalid yjs suggestion from %s: %v", msg.ClientID, err)
 		return
 	}
-	select {
-	case client.send <- payload:
-	default:
-		log.Printf("user_name send dropped for %s", client.clientID)
+	s.suggestions.add(client, update)
+}
+
+// publishSuggestion hands a suggesting client's merged updates to the
+// document service, which stores them as a pending suggestion.
+func (s *Server) publishSuggestion(client *Client, update []byte) {
+	s.publish(context.Background(), SubjectForDocument(client.documentID, "suggest"), Message{
+		Type:       messageSuggestion,
+		DocumentID: client.documentID,
+		ClientID:   client.clientID,
+		AuthorID:   client.authorID,
+		Payload:    base64.StdEncoding.EncodeToString(update),
+	})
+}
+
+// join registers the client. The document's first client on this replica
+// seeds its state from the document service and the updates JetStream
+// retained; clients joining meanwhile wait for that, and all of them are
+// turned away when it fails.
+func (s *Server) join(client *Client, creds Credentials) error {
+	first, err := s.hub.Register(client)
+	if err != nil {
+		return err
+	}
+	if first {
+		s.hub.FinishOpen(client.documentID, s.loadState(client.documentID, creds))
+	}
+	if err := s.hub.WaitOpen(client.documentID); err != nil {
+		s.hub.Unregister(client)
+		return err
 	}
+	return nil
 }
 
-func (s *Server) broadcastUserName(client *Client) {
-	payload := mustMarshal(userNameMessage(client.documentID, client.clientID))
-	if payload == nil {
+// loadState seeds a newly opened document with its persisted state and
+// replays the updates published since.
+func (s *Server) loadState(documentID string, creds Credentials) error {
+	if s.loader != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		state, err := s.loader.Load(ctx, documentID, creds)
+		cancel()
+		if err == nil && len(state) > 0 {
+			err = s.hub.ApplyUpdate(documentID, state)
+		}
+		if errors.Is(err, ErrDocumentNotFound) {
+			return errDocumentDeleted
+		}
+		if err != nil {
+			log.Printf("loading state of %s failed: %v", documentID, err)
+			return errDocumentUnavailable
+		}
+	}
+	s.replayUpdates(documentID)
+	return nil
+}
+
+// refuse closes a connection join turned away.
+func (s *Server) refuse(client *Client, err error) {
+	code := closeDocumentDeleted
+	switch {
+	case errors.Is(err, errConnectionLimit):
+		log.Printf("refusing client %s on %s from %s: %v", client.clientID, client.documentID, client.ip, err)
+		code = closeConnectionLimit
+	case errors.Is(err, errDocumentUnavailable):
+		code = closeUnavailable
+	}
+	client.Close(code, err.Error())
+}
+
+// admit checks a frame of size bytes against the client's and the
+// document's rate limits. Dropping an update would leave the client out of
+// sync, so a client over its own limit is disconnected; it resyncs when it
+// reconnects. When the document's limit runs out, the client that used most
+// of it is disconnected instead, and the frame that found it empty is let
+// through unless it came from that client.
+func (s *Server) admit(client *Client, size int) bool {
+	if client.limited.Load() {
+		// Frames read before the connection closed.
+		return false
+	}
+	if !client.limiter.allow(size) {
+		s.closeLimited(client, "rate limited")
+		return false
+	}
+	if culprit := s.hub.Charge(client, size); culprit != nil {
+		s.closeLimited(culprit, "document rate limited")
+		return culprit != client
+	}
+	return true
+}
+
+// closeLimited disconnects a client over a rate limit, once.
+func (s *Server) closeLimited(client *Client, reason string) {
+	if !client.limited.CompareAndSwap(false, true) {
 		return
 	}
-	s.hub.Broadcast(client.documentID, payload, client.clientID)
+	log.Printf("closing client %s on %s: %s", client.clientID, client.documentID, reason)
+	client.Close(closeRateLimited, reason)
 }
 
-func (s *Server) SubscribeNATS() error {
+// remoteIP returns the host part of the request's remote address.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// publish stamps msg with this replica's ID so Subscribe can skip it when
+// it comes back; local peers have already received it via Hub.Broadcast.
+func (s *Server) publish(ctx context.Context, subject string, msg Message) {
+	if s.broker == nil {
+		return
+	}
+	msg.Origin = s.replicaID
+	publishMessage(ctx, s.broker, subject, msg)
+}
+
+// leave unregisters the client and, if it was the last one on this replica,
+// persists any edits the debounced snapshot has not picked up yet unless
+// the document was deleted. Buffered suggestions are sent off first.
+func (s *Server) leave(client *Client) {
+	s.suggestions.done(client)
+	final := s.hub.Unregister(client)
+	close(client.send)
+	if final == nil {
+		return
+	}
+	if s.snapshots.cancel(client.documentID) && !s.hub.IsDeleted(client.documentID) {
+		s.sendSnapshot(client.documentID, final)
+	}
+}
+
+// replayUpdates seeds a newly opened document with the updates JetStream
+// retained for it, so edits made while this replica was not listening are
+// part of the initial sync.
+func (s *Server) replayUpdates(documentID string) {
+	if s.broker == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	since := time.Now().Add(-s.replayWindow)
+	if err := replayMessages(ctx, s.broker, SubjectForDocument(documentID, "updates"), since, func(msg Message) {
+		if err := s.applyUpdate(msg); err != nil {
+			log.Printf("invalid replayed yjs update for %s: %v", documentID, err)
+		}
+	}); err != nil {
+		log.Printf("replay failed for %s: %v", documentID, err)
+	}
+}
+
+func (s *Server) publishSnapshot(documentID string) {
+	state := s.hub.DocumentState(documentID, nil)
+	if state == nil {
+		return
+	}
+	s.sendSnapshot(documentID, state)
+}
+
+func (s *Server) sendSnapshot(documentID string, state []byte) {
+	s.publish(context.Background(), SubjectForDocument(documentID, "snapshots"), Message{
+		Type:       messageSnapshot,
+		DocumentID: documentID,
+		Payload:    base64.StdEncoding.EncodeToString(state),
+	})
+}
+
+func (s *Server) applyUpdate(msg Message) error {
+	update, err := base64.StdEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		return err
+	}
+	return s.hub.ApplyUpdate(msg.DocumentID, update)
+}
+
+// sendDocumentState gives a joining client the merged state of everything
+// peers have sent so far, so it does not have to wait for the next edit.
+func (s *Server) sendDocumentState(client *Client) {
+	state := s.hub.DocumentState(client.documentID, nil)
+	if state == nil {
+		return
+	}
+	if !client.Send(Message{
+		Type:       messageSync,
+		DocumentID: client.documentID,
+		Payload:    base64.StdEncoding.EncodeToString(state),
+	}) {
+		log.Printf("yjs_sync send dropped for %s", client.clientID)
+	}
+}
+
+func (s *Server) sendUserName(client *Client) {
+	s.sendUserNameToClient(client, client)
+}
+
+func (s *Server) sendUserNameToClient(client, target *Client) {
+	if !client.Send(userNameMessage(target)) {
+		log.Printf("user_name send dropped for %s", client.clientID)
+	}
+}
+
+func (s *Server) broadcastUserName(client *Client) {
+	s.hub.Broadcast(userNameMessage(client), client.clientID)
+}
+
+// Subscribe relays updates and presence published by other replicas to
+// local clients, follows documents being deleted and restored, and passes
+// on tag, comment and suggestion changes.
+func (s *Server) Subscribe() error {
 	if s.broker == nil {
 		return nil
 	}
 
-	if _, err := s.broker.Subscribe("doclet.documents.*.updates", func(msg Message) {
-		if payload := mustMarshal(msg); payload != nil {
-			s.hub.Broadcast(msg.DocumentID, payload, msg.ClientID)
+	if err := subscribeMessages(s.broker, "doclet.documents.*.updates", func(msg Message) {
+		if msg.Origin == s.replicaID {
+			return
+		}
+		if err := s.applyUpdate(msg); err != nil {
+			log.Printf("invalid remote yjs update for %s: %v", msg.DocumentID, err)
+			return
 		}
+		s.handleRemoteMessage(msg)
+	}); err != nil {
+		return err
+	}
+
+	if err := subscribeMessages(s.broker, "doclet.documents.*.presence", s.handleRemoteMessage); err != nil {
+		return err
+	}
+
+	if err := subscribeMessages(s.broker, "doclet.documents.*.deleted", s.handleDocumentDeleted); err != nil {
+		return err
+	}
+
+	if err := subscribeMessages(s.broker, "doclet.documents.*.restored", func(msg Message) {
+		s.hub.MarkRestored(msg.DocumentID)
 	}); err != nil {
 		return err
 	}
 
-	if _, err := s.broker.Subscribe("doclet.documents.*.presence", func(msg Message) {
-		if payload := mustMarshal(msg); payload != nil {
-			s.hub.Broadcast(msg.DocumentID, payload, msg.ClientID)
+	// The document service publishes tag, comment and suggestion changes
+	// once; every replica passes them on to its own clients.
+	if err := subscribeMessages(s.broker, "doclet.documents.*.tags", func(msg Message) {
+		if msg.Type != messageTags {
+			return
 		}
+		s.hub.Broadcast(msg, "")
+	}); err != nil {
+		return err
+	}
+
+	if err := subscribeMessages(s.broker, "doclet.documents.*.comments", func(msg Message) {
+		if !strings.HasPrefix(msg.Type, messageCommentPrefix) {
+			return
+		}
+		s.hub.Broadcast(msg, "")
+	}); err != nil {
+		return err
+	}
+
+	if err := subscribeMessages(s.broker, "doclet.documents.*.suggestions", func(msg Message) {
+		if !strings.HasPrefix(msg.Type, messageSuggestionPrefix) {
+			return
+		}
+		s.hub.Broadcast(msg, "")
 	}); err != nil {
 		return err
 	}
@@ -154,6 +611,31 @@ func (s *Server) SubscribeNATS() error {
 	return nil
 }
 
+// handleDocumentDeleted disconnects the clients of a document moved to the
+// trash and drops edits not yet persisted, since the document service would
+// refuse them.
+func (s *Server) handleDocumentDeleted(msg Message) {
+	s.disconnectDeleted(msg.DocumentID, s.hub.MarkDeleted(msg.DocumentID))
+}
+
+func (s *Server) disconnectDeleted(documentID string, clients []*Client) {
+	s.snapshots.cancel(documentID)
+	for _, client := range clients {
+		client.Close(closeDocumentDeleted, "document deleted")
+	}
+	if len(clients) > 0 {
+		log.Printf("disconnected %d clients from deleted document %s", len(clients), documentID)
+	}
+}
+
+func (s *Server) handleRemoteMessage(msg Message) {
+	if msg.Origin == s.replicaID {
+		return
+	}
+	msg.Origin = ""
+	s.hub.Broadcast(msg, msg.ClientID)
+}
+
 func mustMarshal(msg Message) []byte {
 	payload, err := json.Marshal(msg)
 	if err != nil {
@@ -181,19 +663,27 @@ func nameForClient(clientID string) string {
 	return adj + " " + noun
 }
 
-func userNameMessage(documentID, clientID string) Message {
+func userNameMessage(client *Client) Message {
 	return Message{
 		Type:       messageUserName,
-		DocumentID: documentID,
-		ClientID:   clientID,
-		Payload:    nameForClient(clientID),
+		DocumentID: client.documentID,
+		ClientID:   client.clientID,
+		Payload:    nameForClient(client.clientID),
+		ReadOnly:   client.readOnly,
 	}
 }
 
 func logRequests(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 && websocket.IsWebSocketUpgrade(r) {
+			// Upgraded connections are hijacked before a status is recorded.
+			status = http.StatusSwitchingProtocols
+		}
+		metrics.ObserveRequest("collab", r.Method, r.Pattern, status, time.Since(start))
 		log.Printf("collab %s %s %s", r.Method, r.URL.Path, time.Since(start))
 	})
 }
@@ -0,0 +1,187 @@
+package collab
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"doclet/shared/broker"
+	"doclet/shared/yjs"
+	"github.com/gorilla/websocket"
+)
+
+// testUpdate returns an update inserting a paragraph with text, created by
+// client.
+func testUpdate(client uint64, text string) string {
+	update := yjs.EncodeXmlFragment("default", client, []*yjs.XmlNode{{
+		Name:     "paragraph",
+		Children: []*yjs.XmlNode{{Runs: []yjs.TextRun{{Text: text}}}},
+	}})
+	return base64.StdEncoding.EncodeToString(update)
+}
+
+func startServer(t *testing.T, b broker.Broker) *httptest.Server {
+	t.Helper()
+	return startServerWithLoader(t, b, nil)
+}
+
+func startServerWithLoader(t *testing.T, b broker.Broker, loader Loader) *httptest.Server {
+	t.Helper()
+	s := NewServer(NewHub(), b, nil, loader, Config{
+		SnapshotDelay:   time.Hour,
+		SnapshotMaxWait: time.Hour,
+		SuggestionDelay: time.Hour,
+	})
+	if err := s.Subscribe(); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	ts := httptest.NewServer(s.Router())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+type testClient struct {
+	conn     *websocket.Conn
+	messages chan Message
+}
+
+func dial(t *testing.T, ts *httptest.Server, documentID, clientID string) *testClient {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?" + url.Values{
+		"document_id": {documentID},
+		"client_id":   {clientID},
+	}.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{conn: conn, messages: make(chan Message, 64)}
+	go func() {
+		defer close(c.messages)
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *testClient) send(t *testing.T, msg Message) {
+	t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+// updates collects the yjs_update messages c receives within d.
+func (c *testClient) updates(d time.Duration) []Message {
+	var got []Message
+	timeout := time.After(d)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				return got
+			}
+			if msg.Type == messageUpdate {
+				got = append(got, msg)
+			}
+		case <-timeout:
+			return got
+		}
+	}
+}
+
+// testReplicas checks that an update sent to one of two replicas reaches
+// the other clients of both exactly once and is not echoed back.
+func testReplicas(t *testing.T, b1, b2 broker.Broker) {
+	one := startServer(t, b1)
+	two := startServer(t, b2)
+	const doc = "3f0c5a52-8b0e-4f6e-9a57-0d8d5b1f7a10"
+	alice := dial(t, one, doc, "alice")
+	carol := dial(t, one, doc, "carol")
+	bob := dial(t, two, doc, "bob")
+	// Give both subscriptions and registrations time to settle.
+	time.Sleep(200 * time.Millisecond)
+
+	alice.send(t, Message{Type: messageUpdate, DocumentID: doc, ClientID: "alice", Payload: testUpdate(1, "hi")})
+
+	for name, c := range map[string]*testClient{"bob": bob, "carol": carol} {
+		if got := c.updates(time.Second); len(got) != 1 {
+			t.Fatalf("%s received %d updates, want 1", name, len(got))
+		} else if got[0].ClientID != "alice" {
+			t.Fatalf("%s received update from %q, want alice", name, got[0].ClientID)
+		}
+	}
+	if got := alice.updates(200 * time.Millisecond); len(got) != 0 {
+		t.Fatalf("alice received %d updates of her own, want 0", len(got))
+	}
+}
+
+func TestReplicasDeliverOnceMemory(t *testing.T) {
+	b := broker.NewMemory()
+	t.Cleanup(b.Close)
+	testReplicas(t, b, b)
+}
+
+// TestReplicasDeliverOnceNATS runs the same check over NATS, with one
+// connection per replica. It uses the server at DOCLET_TEST_NATS_URL, or
+// starts nats-server from PATH on a free port.
+func TestReplicasDeliverOnceNATS(t *testing.T) {
+	natsURL := os.Getenv("DOCLET_TEST_NATS_URL")
+	if natsURL == "" {
+		natsURL = startNATS(t)
+	}
+	connect := func() broker.Broker {
+		b, err := broker.NewNats(natsURL)
+		if err != nil {
+			t.Fatalf("connect to nats: %v", err)
+		}
+		t.Cleanup(b.Close)
+		return b
+	}
+	testReplicas(t, connect(), connect())
+}
+
+func startNATS(t *testing.T) string {
+	t.Helper()
+	bin, err := exec.LookPath("nats-server")
+	if err != nil {
+		t.Skip("nats-server not on PATH and DOCLET_TEST_NATS_URL not set")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+	cmd := exec.Command(bin, "-a", "127.0.0.1", "-p", port)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start nats-server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	natsURL := "nats://127.0.0.1:" + port
+	for i := 0; i < 50; i++ {
+		if b, err := broker.NewNats(natsURL); err == nil {
+			b.Close()
+			return natsURL
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("nats-server did not start on port %s", port)
+	return ""
+}
@@ -0,0 +1,76 @@
+package collab
+
+import (
+	"sync"
+	"time"
+)
+
+// snapshotScheduler debounces snapshot publication per document: flush runs
+// once a document has been idle for delay, or maxWait after its first
+// unsaved change, whichever comes first.
+type snapshotScheduler struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	maxWait time.Duration
+	pending map[string]*pendingSnapshot
+	flush   func(documentID string)
+}
+
+type pendingSnapshot struct {
+	timer *time.Timer
+	first time.Time
+}
+
+func newSnapshotScheduler(delay, maxWait time.Duration, flush func(documentID string)) *snapshotScheduler {
+	if maxWait < delay {
+		maxWait = delay
+	}
+	return &snapshotScheduler{
+		delay:   delay,
+		maxWait: maxWait,
+		pending: make(map[string]*pendingSnapshot),
+		flush:   flush,
+	}
+}
+
+func (s *snapshotScheduler) schedule(documentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pending[documentID]
+	if p == nil {
+		p = &pendingSnapshot{first: time.Now()}
+		p.timer = time.AfterFunc(s.delay, func() { s.fire(documentID, p) })
+		s.pending[documentID] = p
+		return
+	}
+	wait := s.delay
+	if remaining := s.maxWait - time.Since(p.first); remaining < wait {
+		wait = max(remaining, 0)
+	}
+	p.timer.Reset(wait)
+}
+
+func (s *snapshotScheduler) fire(documentID string, p *pendingSnapshot) {
+	s.mu.Lock()
+	if s.pending[documentID] != p {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, documentID)
+	s.mu.Unlock()
+	s.flush(documentID)
+}
+
+// cancel drops any pending snapshot for the document and reports whether
+// one was pending.
+func (s *snapshotScheduler) cancel(documentID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pending[documentID]
+	if p == nil {
+		return false
+	}
+	p.timer.Stop()
+	delete(s.pending, documentID)
+	return true
+}
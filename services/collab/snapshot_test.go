@@ -0,0 +1,70 @@
+package collab
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"doclet/shared/broker"
+	"doclet/shared/yjs"
+)
+
+// TestSnapshotReachesPeers covers a client reconnecting with offline edits:
+// what its snapshot adds is sent to the peers on this and other replicas.
+func TestSnapshotReachesPeers(t *testing.T) {
+	b := broker.NewMemory()
+	t.Cleanup(b.Close)
+	one := startServer(t, b)
+	two := startServer(t, b)
+	const doc = "9a4e2c71-5b3d-4f8a-b6e0-1c2d3e4f5a6b"
+	alice := dial(t, one, doc, "alice")
+	carol := dial(t, two, doc, "carol")
+	time.Sleep(200 * time.Millisecond)
+
+	shared := testUpdate(1, "shared")
+	alice.send(t, Message{Type: messageUpdate, DocumentID: doc, ClientID: "alice", Payload: shared})
+	if got := carol.updates(time.Second); len(got) != 1 {
+		t.Fatalf("carol received %d updates, want 1", len(got))
+	}
+
+	// Bob was offline while he wrote his paragraph; he reconnects with a
+	// snapshot of everything he has.
+	bob := dial(t, one, doc, "bob")
+	snapshot := func(updates ...string) string {
+		var raw [][]byte
+		for _, u := range updates {
+			data, _ := base64.StdEncoding.DecodeString(u)
+			raw = append(raw, data)
+		}
+		merged, err := yjs.MergeUpdates(raw...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(merged)
+	}
+	bob.send(t, Message{Type: messageSnapshot, DocumentID: doc, ClientID: "bob", Payload: snapshot(shared, testUpdate(2, "offline"))})
+
+	for name, c := range map[string]*testClient{"alice": alice, "carol": carol} {
+		got := c.updates(time.Second)
+		if len(got) != 1 {
+			t.Fatalf("%s received %d updates, want 1", name, len(got))
+		}
+		update, _ := base64.StdEncoding.DecodeString(got[0].Payload)
+		received := yjs.NewDoc()
+		if err := received.ApplyUpdate(update); err != nil {
+			t.Fatal(err)
+		}
+		if received.StateVector()[2] == 0 || received.StateVector()[1] != 0 {
+			t.Errorf("%s received state %v, want only bob's offline edit", name, received.StateVector())
+		}
+	}
+	if got := bob.updates(200 * time.Millisecond); len(got) != 0 {
+		t.Fatalf("bob received %d updates of his own, want 0", len(got))
+	}
+
+	// A snapshot with nothing new is not passed on.
+	bob.send(t, Message{Type: messageSnapshot, DocumentID: doc, ClientID: "bob", Payload: snapshot(shared)})
+	if got := alice.updates(200 * time.Millisecond); len(got) != 0 {
+		t.Fatalf("alice received %d updates for a stale snapshot, want 0", len(got))
+	}
+}
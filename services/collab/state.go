@@ -0,0 +1,76 @@
+package collab
+
+import (
+	"sync"
+
+	"doclet/shared/yjs"
+)
+
+// docState is the authoritative Yjs state of a document that has at least
+// one client connected to this replica.
+type docState struct {
+	mu  sync.Mutex
+	doc *yjs.Doc
+	// opened is closed once the first client has seeded the state from the
+	// document service; openErr is set when that failed.
+	opened  chan struct{}
+	openErr error
+}
+
+func newDocState() *docState {
+	return &docState{doc: yjs.NewDoc(), opened: make(chan struct{})}
+}
+
+func (d *docState) finishOpen(err error) {
+	d.openErr = err
+	close(d.opened)
+}
+
+func (d *docState) waitOpen() error {
+	<-d.opened
+	return d.openErr
+}
+
+func (d *docState) apply(update []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.doc.ApplyUpdate(update)
+}
+
+// applyNew merges update and returns the part of the state it added,
+// computed against the state vector from before, or nil when the state
+// already had all of it.
+func (d *docState) applyNew(update []byte) ([]byte, error) {
+	incoming := yjs.NewDoc()
+	if err := incoming.ApplyUpdate(update); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.doc.Covers(incoming) {
+		return nil, nil
+	}
+	sv := d.doc.StateVector()
+	if err := d.doc.ApplyUpdate(update); err != nil {
+		return nil, err
+	}
+	return d.doc.EncodeStateAsUpdate(sv), nil
+}
+
+func (d *docState) encode(sv yjs.StateVector) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.doc.EncodeStateAsUpdate(sv)
+}
+
+func (d *docState) stateVector() yjs.StateVector {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.doc.StateVector()
+}
+
+func (d *docState) empty() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.doc.Empty()
+}
@@ -0,0 +1,80 @@
+package collab
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"doclet/shared/yjs"
+)
+
+// suggestionBuffer collects the updates of suggesting clients. A client's
+// updates are merged and passed to flush once it has stopped typing for
+// delay or leaves, so a suggestion is a run of edits rather than a keystroke.
+type suggestionBuffer struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	pending map[*Client]*pendingSuggestion
+	flush   func(client *Client, update []byte)
+}
+
+type pendingSuggestion struct {
+	timer   *time.Timer
+	updates [][]byte
+}
+
+func newSuggestionBuffer(delay time.Duration, flush func(client *Client, update []byte)) *suggestionBuffer {
+	return &suggestionBuffer{
+		delay:   delay,
+		pending: make(map[*Client]*pendingSuggestion),
+		flush:   flush,
+	}
+}
+
+func (b *suggestionBuffer) add(client *Client, update []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.pending[client]
+	if p == nil {
+		p = &pendingSuggestion{}
+		p.timer = time.AfterFunc(b.delay, func() { b.fire(client, p) })
+		b.pending[client] = p
+	} else {
+		p.timer.Reset(b.delay)
+	}
+	p.updates = append(p.updates, update)
+}
+
+func (b *suggestionBuffer) fire(client *Client, p *pendingSuggestion) {
+	b.mu.Lock()
+	if b.pending[client] != p {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, client)
+	b.mu.Unlock()
+	b.emit(client, p.updates)
+}
+
+// done flushes whatever the client has buffered right away.
+func (b *suggestionBuffer) done(client *Client) {
+	b.mu.Lock()
+	p := b.pending[client]
+	if p == nil {
+		b.mu.Unlock()
+		return
+	}
+	p.timer.Stop()
+	delete(b.pending, client)
+	b.mu.Unlock()
+	b.emit(client, p.updates)
+}
+
+func (b *suggestionBuffer) emit(client *Client, updates [][]byte) {
+	update, err := yjs.MergeUpdates(updates...)
+	if err != nil {
+		log.Printf("merging suggestion from %s failed: %v", client.clientID, err)
+		return
+	}
+	b.flush(client, update)
+}
@@ -0,0 +1,196 @@
+package collab
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+
+	"doclet/shared/yjs"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// y-websocket message types, see y-protocols/sync and y-websocket.
+const (
+	yMessageSync           = 0
+	yMessageAwareness      = 1
+	yMessageQueryAwareness = 3
+
+	ySyncStep1  = 0
+	ySyncStep2  = 1
+	ySyncUpdate = 2
+)
+
+// handleSyncWebsocket serves the binary y-websocket protocol on
+// /yjs/{document_id}, so stock Yjs providers share rooms with /ws clients.
+func (s *Server) handleSyncWebsocket(w http.ResponseWriter, r *http.Request) {
+	documentID := strings.TrimPrefix(r.URL.Path, "/yjs/")
+	if documentID == "" || strings.Contains(documentID, "/") {
+		http.Error(w, "missing document_id", http.StatusBadRequest)
+		return
+	}
+	grant, clientID, ok := s.authorize(w, r, documentID, r.URL.Query().Get("client_id"))
+	if !ok {
+		return
+	}
+	if clientID == "" {
+		clientID = uuid.NewString()
+	}
+	readOnly, suggesting, ok := connectionMode(w, r, grant.Role)
+	if !ok {
+		return
+	}
+	if suggesting {
+		// Stock providers apply their own edits locally and expect them to
+		// stick, so suggesting is only offered on /ws.
+		http.Error(w, "unknown mode", http.StatusBadRequest)
+		return
+	}
+	if s.hub.IsDeleted(documentID) {
+		http.Error(w, "document deleted", http.StatusGone)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("websocket upgrade failed: %v", err)
+		return
+	}
+
+	client := &Client{
+		conn:       conn,
+		send:       make(chan []byte, 256),
+		documentID: documentID,
+		clientID:   clientID,
+		authorID:   grant.AuthorID,
+		ip:         remoteIP(r),
+		role:       grant.Role,
+		readOnly:   readOnly,
+		binary:     true,
+		limiter:    newRateLimiter(s.clientLimit),
+		wake:       make(chan struct{}, 1),
+	}
+
+	if err := s.join(client, credentials(r)); err != nil {
+		s.refuse(client, err)
+		return
+	}
+	log.Printf("yjs client %s joined %s", clientID, documentID)
+
+	go client.WritePump()
+	// Like the reference y-websocket server, open with sync step 1 so the
+	// client answers with whatever the hub is missing.
+	client.sendFrame(encodeSyncMessage(ySyncStep1, s.hub.StateVector(documentID).Encode()))
+	client.readFrames(func(data []byte) {
+		if !s.admit(client, len(data)) {
+			return
+		}
+		s.handleSyncMessage(client, data)
+	})
+
+	s.leave(client)
+	log.Printf("yjs client %s left %s (%d dropped)", clientID, documentID, client.dropped.Load())
+}
+
+func (s *Server) handleSyncMessage(client *Client, data []byte) {
+	d := yjs.NewDecoder(data)
+	kind, err := d.ReadVarUint()
+	if err != nil {
+		log.Printf("invalid yjs message from %s: %v", client.clientID, err)
+		return
+	}
+	switch kind {
+	case yMessageSync:
+		step, err := d.ReadVarUint()
+		if err != nil {
+			log.Printf("invalid yjs sync message from %s: %v", client.clientID, err)
+			return
+		}
+		payload, err := d.ReadVarBytes()
+		if err != nil {
+			log.Printf("invalid yjs sync message from %s: %v", client.clientID, err)
+			return
+		}
+		switch step {
+		case ySyncStep1:
+			sv, err := yjs.DecodeStateVector(payload)
+			if err != nil {
+				log.Printf("invalid yjs state vector from %s: %v", client.clientID, err)
+				return
+			}
+			update := s.hub.DocumentState(client.documentID, sv)
+			if update == nil {
+				update = yjs.NewDoc().EncodeStateAsUpdate(nil)
+			}
+			if !client.sendFrame(encodeSyncMessage(ySyncStep2, update)) {
+				log.Printf("yjs sync step 2 dropped for %s", client.clientID)
+			}
+		case ySyncStep2, ySyncUpdate:
+			s.handleClientMessage(client, Message{
+				Type:       messageUpdate,
+				DocumentID: client.documentID,
+				ClientID:   client.clientID,
+				Payload:    base64.StdEncoding.EncodeToString(payload),
+			})
+		default:
+			log.Printf("unknown yjs sync step: %d", step)
+		}
+	case yMessageAwareness:
+		payload, err := d.ReadVarBytes()
+		if err != nil {
+			log.Printf("invalid yjs awareness message from %s: %v", client.clientID, err)
+			return
+		}
+		s.handleClientMessage(client, Message{
+			Type:       messagePresence,
+			DocumentID: client.documentID,
+			ClientID:   client.clientID,
+			Payload:    base64.StdEncoding.EncodeToString(payload),
+		})
+	case yMessageQueryAwareness:
+		// Awareness is relayed, not stored, so there is nothing to answer with.
+	default:
+		log.Printf("unknown yjs message type: %d", kind)
+	}
+}
+
+// encodeSyncFrame translates a JSON envelope message into its y-websocket
+// equivalent, or returns nil when the protocol has no such message.
+func encodeSyncFrame(msg Message) []byte {
+	var kind uint64
+	var step uint64
+	switch msg.Type {
+	case messageUpdate:
+		kind, step = yMessageSync, ySyncUpdate
+	case messageSync:
+		kind, step = yMessageSync, ySyncStep2
+	case messagePresence:
+		kind = yMessageAwareness
+	default:
+		return nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		log.Printf("invalid %s payload for yjs client: %v", msg.Type, err)
+		return nil
+	}
+	if kind == yMessageAwareness {
+		e := yjs.NewEncoder()
+		e.WriteVarUint(yMessageAwareness)
+		e.WriteVarBytes(payload)
+		return e.Bytes()
+	}
+	return encodeSyncMessage(step, payload)
+}
+
+func encodeSyncMessage(step uint64, payload []byte) []byte {
+	e := yjs.NewEncoder()
+	e.WriteVarUint(yMessageSync)
+	e.WriteVarUint(step)
+	e.WriteVarBytes(payload)
+	return e.Bytes()
+}
@@ -0,0 +1,326 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"doclet/shared/yjs"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCommentLength = 10000
+	maxQuoteLength   = 500
+)
+
+var (
+	ErrInvalidAnchor  = errors.New("invalid comment anchor")
+	ErrEmptyComment   = errors.New("empty comment")
+	ErrCommentTooLong = errors.New("comment too long")
+	// ErrNotCommentAuthor is returned when someone other than its author
+	// changes a comment.
+	ErrNotCommentAuthor = errors.New("not the comment author")
+)
+
+// NewComment is a comment to add to a thread.
+type NewComment struct {
+	AuthorID   string
+	AuthorName string
+	Body       string
+}
+
+func (c NewComment) validate() (NewComment, error) {
+	c.Body = strings.TrimSpace(c.Body)
+	if c.Body == "" {
+		return c, ErrEmptyComment
+	}
+	if len(c.Body) > maxCommentLength {
+		return c, ErrCommentTooLong
+	}
+	return c, nil
+}
+
+// ListThreads returns the document's threads, oldest first, with their
+// comments. A non-nil resolved only lists resolved or open threads.
+func (s *Store) ListThreads(ctx context.Context, docID uuid.UUID, resolved *bool) ([]CommentThread, error) {
+	db := s.db.WithContext(ctx)
+	var doc Document
+	if err := db.Select("document_id").First(&doc, "document_id = ?", docID).Error; err != nil {
+		return nil, err
+	}
+	query := db.Where("document_id = ?", docID)
+	if resolved != nil {
+		if *resolved {
+			query = query.Where("resolved_at IS NOT NULL")
+		} else {
+			query = query.Where("resolved_at IS NULL")
+		}
+	}
+	threads := []CommentThread{}
+	if err := query.Order("created_at asc, thread_id asc").Find(&threads).Error; err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return threads, nil
+	}
+	ids := make([]uuid.UUID, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.ThreadID)
+	}
+	var comments []Comment
+	if err := db.Where("thread_id IN ?", ids).
+		Order("created_at asc, comment_id asc").
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	byThread := make(map[uuid.UUID][]Comment, len(threads))
+	for _, comment := range comments {
+		byThread[comment.ThreadID] = append(byThread[comment.ThreadID], comment)
+	}
+	for i := range threads {
+		threads[i].Comments = byThread[threads[i].ThreadID]
+	}
+	return threads, nil
+}
+
+func (s *Store) GetThread(ctx context.Context, docID, threadID uuid.UUID) (CommentThread, error) {
+	return loadThread(s.db.WithContext(ctx), docID, threadID)
+}
+
+// CreateThread starts a thread on the range between two encoded Yjs
+// relative positions.
+func (s *Store) CreateThread(ctx context.Context, docID uuid.UUID, start, end []byte, quote string, first NewComment) (CommentThread, error) {
+	if !validAnchor(start) || !validAnchor(end) {
+		return CommentThread{}, ErrInvalidAnchor
+	}
+	first, err := first.validate()
+	if err != nil {
+		return CommentThread{}, err
+	}
+	thread := CommentThread{
+		ThreadID:    uuid.New(),
+		DocumentID:  docID,
+		AnchorStart: start,
+		AnchorEnd:   end,
+		Quote:       truncate(strings.TrimSpace(quote), maxQuoteLength),
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := tx.Select("document_id").First(&doc, "document_id = ?", docID).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&thread).Error; err != nil {
+			return err
+		}
+		comment := newComment(thread, first)
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		thread.Comments = []Comment{comment}
+		return nil
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+// AddComment replies to a thread and returns the updated thread.
+func (s *Store) AddComment(ctx context.Context, docID, threadID uuid.UUID, reply NewComment) (CommentThread, error) {
+	reply, err := reply.validate()
+	if err != nil {
+		return CommentThread{}, err
+	}
+	var thread CommentThread
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if thread, err = loadThread(tx, docID, threadID); err != nil {
+			return err
+		}
+		comment := newComment(thread, reply)
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		thread.Comments = append(thread.Comments, comment)
+		return touchThread(tx, &thread)
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+// UpdateComment changes the body of a comment. Unless authorID is empty,
+// only the comment's author may change it.
+func (s *Store) UpdateComment(ctx context.Context, docID, threadID, commentID uuid.UUID, authorID, body string) (CommentThread, error) {
+	edit, err := NewComment{Body: body}.validate()
+	if err != nil {
+		return CommentThread{}, err
+	}
+	var thread CommentThread
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if thread, err = loadThread(tx, docID, threadID); err != nil {
+			return err
+		}
+		i, err := findComment(thread, commentID, authorID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if err := tx.Model(&Comment{}).
+			Where("comment_id = ?", commentID).
+			Updates(map[string]interface{}{"body": edit.Body, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		thread.Comments[i].Body = edit.Body
+		thread.Comments[i].UpdatedAt = now
+		return touchThread(tx, &thread)
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+// DeleteComment removes a comment with the same author rule as
+// UpdateComment. Deleting the last comment deletes the thread, which is then
+// returned without comments.
+func (s *Store) DeleteComment(ctx context.Context, docID, threadID, commentID uuid.UUID, authorID string) (CommentThread, error) {
+	var thread CommentThread
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if thread, err = loadThread(tx, docID, threadID); err != nil {
+			return err
+		}
+		i, err := findComment(thread, commentID, authorID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&Comment{}, "comment_id = ?", commentID).Error; err != nil {
+			return err
+		}
+		thread.Comments = append(thread.Comments[:i], thread.Comments[i+1:]...)
+		if len(thread.Comments) == 0 {
+			return tx.Delete(&CommentThread{}, "thread_id = ?", threadID).Error
+		}
+		return touchThread(tx, &thread)
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+// SetThreadResolved resolves or reopens a thread. by is recorded as the
+// client that resolved it.
+func (s *Store) SetThreadResolved(ctx context.Context, docID, threadID uuid.UUID, resolved bool, by string) (CommentThread, error) {
+	var thread CommentThread
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if thread, err = loadThread(tx, docID, threadID); err != nil {
+			return err
+		}
+		thread.ResolvedAt, thread.ResolvedBy = nil, ""
+		if resolved {
+			now := time.Now().UTC()
+			thread.ResolvedAt, thread.ResolvedBy = &now, by
+		}
+		thread.UpdatedAt = time.Now().UTC()
+		return tx.Model(&CommentThread{}).
+			Where("thread_id = ?", threadID).
+			Updates(map[string]interface{}{
+				"resolved_at": thread.ResolvedAt,
+				"resolved_by": thread.ResolvedBy,
+				"updated_at":  thread.UpdatedAt,
+			}).Error
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+// DeleteThread removes a thread with all of its comments and returns what
+// was deleted.
+func (s *Store) DeleteThread(ctx context.Context, docID, threadID uuid.UUID) (CommentThread, error) {
+	var thread CommentThread
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if thread, err = loadThread(tx, docID, threadID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&Comment{}, "thread_id = ?", threadID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&CommentThread{}, "thread_id = ?", threadID).Error
+	})
+	if err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+func loadThread(db *gorm.DB, docID, threadID uuid.UUID) (CommentThread, error) {
+	var thread CommentThread
+	if err := db.First(&thread, "thread_id = ? AND document_id = ?", threadID, docID).Error; err != nil {
+		return CommentThread{}, err
+	}
+	if err := db.Where("thread_id = ?", threadID).
+		Order("created_at asc, comment_id asc").
+		Find(&thread.Comments).Error; err != nil {
+		return CommentThread{}, err
+	}
+	return thread, nil
+}
+
+func touchThread(tx *gorm.DB, thread *CommentThread) error {
+	thread.UpdatedAt = time.Now().UTC()
+	return tx.Model(&CommentThread{}).
+		Where("thread_id = ?", thread.ThreadID).
+		Update("updated_at", thread.UpdatedAt).Error
+}
+
+func findComment(thread CommentThread, commentID uuid.UUID, authorID string) (int, error) {
+	for i, comment := range thread.Comments {
+		if comment.CommentID != commentID {
+			continue
+		}
+		if authorID != "" && comment.AuthorID != authorID {
+			return 0, ErrNotCommentAuthor
+		}
+		return i, nil
+	}
+	return 0, gorm.ErrRecordNotFound
+}
+
+func newComment(thread CommentThread, c NewComment) Comment {
+	return Comment{
+		CommentID:  uuid.New(),
+		ThreadID:   thread.ThreadID,
+		DocumentID: thread.DocumentID,
+		AuthorID:   c.AuthorID,
+		AuthorName: truncate(strings.TrimSpace(c.AuthorName), 100),
+		Body:       c.Body,
+	}
+}
+
+func validAnchor(data []byte) bool {
+	_, err := yjs.DecodeRelativePosition(data)
+	return err == nil
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
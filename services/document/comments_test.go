@@ -0,0 +1,80 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"doclet/shared/access"
+	"doclet/shared/yjs"
+)
+
+// TestCommentAuthorFromToken checks that comments are attributed to the
+// share token they are made with, whatever client_id the body claims.
+func TestCommentAuthorFromToken(t *testing.T) {
+	store, ts := newTestServer(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, store, paragraph(1, "text"))
+	owner := ownerToken(t, store, doc)
+	mint := func(role access.Role) string {
+		share, err := store.CreateShare(ctx, doc.DocumentID, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return share.Token
+	}
+	alice, mallory := mint(access.RoleCommenter), mint(access.RoleCommenter)
+	path := "/documents/" + doc.DocumentID.String()
+
+	var acc AccessResponse
+	decode(t, get(t, ts, path+"/access", alice), &acc)
+	if acc.AuthorID == "" || acc.AuthorID != AuthorID(alice) {
+		t.Fatalf("access author_id = %q, want %q", acc.AuthorID, AuthorID(alice))
+	}
+
+	anchor := base64.StdEncoding.EncodeToString(yjs.RelativePosition{TypeName: fragmentName}.Encode())
+	resp := request(t, ts, http.MethodPost, path+"/threads", alice, map[string]any{
+		"client_id": "mallory",
+		"body":      "first",
+		"anchor":    map[string]string{"start": anchor, "end": anchor},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create thread: status %d", resp.StatusCode)
+	}
+	var thread ThreadResponse
+	decode(t, resp, &thread)
+	comment := thread.Comments[0]
+	if comment.AuthorID != acc.AuthorID {
+		t.Fatalf("author_id = %q, want alice's %q", comment.AuthorID, acc.AuthorID)
+	}
+	commentPath := path + "/threads/" + thread.ThreadID + "/comments/" + comment.CommentID
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"other commenter claiming the client_id", mallory, http.StatusForbidden},
+		{"author", alice, http.StatusOK},
+		{"editor", owner, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp := request(t, ts, http.MethodPut, commentPath, tt.token, map[string]string{
+			"client_id": "mallory",
+			"body":      "edited by " + tt.name,
+		})
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	resp = request(t, ts, http.MethodPost, path+"/threads/"+thread.ThreadID+"/resolve", mallory, nil)
+	decode(t, resp, &thread)
+	if thread.ResolvedBy != AuthorID(mallory) {
+		t.Errorf("resolved_by = %q, want %q", thread.ResolvedBy, AuthorID(mallory))
+	}
+	if resp := request(t, ts, http.MethodDelete, commentPath+"?client_id=mallory", mallory, nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("delete by other commenter: status %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,38 @@
+package document
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunCompactor folds the update log into document content every interval
+// until ctx is cancelled.
+func RunCompactor(ctx context.Context, store *Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			compactAll(ctx, store)
+		}
+	}
+}
+
+func compactAll(ctx context.Context, store *Store) {
+	ids, err := store.DocumentsWithPendingUpdates(ctx)
+	if err != nil {
+		log.Printf("compaction list error: %v", err)
+		return
+	}
+	for _, id := range ids {
+		compactCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := store.Compact(compactCtx, id)
+		cancel()
+		if err != nil && !IsNotFound(err) {
+			log.Printf("compaction error for %s: %v", id, err)
+		}
+	}
+}
@@ -1,23 +1,64 @@
 package document
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 const (
-	defaultHTTPAddr = ":8080"
-	defaultNATSURL  = "nats://127.0.0.1:4222"
+	defaultHTTPAddr           = ":8080"
+	defaultNATSURL            = "nats://127.0.0.1:4222"
+	defaultCompactionInterval = time.Minute
+	defaultVersionInterval    = 10 * time.Minute
+	defaultVersionRetention   = 50
+	defaultStreamMaxAge       = 24 * time.Hour
+	defaultTicketTTL          = time.Minute
+	defaultPurgeInterval      = time.Hour
+	defaultTrashRetention     = 30 * 24 * time.Hour
 )
 
 type Config struct {
-	HTTPAddr    string
-	DatabaseURL string
-	NATSURL     string
+	HTTPAddr           string
+	DatabaseURL        string
+	NATSURL            string
+	CompactionInterval time.Duration
+	// VersionInterval is how often changed documents get an auto version;
+	// VersionRetention is how many auto versions are kept per document.
+	VersionInterval  time.Duration
+	VersionRetention int
+	// JetStream consumes snapshots and updates through durable consumers on
+	// a stream that keeps doclet.documents.> for StreamMaxAge.
+	JetStream    bool
+	StreamMaxAge time.Duration
+	// Deleted documents stay in the trash for TrashRetention; the purger
+	// looks for expired ones every PurgeInterval.
+	PurgeInterval  time.Duration
+	TrashRetention time.Duration
+	// TicketKey signs collab session tickets valid for TicketTTL. Tickets
+	// are not issued when it is empty.
+	TicketKey string
+	TicketTTL time.Duration
+	// OTLPEndpoint receives traces over OTLP/HTTP; tracing is off when it
+	// is empty.
+	OTLPEndpoint string
 }
 
 func LoadConfig() Config {
 	cfg := Config{
-		HTTPAddr:    getenv("DOCLET_DOCUMENT_ADDR", defaultHTTPAddr),
-		DatabaseURL: os.Getenv("DOCLET_DATABASE_URL"),
-		NATSURL:     getenv("DOCLET_NATS_URL", defaultNATSURL),
+		HTTPAddr:           getenv("DOCLET_DOCUMENT_ADDR", defaultHTTPAddr),
+		DatabaseURL:        os.Getenv("DOCLET_DATABASE_URL"),
+		NATSURL:            getenv("DOCLET_NATS_URL", defaultNATSURL),
+		CompactionInterval: getenvDuration("DOCLET_COMPACTION_INTERVAL", defaultCompactionInterval),
+		VersionInterval:    getenvDuration("DOCLET_VERSION_INTERVAL", defaultVersionInterval),
+		VersionRetention:   getenvInt("DOCLET_VERSION_RETENTION", defaultVersionRetention),
+		JetStream:          getenvBool("DOCLET_NATS_JETSTREAM"),
+		StreamMaxAge:       getenvDuration("DOCLET_NATS_STREAM_MAX_AGE", defaultStreamMaxAge),
+		PurgeInterval:      getenvDuration("DOCLET_PURGE_INTERVAL", defaultPurgeInterval),
+		TrashRetention:     getenvDuration("DOCLET_TRASH_RETENTION", defaultTrashRetention),
+		TicketKey:          os.Getenv("DOCLET_TICKET_KEY"),
+		TicketTTL:          getenvDuration("DOCLET_TICKET_TTL", defaultTicketTTL),
+		OTLPEndpoint:       os.Getenv("DOCLET_OTLP_ENDPOINT"),
 	}
 	return cfg
 }
@@ -29,3 +70,24 @@ func getenv(key, fallback string) string {
 	}
 	return value
 }
+
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func getenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func getenvBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && value
+}
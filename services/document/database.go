@@ -1,10 +1,58 @@
 package document
 
 import (
+	"strings"
+	"time"
+
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const dialectSQLite = "sqlite"
+
+// OpenDatabase connects to Postgres, or to SQLite when dsn has the form
+// sqlite:<path> (sqlite::memory: for a throwaway database).
+func OpenDatabase(dsn string) (*gorm.DB, error) {
+	var db *gorm.DB
+	var err error
+	if path, ok := strings.CutPrefix(dsn, "sqlite:"); ok {
+		db, err = openSQLite(strings.TrimPrefix(path, "//"))
+	} else {
+		db, err = gorm.Open(openPostgres(dsn), &gorm.Config{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracingPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 func openPostgres(dsn string) gorm.Dialector {
 	return postgres.Open(dsn)
 }
+
+// openSQLite opens the database file at path over a single connection, so
+// transactions are serialized and an in-memory database is shared.
+func openSQLite(path string) (*gorm.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := gorm.Open(sqlite.Open(path+sep+"_foreign_keys=on&_busy_timeout=5000"), &gorm.Config{
+		// Timestamps are stored as text, so keep them in one zone for
+		// comparisons like DocumentsChangedSinceLastVersion.
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
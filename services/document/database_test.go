@@ -0,0 +1,46 @@
+package document
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSQLiteFile runs the sqlite:<path> setup main uses: the schema and
+// documents survive reopening the file.
+func TestSQLiteFile(t *testing.T) {
+	dsn := "sqlite:" + filepath.Join(t.TempDir(), "doclet.db")
+	open := func() *Store {
+		db, err := OpenDatabase(dsn)
+		if err == nil {
+			err = RunMigrations(db)
+		}
+		if err != nil {
+			t.Skipf("sqlite unavailable: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		return NewStore(db)
+	}
+
+	ctx := context.Background()
+	s := open()
+	doc := createTestDocument(t, s, paragraph(1, "kept"))
+	if err := s.AppendUpdate(ctx, doc.DocumentID, "c", paragraph(2, "logged")); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := s.db.DB()
+	sqlDB.Close()
+
+	got, err := open().GetDocument(ctx, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := extractText(got.Content); !strings.Contains(text, "kept") || !strings.Contains(text, "logged") {
+		t.Errorf("content text = %q, want kept and logged", text)
+	}
+}
@@ -0,0 +1,346 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"time"
+
+	"doclet/shared/broker"
+	"doclet/shared/yjs"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SnapshotMessage struct {
+	DocumentID string `json:"document_id"`
+	Content    string `json:"content"`
+	Payload    string `json:"payload"`
+}
+
+type UpdateMessage struct {
+	Type       string `json:"type"`
+	DocumentID string `json:"document_id"`
+	ClientID   string `json:"client_id"`
+	Payload    string `json:"payload"`
+	Origin     string `json:"origin,omitempty"`
+	// AuthorID is who collab attributes a suggestion to, derived from the
+	// connection's share token or ticket rather than its client ID.
+	AuthorID string `json:"author_id,omitempty"`
+}
+
+// LifecycleMessage announces that a document was moved to or restored from
+// the trash.
+type LifecycleMessage struct {
+	Type       string `json:"type"`
+	DocumentID string `json:"document_id"`
+}
+
+// TagsMessage carries a document's tags after they changed.
+type TagsMessage struct {
+	Type       string   `json:"type"`
+	DocumentID string   `json:"document_id"`
+	Tags       []string `json:"tags"`
+}
+
+// Comment events, published with the affected thread. Clients replace
+// their copy of the thread, except for CommentThreadDeleted.
+const (
+	CommentThreadCreated = "comment_thread_created"
+	CommentAdded         = "comment_added"
+	CommentUpdated       = "comment_updated"
+	CommentDeleted       = "comment_deleted"
+	CommentResolved      = "comment_resolved"
+	CommentReopened      = "comment_reopened"
+	CommentThreadDeleted = "comment_thread_deleted"
+)
+
+// CommentMessage announces a change to a comment thread.
+type CommentMessage struct {
+	Type       string         `json:"type"`
+	DocumentID string         `json:"document_id"`
+	Thread     ThreadResponse `json:"thread"`
+}
+
+// Suggestion events, published with the affected suggestion.
+const (
+	SuggestionCreated  = "suggestion_created"
+	SuggestionAccepted = "suggestion_accepted"
+	SuggestionRejected = "suggestion_rejected"
+)
+
+// SuggestionMessage announces a new or resolved suggestion.
+type SuggestionMessage struct {
+	Type       string             `json:"type"`
+	DocumentID string             `json:"document_id"`
+	Suggestion SuggestionResponse `json:"suggestion"`
+}
+
+// serviceOrigin marks messages the document service publishes itself, so
+// its own update consumer can skip them.
+const serviceOrigin = "document-service"
+
+// Publisher sends document service events to the collab service.
+type Publisher struct {
+	bus broker.Broker
+}
+
+func NewPublisher(bus broker.Broker) *Publisher {
+	return &Publisher{bus: bus}
+}
+
+// PublishUpdate broadcasts a Yjs update to every editor of the document.
+func (p *Publisher) PublishUpdate(ctx context.Context, docID uuid.UUID, update []byte) error {
+	if p == nil || p.bus == nil {
+		return nil
+	}
+	data, err := json.Marshal(UpdateMessage{
+		Type:       "yjs_update",
+		DocumentID: docID.String(),
+		ClientID:   serviceOrigin,
+		Payload:    base64.StdEncoding.EncodeToString(update),
+		Origin:     serviceOrigin,
+	})
+	if err != nil {
+		return err
+	}
+	return p.bus.Publish(ctx, "doclet.documents."+docID.String()+".updates", data)
+}
+
+// PublishDeleted tells the collab service to disconnect the document's
+// clients and refuse new ones.
+func (p *Publisher) PublishDeleted(ctx context.Context, docID uuid.UUID) error {
+	return p.publishLifecycle(ctx, docID, "deleted")
+}
+
+// PublishRestored lets clients join the document again.
+func (p *Publisher) PublishRestored(ctx context.Context, docID uuid.UUID) error {
+	return p.publishLifecycle(ctx, docID, "restored")
+}
+
+// PublishTags tells open editors of the document about its new tags.
+func (p *Publisher) PublishTags(ctx context.Context, docID uuid.UUID, tags []string) error {
+	if p == nil || p.bus == nil {
+		return nil
+	}
+	data, err := json.Marshal(TagsMessage{Type: "tags", DocumentID: docID.String(), Tags: tags})
+	if err != nil {
+		return err
+	}
+	return p.bus.Publish(ctx, "doclet.documents."+docID.String()+".tags", data)
+}
+
+// PublishComment pushes a comment thread change to open editors.
+func (p *Publisher) PublishComment(ctx context.Context, docID uuid.UUID, event string, thread ThreadResponse) error {
+	if p == nil || p.bus == nil {
+		return nil
+	}
+	data, err := json.Marshal(CommentMessage{Type: event, DocumentID: docID.String(), Thread: thread})
+	if err != nil {
+		return err
+	}
+	return p.bus.Publish(ctx, "doclet.documents."+docID.String()+".comments", data)
+}
+
+// PublishSuggestion tells open editors about a suggestion change.
+func (p *Publisher) PublishSuggestion(ctx context.Context, docID uuid.UUID, event string, suggestion SuggestionResponse) error {
+	if p == nil || p.bus == nil {
+		return nil
+	}
+	data, err := json.Marshal(SuggestionMessage{Type: event, DocumentID: docID.String(), Suggestion: suggestion})
+	if err != nil {
+		return err
+	}
+	return p.bus.Publish(ctx, "doclet.documents."+docID.String()+".suggestions", data)
+}
+
+func (p *Publisher) publishLifecycle(ctx context.Context, docID uuid.UUID, event string) error {
+	if p == nil || p.bus == nil {
+		return nil
+	}
+	data, err := json.Marshal(LifecycleMessage{Type: "document_" + event, DocumentID: docID.String()})
+	if err != nil {
+		return err
+	}
+	return p.bus.Publish(ctx, "doclet.documents."+docID.String()+"."+event, data)
+}
+
+// StartConsumers subscribes to the snapshot, update and suggestion streams
+// published by the collab service. Brokers that support durable consumers (NATS with
+// JetStream) deliver what was published while the service was down once it
+// is back.
+func StartConsumers(ctx context.Context, store *Store, bus broker.Broker) error {
+	handleSuggest := func(ctx context.Context, store *Store, data []byte) error {
+		return handleSuggestion(ctx, store, NewPublisher(bus), data)
+	}
+	handlers := []struct {
+		durable string
+		subject string
+		span    string
+		handle  func(context.Context, *Store, []byte) error
+	}{
+		{durable: "document-snapshots", subject: "doclet.documents.*.snapshots", span: "document.handleSnapshot", handle: handleSnapshot},
+		{durable: "document-updates", subject: "doclet.documents.*.updates", span: "document.handleUpdate", handle: handleUpdate},
+		{durable: "document-suggestions", subject: "doclet.documents.*.suggest", span: "document.handleSuggestion", handle: handleSuggest},
+	}
+
+	durable, isDurable := bus.(broker.DurableSubscriber)
+	for _, h := range handlers {
+		// Handlers continue the trace of the message but stop with the
+		// service, not with whatever the publisher's context was.
+		consume := func(msgCtx context.Context, data []byte) error {
+			ctx, span := tracer.Start(trace.ContextWithSpan(ctx, trace.SpanFromContext(msgCtx)), h.span)
+			defer span.End()
+			err := h.handle(ctx, store, data)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+		if isDurable {
+			if err := durable.SubscribeDurable(ctx, h.durable, h.subject, consume); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := bus.Subscribe(h.subject, func(msgCtx context.Context, _ string, data []byte) {
+			_ = consume(msgCtx, data)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSnapshot stores a snapshot message. It only returns an error when
+// retrying the message could succeed.
+func handleSnapshot(ctx context.Context, store *Store, data []byte) error {
+	var payload SnapshotMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("snapshot decode error: %v", err)
+		return nil
+	}
+	docID, err := uuid.Parse(payload.DocumentID)
+	if err != nil {
+		log.Printf("snapshot invalid document_id: %v", err)
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("doclet.document_id", docID.String()))
+	encoded := payload.Content
+	if encoded == "" {
+		encoded = payload.Payload
+	}
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err == nil {
+		_, err = yjs.DecodeUpdate(content)
+	}
+	if err != nil {
+		log.Printf("snapshot invalid content: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := store.UpdateContent(ctx, docID, content); err != nil {
+		if IsNotFound(err) {
+			log.Printf("snapshot ignored missing document: %s", docID)
+			return nil
+		}
+		if IsStaleSnapshot(err) {
+			log.Printf("snapshot rejected stale state for document: %s", docID)
+			return nil
+		}
+		log.Printf("snapshot update error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// handleUpdate appends an update message to the update log. It only returns
+// an error when retrying the message could succeed.
+func handleUpdate(ctx context.Context, store *Store, data []byte) error {
+	var payload UpdateMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("update decode error: %v", err)
+		return nil
+	}
+	if payload.Origin == serviceOrigin {
+		return nil
+	}
+	docID, err := uuid.Parse(payload.DocumentID)
+	if err != nil {
+		log.Printf("update invalid document_id: %v", err)
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("doclet.document_id", docID.String()))
+	update, err := base64.StdEncoding.DecodeString(payload.Payload)
+	if err == nil {
+		_, err = yjs.DecodeUpdate(update)
+	}
+	if err != nil {
+		log.Printf("update invalid payload: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := store.AppendUpdate(ctx, docID, payload.ClientID, update); err != nil {
+		if IsNotFound(err) {
+			log.Printf("update ignored missing document: %s", docID)
+			return nil
+		}
+		log.Printf("update log error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// handleSuggestion stores the edits of a suggesting collab client as a
+// pending suggestion and announces it. It only returns an error when
+// retrying the message could succeed.
+func handleSuggestion(ctx context.Context, store *Store, events *Publisher, data []byte) error {
+	var payload UpdateMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("suggestion decode error: %v", err)
+		return nil
+	}
+	docID, err := uuid.Parse(payload.DocumentID)
+	if err != nil {
+		log.Printf("suggestion invalid document_id: %v", err)
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("doclet.document_id", docID.String()))
+	update, err := base64.StdEncoding.DecodeString(payload.Payload)
+	if err == nil {
+		_, err = yjs.DecodeUpdate(update)
+	}
+	if err != nil {
+		log.Printf("suggestion invalid payload: %v", err)
+		return nil
+	}
+
+	if payload.AuthorID == "" {
+		log.Printf("suggestion without author for %s", docID)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	suggestion, err := store.CreateSuggestion(ctx, docID, payload.AuthorID, update)
+	if err != nil {
+		if IsNotFound(err) {
+			log.Printf("suggestion ignored missing document: %s", docID)
+			return nil
+		}
+		log.Printf("suggestion store error: %v", err)
+		return err
+	}
+	if err := events.PublishSuggestion(ctx, docID, SuggestionCreated, suggestionToResponse(suggestion)); err != nil {
+		log.Printf("publish suggestion error: %v", err)
+	}
+	return nil
+}
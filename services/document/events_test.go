@@ -0,0 +1,78 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func message(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestHandleSnapshot(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, paragraph(1, "stored"))
+	snapshot := func(content []byte) []byte {
+		return message(t, SnapshotMessage{DocumentID: doc.DocumentID.String(), Payload: base64.StdEncoding.EncodeToString(content)})
+	}
+
+	// Messages that can never be stored are acknowledged, not retried.
+	for name, data := range map[string][]byte{
+		"json":    []byte("{"),
+		"id":      message(t, SnapshotMessage{DocumentID: "nope"}),
+		"base64":  message(t, SnapshotMessage{DocumentID: doc.DocumentID.String(), Payload: "!"}),
+		"yjs":     snapshot([]byte{0x05, 0x01}),
+		"stale":   snapshot(paragraph(2, "other")),
+		"missing": message(t, SnapshotMessage{DocumentID: "5b0a8c4e-3d1f-4b7a-9e2c-6f8d1a0b3c5e", Payload: base64.StdEncoding.EncodeToString(paragraph(2, "x"))}),
+	} {
+		if err := handleSnapshot(ctx, s, data); err != nil {
+			t.Errorf("%s: handleSnapshot = %v, want nil", name, err)
+		}
+	}
+
+	merged, err := mergeUpdates(paragraph(1, "stored"), []DocumentUpdate{{Update: paragraph(2, "snapshot")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handleSnapshot(ctx, s, snapshot(merged)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetDocument(ctx, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := extractText(got.Content); !strings.Contains(text, "snapshot") || !strings.Contains(text, "stored") {
+		t.Errorf("content text = %q, want stored and snapshot", text)
+	}
+}
+
+func TestHandleUpdateSkipsInvalidUpdates(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, nil)
+	update := func(payload []byte) []byte {
+		return message(t, UpdateMessage{Type: "yjs_update", DocumentID: doc.DocumentID.String(), ClientID: "c", Payload: base64.StdEncoding.EncodeToString(payload)})
+	}
+
+	if err := handleUpdate(ctx, s, update([]byte{0x05, 0x01})); err != nil {
+		t.Errorf("handleUpdate of an invalid update = %v, want nil", err)
+	}
+	if n := pendingCount(t, s, doc); n != 0 {
+		t.Fatalf("invalid update was logged (%d updates)", n)
+	}
+	if err := handleUpdate(ctx, s, update(paragraph(2, "ok"))); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingCount(t, s, doc); n != 1 {
+		t.Errorf("%d updates logged, want 1", n)
+	}
+}
@@ -0,0 +1,415 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"doclet/shared/yjs"
+)
+
+const (
+	ExportMarkdown = "markdown"
+	ExportHTML     = "html"
+	ExportText     = "text"
+)
+
+// fragmentName is the XmlFragment TipTap's Collaboration extension edits.
+const fragmentName = "default"
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ExportContentTypes maps export formats to their response content types.
+var ExportContentTypes = map[string]string{
+	ExportMarkdown: "text/markdown; charset=utf-8",
+	ExportHTML:     "text/html; charset=utf-8",
+	ExportText:     "text/plain; charset=utf-8",
+}
+
+// Export renders a document's Yjs state in the given format.
+func Export(content []byte, format string) (string, error) {
+	if _, ok := ExportContentTypes[format]; !ok {
+		return "", ErrUnknownFormat
+	}
+	doc := yjs.NewDoc()
+	if len(content) > 0 {
+		if err := doc.ApplyUpdate(content); err != nil {
+			return "", fmt.Errorf("decode content: %w", err)
+		}
+	}
+	nodes := doc.XmlFragment(fragmentName)
+	var out string
+	switch format {
+	case ExportMarkdown:
+		out = markdownBlocks(nodes)
+	case ExportHTML:
+		out = htmlBlocks(nodes)
+	case ExportText:
+		out = textBlocks(nodes)
+	}
+	if out == "" {
+		return "", nil
+	}
+	return out + "\n", nil
+}
+
+func markdownBlocks(nodes []*yjs.XmlNode) string {
+	blocks := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		blocks = append(blocks, markdownBlock(n))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func markdownBlock(n *yjs.XmlNode) string {
+	switch n.Name {
+	case "paragraph":
+		return renderInline(n.Children, markdownInline)
+	case "heading":
+		level := min(max(attrInt(n.Attrs, "level", 1), 1), 6)
+		return strings.Repeat("#", level) + " " + renderInline(n.Children, markdownInline)
+	case "blockquote":
+		return prefixLines(markdownBlocks(n.Children), "> ", "> ")
+	case "bulletList", "orderedList":
+		start := attrInt(n.Attrs, "start", 1)
+		items := make([]string, 0, len(n.Children))
+		for i, item := range n.Children {
+			marker := "- "
+			if n.Name == "orderedList" {
+				marker = fmt.Sprintf("%d. ", start+i)
+			}
+			items = append(items, prefixLines(listItemBlocks(item.Children, markdownBlock), marker, strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+	case "codeBlock":
+		lang, _ := n.Attrs["language"].(string)
+		return "```" + lang + "\n" + plainText(n.Children) + "\n```"
+	case "horizontalRule":
+		return "---"
+	}
+	if n.IsText() {
+		return renderInline([]*yjs.XmlNode{n}, markdownInline)
+	}
+	return markdownBlocks(n.Children)
+}
+
+func htmlBlocks(nodes []*yjs.XmlNode) string {
+	blocks := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		blocks = append(blocks, htmlBlock(n))
+	}
+	return strings.Join(blocks, "\n")
+}
+
+func htmlBlock(n *yjs.XmlNode) string {
+	switch n.Name {
+	case "paragraph":
+		return "<p>" + renderInline(n.Children, htmlInline) + "</p>"
+	case "heading":
+		level := min(max(attrInt(n.Attrs, "level", 1), 1), 6)
+		return fmt.Sprintf("<h%d>%s</h%d>", level, renderInline(n.Children, htmlInline), level)
+	case "blockquote":
+		return "<blockquote>\n" + htmlBlocks(n.Children) + "\n</blockquote>"
+	case "bulletList":
+		return "<ul>\n" + htmlBlocks(n.Children) + "\n</ul>"
+	case "orderedList":
+		if start := attrInt(n.Attrs, "start", 1); start != 1 {
+			return fmt.Sprintf("<ol start=\"%d\">\n%s\n</ol>", start, htmlBlocks(n.Children))
+		}
+		return "<ol>\n" + htmlBlocks(n.Children) + "\n</ol>"
+	case "listItem":
+		return "<li>" + htmlBlocks(n.Children) + "</li>"
+	case "codeBlock":
+		code := html.EscapeString(plainText(n.Children))
+		if lang, _ := n.Attrs["language"].(string); lang != "" {
+			return fmt.Sprintf("<pre><code class=\"language-%s\">%s</code></pre>", html.EscapeString(lang), code)
+		}
+		return "<pre><code>" + code + "</code></pre>"
+	case "horizontalRule":
+		return "<hr>"
+	}
+	if n.IsText() {
+		return renderInline([]*yjs.XmlNode{n}, htmlInline)
+	}
+	return htmlBlocks(n.Children)
+}
+
+func textBlocks(nodes []*yjs.XmlNode) string {
+	blocks := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		blocks = append(blocks, textBlock(n))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func textBlock(n *yjs.XmlNode) string {
+	switch n.Name {
+	case "bulletList", "orderedList":
+		start := attrInt(n.Attrs, "start", 1)
+		items := make([]string, 0, len(n.Children))
+		for i, item := range n.Children {
+			marker := "- "
+			if n.Name == "orderedList" {
+				marker = fmt.Sprintf("%d. ", start+i)
+			}
+			items = append(items, prefixLines(listItemBlocks(item.Children, textBlock), marker, strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+	case "blockquote":
+		return textBlocks(n.Children)
+	case "horizontalRule":
+		return "---"
+	}
+	return plainText([]*yjs.XmlNode{n})
+}
+
+// listItemBlocks renders the blocks of a list item, keeping nested lists
+// directly below the preceding block so the list stays tight.
+func listItemBlocks(nodes []*yjs.XmlNode, render func(*yjs.XmlNode) string) string {
+	var b strings.Builder
+	for i, n := range nodes {
+		if i > 0 {
+			if n.Name == "bulletList" || n.Name == "orderedList" {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(render(n))
+	}
+	return b.String()
+}
+
+// plainText concatenates the text below nodes, turning hard breaks into
+// newlines.
+func plainText(nodes []*yjs.XmlNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if n.Name == "hardBreak" {
+			b.WriteString("\n")
+			continue
+		}
+		for _, run := range n.Runs {
+			b.WriteString(run.Text)
+		}
+		b.WriteString(plainText(n.Children))
+	}
+	return b.String()
+}
+
+// prefixLines puts first before the first line of s and rest before the
+// others, leaving blank lines without trailing spaces.
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func attrInt(attrs map[string]any, key string, fallback int) int {
+	switch v := attrs[key].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case float32:
+		return int(v)
+	case int:
+		return v
+	}
+	return fallback
+}
+
+// markOrder lists the supported TipTap marks from outermost to innermost.
+var markOrder = []string{"link", "bold", "italic", "underline", "strike", "code"}
+
+type mark struct {
+	name  string
+	attrs any
+}
+
+// inlineSyntax describes how one output format spells marks and text.
+type inlineSyntax struct {
+	open      func(m mark) string
+	close     func(m mark) string
+	text      func(s string, code bool) string
+	hardBreak string
+}
+
+var markdownInline = inlineSyntax{
+	open: func(m mark) string {
+		switch m.name {
+		case "link":
+			return "["
+		case "bold":
+			return "**"
+		case "italic":
+			return "*"
+		case "underline":
+			return "<u>"
+		case "strike":
+			return "~~"
+		case "code":
+			return "`"
+		}
+		return ""
+	},
+	close: func(m mark) string {
+		switch m.name {
+		case "link":
+			return "](" + markdownHrefEscaper.Replace(markAttr(m, "href")) + ")"
+		case "bold":
+			return "**"
+		case "italic":
+			return "*"
+		case "underline":
+			return "</u>"
+		case "strike":
+			return "~~"
+		case "code":
+			return "`"
+		}
+		return ""
+	},
+	text: func(s string, code bool) string {
+		if code {
+			return s
+		}
+		return markdownEscaper.Replace(s)
+	},
+	hardBreak: "\\\n",
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `*`, `\*`, `_`, `\_`, "`", "\\`", `[`, `\[`, `]`, `\]`, `<`, `\<`,
+)
+
+// markdownHrefEscaper keeps link destinations from ending the link early.
+var markdownHrefEscaper = strings.NewReplacer(`(`, "%28", `)`, "%29", " ", "%20")
+
+var htmlInline = inlineSyntax{
+	open: func(m mark) string {
+		switch m.name {
+		case "link":
+			return `<a href="` + html.EscapeString(markAttr(m, "href")) + `">`
+		case "bold":
+			return "<strong>"
+		case "italic":
+			return "<em>"
+		case "underline":
+			return "<u>"
+		case "strike":
+			return "<s>"
+		case "code":
+			return "<code>"
+		}
+		return ""
+	},
+	close: func(m mark) string {
+		switch m.name {
+		case "link":
+			return "</a>"
+		case "bold":
+			return "</strong>"
+		case "italic":
+			return "</em>"
+		case "underline":
+			return "</u>"
+		case "strike":
+			return "</s>"
+		case "code":
+			return "</code>"
+		}
+		return ""
+	},
+	text: func(s string, _ bool) string {
+		return html.EscapeString(s)
+	},
+	hardBreak: "<br>",
+}
+
+// safeHref reports whether href may be used as a link: only absolute http,
+// https and mailto URLs are, so javascript: and data: links are dropped.
+func safeHref(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func markAttr(m mark, key string) string {
+	attrs, _ := m.attrs.(map[string]any)
+	value, _ := attrs[key].(string)
+	return value
+}
+
+// renderInline writes the runs of text nodes, keeping marks open across
+// runs that share them so adjacent bold runs become one bold span.
+func renderInline(nodes []*yjs.XmlNode, syntax inlineSyntax) string {
+	var b strings.Builder
+	var open []mark
+	closeTo := func(n int) {
+		for len(open) > n {
+			b.WriteString(syntax.close(open[len(open)-1]))
+			open = open[:len(open)-1]
+		}
+	}
+	for _, n := range nodes {
+		if n.Name == "hardBreak" {
+			b.WriteString(syntax.hardBreak)
+			continue
+		}
+		for _, run := range n.Runs {
+			var marks []mark
+			for _, name := range markOrder {
+				attrs, ok := run.Format[name]
+				if !ok {
+					continue
+				}
+				m := mark{name: name, attrs: attrs}
+				if name == "link" && !safeHref(markAttr(m, "href")) {
+					// Keep the text of links with other schemes.
+					continue
+				}
+				marks = append(marks, m)
+			}
+			keep := 0
+			for keep < len(open) && keep < len(marks) && reflect.DeepEqual(open[keep], marks[keep]) {
+				keep++
+			}
+			closeTo(keep)
+			// Leading spaces go before newly opened marks; Markdown does not
+			// allow "** bold**".
+			text := run.Text
+			if keep < len(marks) {
+				trimmed := strings.TrimLeft(text, " ")
+				b.WriteString(syntax.text(text[:len(text)-len(trimmed)], false))
+				text = trimmed
+			}
+			for _, m := range marks[keep:] {
+				b.WriteString(syntax.open(m))
+				open = append(open, m)
+			}
+			code := len(open) > 0 && open[len(open)-1].name == "code"
+			b.WriteString(syntax.text(text, code))
+		}
+	}
+	closeTo(0)
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package document
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"doclet/shared/yjs"
+)
+
+func linkContent(text, href string) []byte {
+	return yjs.EncodeXmlFragment(fragmentName, 1, []*yjs.XmlNode{{
+		Name: "paragraph",
+		Children: []*yjs.XmlNode{{Runs: []yjs.TextRun{{
+			Text:   text,
+			Format: map[string]any{"link": map[string]any{"href": href}},
+		}}}},
+	}})
+}
+
+func TestExportLinks(t *testing.T) {
+	tests := []struct {
+		href     string
+		markdown string
+		html     string
+	}{
+		{"https://example.com/a", "[site](https://example.com/a)\n", `<p><a href="https://example.com/a">site</a></p>` + "\n"},
+		{"mailto:a@example.com", "[site](mailto:a@example.com)\n", `<p><a href="mailto:a@example.com">site</a></p>` + "\n"},
+		{"https://example.com/a (b)", "[site](https://example.com/a%20%28b%29)\n", `<p><a href="https://example.com/a (b)">site</a></p>` + "\n"},
+		{"javascript:alert(1)", "site\n", "<p>site</p>\n"},
+		{"JavaScript:alert(1)", "site\n", "<p>site</p>\n"},
+		{"data:text/html,<script>alert(1)</script>", "site\n", "<p>site</p>\n"},
+		{" javascript:alert(1)", "site\n", "<p>site</p>\n"},
+		{"/relative", "site\n", "<p>site</p>\n"},
+	}
+	for _, tt := range tests {
+		content := linkContent("site", tt.href)
+		if got, err := Export(content, ExportMarkdown); err != nil || got != tt.markdown {
+			t.Errorf("markdown for %q = %q, %v; want %q", tt.href, got, err, tt.markdown)
+		}
+		if got, err := Export(content, ExportHTML); err != nil || got != tt.html {
+			t.Errorf("html for %q = %q, %v; want %q", tt.href, got, err, tt.html)
+		}
+	}
+}
+
+func TestExportHeaders(t *testing.T) {
+	store, ts := newTestServer(t)
+	doc := createTestDocument(t, store, linkContent("site", "javascript:alert(1)"))
+	token := ownerToken(t, store, doc)
+
+	resp := get(t, ts, "/documents/"+doc.DocumentID.String()+"/export?format=html", token)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":            "text/html; charset=utf-8",
+		"Content-Disposition":     `attachment; filename=Test.html`,
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "javascript") {
+		t.Errorf("body = %q, want the link dropped", body)
+	}
+}
+
+func TestExportDisposition(t *testing.T) {
+	for title, want := range map[string]string{
+		"Notes":          `attachment; filename=Notes.md`,
+		`a"b\c/d` + "\n": `attachment; filename=a_b_c_d_.md`,
+		"Café":           `attachment; filename*=utf-8''Caf%C3%A9.md`,
+		"":               `attachment; filename=document.md`,
+	} {
+		if got := exportDisposition(title, ExportMarkdown); got != want {
+			t.Errorf("exportDisposition(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFolderNotFound is returned when a referenced folder does not exist,
+	// as opposed to the document or folder being acted on.
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrFolderCycle is returned when a folder would be moved into itself or
+	// one of its descendants.
+	ErrFolderCycle = errors.New("folder cannot contain itself")
+	// ErrWorkspaceMismatch is returned when a folder would be moved into a
+	// folder of another workspace.
+	ErrWorkspaceMismatch = errors.New("folder belongs to another workspace")
+	ErrWorkspaceNotEmpty = errors.New("workspace has folders")
+)
+
+// CreateWorkspace creates a workspace and the token that manages it.
+func (s *Store) CreateWorkspace(ctx context.Context, name string) (Workspace, WorkspaceToken, error) {
+	ws := Workspace{WorkspaceID: uuid.New(), Name: name}
+	var token WorkspaceToken
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ws).Error; err != nil {
+			return err
+		}
+		var err error
+		token, err = createWorkspaceToken(tx, ws.WorkspaceID)
+		return err
+	})
+	if err != nil {
+		return Workspace{}, WorkspaceToken{}, err
+	}
+	return ws, token, nil
+}
+
+func createWorkspaceToken(db *gorm.DB, id uuid.UUID) (WorkspaceToken, error) {
+	raw, err := newToken()
+	if err != nil {
+		return WorkspaceToken{}, err
+	}
+	token := WorkspaceToken{Token: raw, WorkspaceID: id}
+	if err := db.Create(&token).Error; err != nil {
+		return WorkspaceToken{}, err
+	}
+	return token, nil
+}
+
+// ListWorkspaces lists the workspaces one of tokens manages.
+func (s *Store) ListWorkspaces(ctx context.Context, tokens []string) ([]Workspace, error) {
+	workspaces := []Workspace{}
+	if len(tokens) == 0 {
+		return workspaces, nil
+	}
+	db := s.db.WithContext(ctx)
+	held := db.Model(&WorkspaceToken{}).Select("workspace_id").Where("token IN ?", tokens)
+	if err := db.Where("workspace_id IN (?)", held).
+		Order("name asc, workspace_id asc").
+		Find(&workspaces).Error; err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// ResolveWorkspace returns nil when token manages the workspace, and
+// access.ErrDenied when it does not.
+func (s *Store) ResolveWorkspace(ctx context.Context, id uuid.UUID, token string) error {
+	db := s.db.WithContext(ctx)
+	if _, err := s.getWorkspace(db, id); err != nil {
+		return err
+	}
+	if token == "" {
+		return access.ErrDenied
+	}
+	var held WorkspaceToken
+	err := db.First(&held, "workspace_id = ? AND token = ?", id, token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return access.ErrDenied
+	}
+	return err
+}
+
+// mintWorkspaceTokens gives every workspace without a token, which were
+// created before workspaces had them, a token. Operators hand these out
+// from the workspace_tokens table.
+func mintWorkspaceTokens(db *gorm.DB) error {
+	var ids []uuid.UUID
+	if err := db.Model(&Workspace{}).
+		Where("workspace_id NOT IN (?)", db.Model(&WorkspaceToken{}).Select("workspace_id")).
+		Pluck("workspace_id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := createWorkspaceToken(db, id); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("minted tokens for %d workspaces without one", len(ids))
+	}
+	return nil
+}
+
+func (s *Store) GetWorkspace(ctx context.Context, id uuid.UUID) (Workspace, error) {
+	var ws Workspace
+	if err := s.db.WithContext(ctx).First(&ws, "workspace_id = ?", id).Error; err != nil {
+		return Workspace{}, err
+	}
+	return ws, nil
+}
+
+func (s *Store) RenameWorkspace(ctx context.Context, id uuid.UUID, name string) (Workspace, error) {
+	result := s.db.WithContext(ctx).Model(&Workspace{}).
+		Where("workspace_id = ?", id).
+		Updates(map[string]interface{}{"name": name, "updated_at": time.Now().UTC()})
+	if result.Error != nil {
+		return Workspace{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Workspace{}, gorm.ErrRecordNotFound
+	}
+	return s.GetWorkspace(ctx, id)
+}
+
+// DeleteWorkspace deletes an empty workspace.
+func (s *Store) DeleteWorkspace(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Folder{}).Where("workspace_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrWorkspaceNotEmpty
+		}
+		result := tx.Delete(&Workspace{}, "workspace_id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Delete(&WorkspaceToken{}, "workspace_id = ?", id).Error
+	})
+}
+
+// CreateFolder adds a folder to the workspace, inside parentID when it is
+// not nil.
+func (s *Store) CreateFolder(ctx context.Context, workspaceID uuid.UUID, parentID *uuid.UUID, name string) (Folder, error) {
+	folder := Folder{FolderID: uuid.New(), WorkspaceID: workspaceID, ParentID: parentID, Name: name}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.getWorkspace(tx, workspaceID); err != nil {
+			return err
+		}
+		if parentID != nil {
+			parent, err := getFolder(tx, *parentID)
+			if err != nil {
+				return err
+			}
+			if parent.WorkspaceID != workspaceID {
+				return ErrWorkspaceMismatch
+			}
+		}
+		return tx.Create(&folder).Error
+	})
+	if err != nil {
+		return Folder{}, err
+	}
+	return folder, nil
+}
+
+// ListFolders lists every folder of the workspace; clients build the tree
+// from ParentID.
+func (s *Store) ListFolders(ctx context.Context, workspaceID uuid.UUID) ([]Folder, error) {
+	db := s.db.WithContext(ctx)
+	if _, err := s.getWorkspace(db, workspaceID); err != nil {
+		return nil, err
+	}
+	var folders []Folder
+	if err := db.Where("workspace_id = ?", workspaceID).
+		Order("name asc, folder_id asc").
+		Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (s *Store) GetFolder(ctx context.Context, id uuid.UUID) (Folder, error) {
+	var folder Folder
+	if err := s.db.WithContext(ctx).First(&folder, "folder_id = ?", id).Error; err != nil {
+		return Folder{}, err
+	}
+	return folder, nil
+}
+
+func (s *Store) RenameFolder(ctx context.Context, id uuid.UUID, name string) (Folder, error) {
+	result := s.db.WithContext(ctx).Model(&Folder{}).
+		Where("folder_id = ?", id).
+		Updates(map[string]interface{}{"name": name, "updated_at": time.Now().UTC()})
+	if result.Error != nil {
+		return Folder{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Folder{}, gorm.ErrRecordNotFound
+	}
+	return s.GetFolder(ctx, id)
+}
+
+// MoveFolder moves the folder into parentID, or to the top of its workspace
+// when parentID is nil.
+func (s *Store) MoveFolder(ctx context.Context, id uuid.UUID, parentID *uuid.UUID) (Folder, error) {
+	var folder Folder
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.forUpdate(tx).First(&folder, "folder_id = ?", id).Error; err != nil {
+			return err
+		}
+		if parentID != nil {
+			// Walk up from the new parent; meeting the folder means a cycle.
+			for next := parentID; next != nil; {
+				if *next == id {
+					return ErrFolderCycle
+				}
+				ancestor, err := getFolder(tx, *next)
+				if err != nil {
+					return err
+				}
+				if ancestor.WorkspaceID != folder.WorkspaceID {
+					return ErrWorkspaceMismatch
+				}
+				next = ancestor.ParentID
+			}
+		}
+		folder.ParentID = parentID
+		folder.UpdatedAt = time.Now().UTC()
+		return tx.Model(&Folder{}).
+			Where("folder_id = ?", id).
+			Updates(map[string]interface{}{"parent_id": parentID, "updated_at": folder.UpdatedAt}).Error
+	})
+	if err != nil {
+		return Folder{}, err
+	}
+	return folder, nil
+}
+
+// DeleteFolder removes the folder. Its documents and subfolders move up to
+// its parent, so nothing is lost.
+func (s *Store) DeleteFolder(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var folder Folder
+		if err := s.forUpdate(tx).First(&folder, "folder_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Folder{}).
+			Where("parent_id = ?", id).
+			Update("parent_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Document{}).
+			Where("folder_id = ?", id).
+			UpdateColumn("folder_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Folder{}, "folder_id = ?", id).Error
+	})
+}
+
+// MoveDocument files the document in folderID, or unfiles it when folderID
+// is nil.
+func (s *Store) MoveDocument(ctx context.Context, id uuid.UUID, folderID *uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if folderID != nil {
+			if _, err := getFolder(tx, *folderID); err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&Document{}).
+			Where("document_id = ?", id).
+			Updates(map[string]interface{}{"folder_id": folderID, "updated_at": time.Now().UTC()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (s *Store) getWorkspace(db *gorm.DB, id uuid.UUID) (Workspace, error) {
+	var ws Workspace
+	err := db.First(&ws, "workspace_id = ?", id).Error
+	return ws, err
+}
+
+// getFolder loads a folder referenced by another object, reporting a missing
+// one as ErrFolderNotFound.
+func getFolder(db *gorm.DB, id uuid.UUID) (Folder, error) {
+	var folder Folder
+	err := db.First(&folder, "folder_id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Folder{}, ErrFolderNotFound
+	}
+	return folder, err
+}
@@ -0,0 +1,122 @@
+package document
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// createTestWorkspace creates a workspace with one folder over HTTP and
+// returns their IDs and the workspace token.
+func createTestWorkspace(t *testing.T, ts *httptest.Server, name string) (string, string, string) {
+	t.Helper()
+	resp := request(t, ts, http.MethodPost, "/workspaces", "", map[string]string{"name": name})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create workspace: status %d", resp.StatusCode)
+	}
+	var ws WorkspaceResponse
+	decode(t, resp, &ws)
+	if ws.Token == "" {
+		t.Fatal("create workspace returned no token")
+	}
+	resp = request(t, ts, http.MethodPost, "/workspaces/"+ws.WorkspaceID+"/folders", ws.Token, map[string]string{"name": "folder"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create folder: status %d", resp.StatusCode)
+	}
+	var folder FolderResponse
+	decode(t, resp, &folder)
+	return ws.WorkspaceID, folder.FolderID, ws.Token
+}
+
+func TestWorkspaceRoutesNeedToken(t *testing.T) {
+	_, ts := newTestServer(t)
+	wsID, folderID, token := createTestWorkspace(t, ts, "mine")
+	_, _, foreign := createTestWorkspace(t, ts, "theirs")
+
+	routes := []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{http.MethodGet, "/workspaces/" + wsID, nil, http.StatusOK},
+		{http.MethodPut, "/workspaces/" + wsID, map[string]string{"name": "renamed"}, http.StatusOK},
+		{http.MethodGet, "/workspaces/" + wsID + "/folders", nil, http.StatusOK},
+		{http.MethodPost, "/workspaces/" + wsID + "/folders", map[string]string{"name": "child"}, http.StatusCreated},
+		{http.MethodGet, "/folders/" + folderID, nil, http.StatusOK},
+		{http.MethodPut, "/folders/" + folderID + "/name", map[string]string{"name": "renamed"}, http.StatusOK},
+		{http.MethodPut, "/folders/" + folderID + "/parent", map[string]any{"parent_id": nil}, http.StatusOK},
+		{http.MethodDelete, "/folders/" + folderID, nil, http.StatusNoContent},
+		{http.MethodDelete, "/workspaces/" + wsID, nil, http.StatusConflict},
+	}
+	for _, rt := range routes {
+		for _, tt := range []struct {
+			name  string
+			token string
+			want  int
+		}{
+			{"no token", "", http.StatusUnauthorized},
+			{"foreign token", foreign, http.StatusForbidden},
+			{"workspace token", token, rt.want},
+		} {
+			if resp := request(t, ts, rt.method, rt.path, tt.token, rt.body); resp.StatusCode != tt.want {
+				t.Errorf("%s %s with %s: status %d, want %d", rt.method, rt.path, tt.name, resp.StatusCode, tt.want)
+			}
+		}
+	}
+}
+
+func TestListWorkspacesScopedToTokens(t *testing.T) {
+	_, ts := newTestServer(t)
+	wsID, _, token := createTestWorkspace(t, ts, "mine")
+	createTestWorkspace(t, ts, "theirs")
+
+	for _, tt := range []struct {
+		token string
+		want  []string
+	}{
+		{"", nil},
+		{"unknown", nil},
+		{token, []string{wsID}},
+	} {
+		var list struct {
+			Items []WorkspaceResponse `json:"items"`
+		}
+		decode(t, get(t, ts, "/workspaces", tt.token), &list)
+		var got []string
+		for _, ws := range list.Items {
+			got = append(got, ws.WorkspaceID)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("workspaces with token %q = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestMintWorkspaceTokens(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	legacy, _, err := s.CreateWorkspace(ctx, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Where("workspace_id = ?", legacy.WorkspaceID).Delete(&WorkspaceToken{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateWorkspace(ctx, "current"); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := mintWorkspaceTokens(s.db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tokens []WorkspaceToken
+	if err := s.db.Find(&tokens).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("got %d workspace tokens, want one per workspace", len(tokens))
+	}
+}
@@ -0,0 +1,405 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ThreadAnchor holds the base64 encoded Yjs relative positions bounding a
+// thread's range.
+type ThreadAnchor struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// CommentRequest carries a comment. Its author is the share token the
+// request is made with; AuthorName is only what is displayed.
+type CommentRequest struct {
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+}
+
+type CreateThreadRequest struct {
+	CommentRequest
+	Anchor ThreadAnchor `json:"anchor"`
+	Quote  string       `json:"quote"`
+}
+
+type CommentResponse struct {
+	CommentID  string `json:"comment_id"`
+	AuthorID   string `json:"author_id"`
+	AuthorName string `json:"author_name,omitempty"`
+	Body       string `json:"body"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+type ThreadResponse struct {
+	ThreadID   string            `json:"thread_id"`
+	DocumentID string            `json:"document_id"`
+	Anchor     ThreadAnchor      `json:"anchor"`
+	Quote      string            `json:"quote,omitempty"`
+	Resolved   bool              `json:"resolved"`
+	ResolvedAt string            `json:"resolved_at,omitempty"`
+	ResolvedBy string            `json:"resolved_by,omitempty"`
+	Comments   []CommentResponse `json:"comments"`
+	CreatedAt  string            `json:"created_at"`
+	UpdatedAt  string            `json:"updated_at"`
+}
+
+// handleListThreads lists comment threads; ?status=open or resolved narrows
+// the list.
+func (s *Server) handleListThreads(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var resolved *bool
+	switch r.URL.Query().Get("status") {
+	case "", "all":
+	case "open":
+		resolved = new(bool)
+	case "resolved":
+		resolved = new(bool)
+		*resolved = true
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_status"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+
+	threads, err := s.store.ListThreads(r.Context(), docID, resolved)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("list threads error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	items := make([]ThreadResponse, 0, len(threads))
+	for _, thread := range threads {
+		items = append(items, threadToResponse(thread))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleGetThread(w http.ResponseWriter, r *http.Request) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+
+	thread, err := s.store.GetThread(r.Context(), docID, threadID)
+	if err != nil {
+		writeCommentError(w, "get thread", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, threadToResponse(thread))
+}
+
+// handleCreateThread starts a thread on a range of the document. Commenters
+// and above may comment.
+func (s *Server) handleCreateThread(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req CreateThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	start, startErr := base64.StdEncoding.DecodeString(req.Anchor.Start)
+	end, endErr := base64.StdEncoding.DecodeString(req.Anchor.End)
+	if startErr != nil || endErr != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_anchor"})
+		return
+	}
+	author, ok := s.authorizeAuthor(w, r, docID)
+	if !ok {
+		return
+	}
+
+	thread, err := s.store.CreateThread(r.Context(), docID, start, end, req.Quote, NewComment{
+		AuthorID:   author,
+		AuthorName: req.AuthorName,
+		Body:       req.Body,
+	})
+	if err != nil {
+		writeCommentError(w, "create thread", err)
+		return
+	}
+
+	resp := threadToResponse(thread)
+	s.publishComment(r.Context(), docID, CommentThreadCreated, resp)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleAddComment(w http.ResponseWriter, r *http.Request) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	author, ok := s.authorizeAuthor(w, r, docID)
+	if !ok {
+		return
+	}
+
+	thread, err := s.store.AddComment(r.Context(), docID, threadID, NewComment{
+		AuthorID:   author,
+		AuthorName: req.AuthorName,
+		Body:       req.Body,
+	})
+	if err != nil {
+		writeCommentError(w, "add comment", err)
+		return
+	}
+
+	resp := threadToResponse(thread)
+	s.publishComment(r.Context(), docID, CommentAdded, resp)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleUpdateComment edits a comment. Commenters may only edit their own
+// comments, made with the same share token; editors may edit any.
+func (s *Server) handleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := uuid.Parse(chi.URLParam(r, "comment_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_comment_id"})
+		return
+	}
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	authorID, ok := s.commentAuthor(w, r, docID)
+	if !ok {
+		return
+	}
+
+	thread, err := s.store.UpdateComment(r.Context(), docID, threadID, commentID, authorID, req.Body)
+	if err != nil {
+		writeCommentError(w, "update comment", err)
+		return
+	}
+
+	resp := threadToResponse(thread)
+	s.publishComment(r.Context(), docID, CommentUpdated, resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteComment deletes a comment under the same rules as
+// handleUpdateComment. Deleting the last comment deletes the thread.
+func (s *Server) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := uuid.Parse(chi.URLParam(r, "comment_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_comment_id"})
+		return
+	}
+	authorID, ok := s.commentAuthor(w, r, docID)
+	if !ok {
+		return
+	}
+
+	thread, err := s.store.DeleteComment(r.Context(), docID, threadID, commentID, authorID)
+	if err != nil {
+		writeCommentError(w, "delete comment", err)
+		return
+	}
+
+	if len(thread.Comments) == 0 {
+		s.publishComment(r.Context(), docID, CommentThreadDeleted, threadToResponse(thread))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := threadToResponse(thread)
+	s.publishComment(r.Context(), docID, CommentDeleted, resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleResolveThread(w http.ResponseWriter, r *http.Request) {
+	s.setThreadResolved(w, r, true)
+}
+
+func (s *Server) handleReopenThread(w http.ResponseWriter, r *http.Request) {
+	s.setThreadResolved(w, r, false)
+}
+
+func (s *Server) setThreadResolved(w http.ResponseWriter, r *http.Request, resolved bool) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	author, ok := s.authorizeAuthor(w, r, docID)
+	if !ok {
+		return
+	}
+
+	thread, err := s.store.SetThreadResolved(r.Context(), docID, threadID, resolved, author)
+	if err != nil {
+		writeCommentError(w, "resolve thread", err)
+		return
+	}
+
+	resp := threadToResponse(thread)
+	event := CommentReopened
+	if resolved {
+		event = CommentResolved
+	}
+	s.publishComment(r.Context(), docID, event, resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteThread deletes a whole thread, which only editors may do.
+func (s *Server) handleDeleteThread(w http.ResponseWriter, r *http.Request) {
+	docID, threadID, ok := threadParams(w, r)
+	if !ok {
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+
+	thread, err := s.store.DeleteThread(r.Context(), docID, threadID)
+	if err != nil {
+		writeCommentError(w, "delete thread", err)
+		return
+	}
+
+	s.publishComment(r.Context(), docID, CommentThreadDeleted, threadToResponse(thread))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeAuthor checks that the caller may comment and returns the author
+// ID of their share token.
+func (s *Server) authorizeAuthor(w http.ResponseWriter, r *http.Request, docID uuid.UUID) (string, bool) {
+	if !s.authorize(w, r, docID, access.RoleCommenter) {
+		return "", false
+	}
+	return AuthorID(shareToken(r)), true
+}
+
+// commentAuthor authorizes changing a comment and returns the author it
+// must belong to: the caller's own for commenters, or "" for editors, who
+// may change any comment.
+func (s *Server) commentAuthor(w http.ResponseWriter, r *http.Request, docID uuid.UUID) (string, bool) {
+	role, ok := s.resolveRole(w, r, docID)
+	if !ok {
+		return "", false
+	}
+	if role.CanEdit() {
+		return "", true
+	}
+	if !role.Allows(access.RoleCommenter) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return "", false
+	}
+	return AuthorID(shareToken(r)), true
+}
+
+func (s *Server) publishComment(ctx context.Context, docID uuid.UUID, event string, thread ThreadResponse) {
+	if err := s.events.PublishComment(ctx, docID, event, thread); err != nil {
+		log.Printf("publish comment error: %v", err)
+	}
+}
+
+func threadParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	threadID, err := uuid.Parse(chi.URLParam(r, "thread_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_thread_id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return docID, threadID, true
+}
+
+// writeCommentError answers a failed comment operation.
+func writeCommentError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	case errors.Is(err, ErrInvalidAnchor):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_anchor"})
+	case errors.Is(err, ErrEmptyComment):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body_required"})
+	case errors.Is(err, ErrCommentTooLong):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "comment_too_long"})
+	case errors.Is(err, ErrNotCommentAuthor):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "not_comment_author"})
+	default:
+		log.Printf("%s error: %v", action, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "comment_failed"})
+	}
+}
+
+func threadToResponse(thread CommentThread) ThreadResponse {
+	resp := ThreadResponse{
+		ThreadID:   thread.ThreadID.String(),
+		DocumentID: thread.DocumentID.String(),
+		Anchor: ThreadAnchor{
+			Start: base64.StdEncoding.EncodeToString(thread.AnchorStart),
+			End:   base64.StdEncoding.EncodeToString(thread.AnchorEnd),
+		},
+		Quote:      thread.Quote,
+		Resolved:   thread.ResolvedAt != nil,
+		ResolvedBy: thread.ResolvedBy,
+		Comments:   make([]CommentResponse, 0, len(thread.Comments)),
+		CreatedAt:  thread.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:  thread.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if thread.ResolvedAt != nil {
+		resp.ResolvedAt = thread.ResolvedAt.UTC().Format(time.RFC3339)
+	}
+	for _, comment := range thread.Comments {
+		resp.Comments = append(resp.Comments, CommentResponse{
+			CommentID:  comment.CommentID.String(),
+			AuthorID:   comment.AuthorID,
+			AuthorName: comment.AuthorName,
+			Body:       comment.Body,
+			CreatedAt:  comment.CreatedAt.UTC().Format(time.RFC3339),
+			UpdatedAt:  comment.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp
+}
@@ -0,0 +1,77 @@
+package document
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (s *Server) handleExportDocument(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportMarkdown
+	}
+	contentType, ok := ExportContentTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_format"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+	doc, err := s.store.GetDocument(r.Context(), docID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("export document error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return
+	}
+	out, err := Export(doc.Content, format)
+	if err != nil {
+		log.Printf("export document error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "export_failed"})
+		return
+	}
+
+	// Exports are downloads, never pages rendered on this origin.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", exportDisposition(doc.DisplayName, format))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, out)
+}
+
+var exportExtensions = map[string]string{
+	ExportMarkdown: ".md",
+	ExportHTML:     ".html",
+	ExportText:     ".txt",
+}
+
+// exportDisposition names the download after the document title.
+func exportDisposition(title, format string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`"\/`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	if name == "" {
+		name = "document"
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name + exportExtensions[format]})
+}
@@ -0,0 +1,470 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceResponse struct {
+	WorkspaceID string `json:"workspace_id"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	// Token manages the workspace and its folders. It is returned only when
+	// the workspace is created.
+	Token string `json:"workspace_token,omitempty"`
+}
+
+type CreateFolderRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+type RenameFolderRequest struct {
+	Name string `json:"name"`
+}
+
+// MoveFolderRequest moves a folder to the top of its workspace when ParentID
+// is null.
+type MoveFolderRequest struct {
+	ParentID *string `json:"parent_id"`
+}
+
+// MoveDocumentRequest unfiles the document when FolderID is null.
+type MoveDocumentRequest struct {
+	FolderID *string `json:"folder_id"`
+}
+
+type FolderResponse struct {
+	FolderID    string `json:"folder_id"`
+	WorkspaceID string `json:"workspace_id"`
+	ParentID    string `json:"parent_id,omitempty"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+func (s *Server) handleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name_required"})
+		return
+	}
+
+	ws, token, err := s.store.CreateWorkspace(r.Context(), name)
+	if err != nil {
+		log.Printf("create workspace error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create_failed"})
+		return
+	}
+
+	resp := workspaceToResponse(ws)
+	resp.Token = token.Token
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleListWorkspaces lists the workspaces of the tokens sent with the
+// request, which are read like those of the document list.
+func (s *Server) handleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := s.store.ListWorkspaces(r.Context(), shareTokens(r))
+	if err != nil {
+		log.Printf("list workspaces error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	items := make([]WorkspaceResponse, 0, len(workspaces))
+	for _, ws := range workspaces {
+		items = append(items, workspaceToResponse(ws))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleGetWorkspace(w http.ResponseWriter, r *http.Request) {
+	wsID, err := uuid.Parse(chi.URLParam(r, "workspace_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_workspace_id"})
+		return
+	}
+	if !s.authorizeWorkspace(w, r, wsID) {
+		return
+	}
+
+	ws, err := s.store.GetWorkspace(r.Context(), wsID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("get workspace error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaceToResponse(ws))
+}
+
+func (s *Server) handleRenameWorkspace(w http.ResponseWriter, r *http.Request) {
+	wsID, err := uuid.Parse(chi.URLParam(r, "workspace_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_workspace_id"})
+		return
+	}
+	if !s.authorizeWorkspace(w, r, wsID) {
+		return
+	}
+	var req WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name_required"})
+		return
+	}
+
+	ws, err := s.store.RenameWorkspace(r.Context(), wsID, name)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("rename workspace error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaceToResponse(ws))
+}
+
+func (s *Server) handleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	wsID, err := uuid.Parse(chi.URLParam(r, "workspace_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_workspace_id"})
+		return
+	}
+	if !s.authorizeWorkspace(w, r, wsID) {
+		return
+	}
+
+	if err := s.store.DeleteWorkspace(r.Context(), wsID); err != nil {
+		switch {
+		case IsNotFound(err):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+		case errors.Is(err, ErrWorkspaceNotEmpty):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "workspace_not_empty"})
+		default:
+			log.Printf("delete workspace error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete_failed"})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	wsID, err := uuid.Parse(chi.URLParam(r, "workspace_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_workspace_id"})
+		return
+	}
+	if !s.authorizeWorkspace(w, r, wsID) {
+		return
+	}
+	var req CreateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name_required"})
+		return
+	}
+	parentID, err := parseOptionalID(req.ParentID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_parent_id"})
+		return
+	}
+
+	folder, err := s.store.CreateFolder(r.Context(), wsID, parentID, name)
+	if err != nil {
+		if !writeFolderError(w, err) {
+			log.Printf("create folder error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create_failed"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, folderToResponse(folder))
+}
+
+func (s *Server) handleListFolders(w http.ResponseWriter, r *http.Request) {
+	wsID, err := uuid.Parse(chi.URLParam(r, "workspace_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_workspace_id"})
+		return
+	}
+	if !s.authorizeWorkspace(w, r, wsID) {
+		return
+	}
+
+	folders, err := s.store.ListFolders(r.Context(), wsID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("list folders error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	items := make([]FolderResponse, 0, len(folders))
+	for _, folder := range folders {
+		items = append(items, folderToResponse(folder))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleGetFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := uuid.Parse(chi.URLParam(r, "folder_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+		return
+	}
+	folder, ok := s.authorizeFolder(w, r, folderID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, folderToResponse(folder))
+}
+
+func (s *Server) handleRenameFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := uuid.Parse(chi.URLParam(r, "folder_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+		return
+	}
+	folder, ok := s.authorizeFolder(w, r, folderID)
+	if !ok {
+		return
+	}
+	var req RenameFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name_required"})
+		return
+	}
+
+	folder, err = s.store.RenameFolder(r.Context(), folderID, name)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("rename folder error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, folderToResponse(folder))
+}
+
+func (s *Server) handleMoveFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := uuid.Parse(chi.URLParam(r, "folder_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+		return
+	}
+	folder, ok := s.authorizeFolder(w, r, folderID)
+	if !ok {
+		return
+	}
+	var req MoveFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	parentID, err := parseOptionalID(req.ParentID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_parent_id"})
+		return
+	}
+
+	folder, err = s.store.MoveFolder(r.Context(), folderID, parentID)
+	if err != nil {
+		if !writeFolderError(w, err) {
+			log.Printf("move folder error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, folderToResponse(folder))
+}
+
+// handleDeleteFolder deletes a folder. Its documents and subfolders move up
+// to its parent.
+func (s *Server) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := uuid.Parse(chi.URLParam(r, "folder_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+		return
+	}
+	if _, ok := s.authorizeFolder(w, r, folderID); !ok {
+		return
+	}
+
+	if err := s.store.DeleteFolder(r.Context(), folderID); err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("delete folder error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete_failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMoveDocument files a document in a folder. Like renaming, it needs
+// an editor token for the document.
+func (s *Server) handleMoveDocument(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req MoveDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	folderID, err := parseOptionalID(req.FolderID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	if err := s.store.MoveDocument(r.Context(), docID, folderID); err != nil {
+		if !writeFolderError(w, err) {
+			log.Printf("move document error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// authorizeWorkspace checks that the request carries a token of the
+// workspace, answering with the error otherwise.
+func (s *Server) authorizeWorkspace(w http.ResponseWriter, r *http.Request, wsID uuid.UUID) bool {
+	token := shareToken(r)
+	return writeAccessError(w, token, s.store.ResolveWorkspace(r.Context(), wsID, token))
+}
+
+// authorizeFolder loads the folder and checks the request against its
+// workspace.
+func (s *Server) authorizeFolder(w http.ResponseWriter, r *http.Request, folderID uuid.UUID) (Folder, bool) {
+	folder, err := s.store.GetFolder(r.Context(), folderID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return Folder{}, false
+		}
+		log.Printf("get folder error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return Folder{}, false
+	}
+	if !s.authorizeWorkspace(w, r, folder.WorkspaceID) {
+		return Folder{}, false
+	}
+	return folder, true
+}
+
+// writeFolderError answers with the error matching a failed folder change
+// and reports whether it recognized err.
+func writeFolderError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrFolderNotFound):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder_not_found"})
+	case errors.Is(err, ErrFolderCycle):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "folder_cycle"})
+	case errors.Is(err, ErrWorkspaceMismatch):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "workspace_mismatch"})
+	case IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	default:
+		return false
+	}
+	return true
+}
+
+func workspaceToResponse(ws Workspace) WorkspaceResponse {
+	return WorkspaceResponse{
+		WorkspaceID: ws.WorkspaceID.String(),
+		Name:        ws.Name,
+		CreatedAt:   ws.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   ws.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func folderToResponse(folder Folder) FolderResponse {
+	return FolderResponse{
+		FolderID:    folder.FolderID.String(),
+		WorkspaceID: folder.WorkspaceID.String(),
+		ParentID:    uuidString(folder.ParentID),
+		Name:        folder.Name,
+		CreatedAt:   folder.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   folder.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// parseOptionalID parses a nullable ID from a request body.
+func parseOptionalID(value *string) (*uuid.UUID, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(*value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
@@ -0,0 +1,89 @@
+package document
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxImportSize bounds the size of imported files.
+const maxImportSize = 10 << 20
+
+// handleImportDocument creates a document from Markdown or HTML sent either
+// as the "file" field of a multipart form or as the raw request body. The
+// format comes from ?format=, the file name or the content type.
+func (s *Server) handleImportDocument(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	format := r.URL.Query().Get("format")
+	displayName := r.URL.Query().Get("displayName")
+	var filename, contentType string
+	var source []byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_form"})
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing_file"})
+			return
+		}
+		defer file.Close()
+		if source, err = io.ReadAll(file); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_file"})
+			return
+		}
+		filename, contentType = header.Filename, header.Header.Get("Content-Type")
+		if format == "" {
+			format = r.FormValue("format")
+		}
+		if displayName == "" {
+			displayName = r.FormValue("displayName")
+		}
+	} else {
+		var err error
+		if source, err = io.ReadAll(r.Body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "too_large"})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_body"})
+			return
+		}
+		contentType = r.Header.Get("Content-Type")
+	}
+	if format == "" {
+		format = ImportFormat(contentType, filename)
+	}
+	if format != ImportMarkdown && format != ImportHTML {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_format"})
+		return
+	}
+
+	content, heading, err := Import(source, format)
+	if err != nil {
+		log.Printf("import document error: %v", err)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "import_failed"})
+		return
+	}
+	if displayName == "" {
+		displayName = heading
+	}
+	if displayName == "" && filename != "" {
+		displayName = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	doc, owner, err := s.store.CreateDocument(r.Context(), displayName, content)
+	if err != nil {
+		log.Printf("create document error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create_failed"})
+		return
+	}
+
+	resp := documentToResponse(doc)
+	resp.ShareToken = owner.Token
+	writeJSON(w, http.StatusCreated, resp)
+}
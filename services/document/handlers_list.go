@@ -0,0 +1,90 @@
+package document
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DocumentListItem struct {
+	DocumentID  string   `json:"document_id"`
+	DisplayName string   `json:"displayName"`
+	UpdatedAt   string   `json:"updated_at"`
+	DeletedAt   string   `json:"deleted_at,omitempty"`
+	FolderID    string   `json:"folder_id,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Snippet is HTML with body matches of the search query in <mark>.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+type DocumentListResponse struct {
+	Items      []DocumentListItem `json:"items"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	Total      *int64             `json:"total,omitempty"`
+}
+
+// handleListDocuments lists documents a page at a time. Pages continue with
+// the opaque cursor query parameter; limit/offset paging is still accepted.
+func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := ListOptions{
+		Query:  q.Get("query"),
+		Sort:   q.Get("sort"),
+		Limit:  parseInt(q.Get("limit"), 50),
+		Offset: parseInt(q.Get("offset"), 0),
+		Cursor: q.Get("cursor"),
+		// Tags come as repeated ?tag= parameters or one comma-separated list.
+		Tags:     splitTags(q["tag"]),
+		TagMatch: q.Get("tag_match"),
+		Tokens:   shareTokens(r),
+	}
+	opts.Total, _ = strconv.ParseBool(q.Get("total"))
+	if raw := q.Get("folder_id"); raw != "" {
+		folderID, err := uuid.Parse(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_folder_id"})
+			return
+		}
+		opts.FolderID = &folderID
+	}
+
+	page, err := s.store.ListDocuments(r.Context(), opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSort):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_sort"})
+		case errors.Is(err, ErrInvalidCursor):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_cursor"})
+		case errors.Is(err, ErrInvalidTag):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_tag"})
+		case errors.Is(err, ErrInvalidTagMatch):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_tag_match"})
+		default:
+			log.Printf("list documents error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		}
+		return
+	}
+
+	items := make([]DocumentListItem, 0, len(page.Items))
+	for _, doc := range page.Items {
+		items = append(items, DocumentListItem{
+			DocumentID:  doc.DocumentID.String(),
+			DisplayName: doc.DisplayName,
+			UpdatedAt:   doc.UpdatedAt.UTC().Format(time.RFC3339),
+			FolderID:    uuidString(doc.FolderID),
+			Tags:        doc.Tags,
+			Snippet:     doc.Snippet,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, DocumentListResponse{
+		Items:      items,
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
+	})
+}
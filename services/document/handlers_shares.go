@@ -0,0 +1,228 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// AccessResponse tells the caller their role and the author ID their
+// comments are made under.
+type AccessResponse struct {
+	DocumentID string `json:"document_id"`
+	Role       string `json:"role"`
+	AuthorID   string `json:"author_id"`
+}
+
+type CreateShareRequest struct {
+	Role string `json:"role"`
+}
+
+type ShareResponse struct {
+	Token      string `json:"token"`
+	DocumentID string `json:"document_id"`
+	Role       string `json:"role"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// handleGetAccess reports the role the caller's token grants. The collab
+// service uses it to authorize WebSocket connections.
+func (s *Server) handleGetAccess(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	role, ok := s.resolveRole(w, r, docID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AccessResponse{
+		DocumentID: docID.String(),
+		Role:       string(role),
+		AuthorID:   AuthorID(shareToken(r)),
+	})
+}
+
+func (s *Server) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	role, ok := access.ParseRole(req.Role)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_role"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleOwner) {
+		return
+	}
+
+	share, err := s.store.CreateShare(r.Context(), docID, role)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("create share error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "share_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, shareToResponse(share))
+}
+
+func (s *Server) handleListShares(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleOwner) {
+		return
+	}
+
+	shares, err := s.store.ListShares(r.Context(), docID)
+	if err != nil {
+		log.Printf("list shares error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+	items := make([]ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		items = append(items, shareToResponse(share))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) handleDeleteShare(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleOwner) {
+		return
+	}
+
+	if err := s.store.DeleteShare(r.Context(), docID, chi.URLParam(r, "token")); err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		if errors.Is(err, ErrLastOwner) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "last_owner"})
+			return
+		}
+		log.Printf("delete share error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete_failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize writes an error response and returns false unless the caller's
+// share token grants at least min on the document.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, docID uuid.UUID, min access.Role) bool {
+	role, ok := s.resolveRole(w, r, docID)
+	if !ok {
+		return false
+	}
+	if !role.Allows(min) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) resolveRole(w http.ResponseWriter, r *http.Request, docID uuid.UUID) (access.Role, bool) {
+	token := shareToken(r)
+	role, err := s.store.ResolveShare(r.Context(), docID, token)
+	return role, writeAccessError(w, token, err)
+}
+
+// writeAccessError answers with the error matching a failed share lookup
+// and reports whether err was nil.
+func writeAccessError(w http.ResponseWriter, token string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	case errors.Is(err, access.ErrDenied) && token == "":
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing_token"})
+	case errors.Is(err, access.ErrDenied):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+	default:
+		log.Printf("resolve share error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "access_failed"})
+	}
+	return false
+}
+
+// shareToken reads the share token from a bearer Authorization header or
+// the token query parameter, which share links use.
+func shareToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("token")
+}
+
+// maxListTokens bounds how many share tokens one listing request may carry.
+const maxListTokens = 1000
+
+// shareTokens returns the share tokens a listing request carries, as a
+// comma-separated Authorization bearer value or repeated ?token= values.
+func shareTokens(r *http.Request) []string {
+	var values []string
+	if list, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		values = strings.Split(list, ",")
+	}
+	values = append(values, r.URL.Query()["token"]...)
+	var tokens []string
+	for _, token := range values {
+		if len(tokens) == maxListTokens {
+			break
+		}
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func shareToResponse(share ShareToken) ShareResponse {
+	return ShareResponse{
+		Token:      share.Token,
+		DocumentID: share.DocumentID.String(),
+		Role:       share.Role,
+		CreatedAt:  share.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// AuthorID identifies whoever holds a share token, for attributing
+// comments and suggestions. It is derived from the token, which the server issued, so it
+// cannot be claimed without the token and does not reveal it.
+func AuthorID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "share_" + hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,176 @@
+package document
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SuggestionResponse describes a suggestion. Anchor is missing for
+// suggestions that only change formatting or other non-text content.
+type SuggestionResponse struct {
+	SuggestionID string        `json:"suggestion_id"`
+	DocumentID   string        `json:"document_id"`
+	AuthorID     string        `json:"author_id"`
+	Anchor       *ThreadAnchor `json:"anchor,omitempty"`
+	Status       string        `json:"status"`
+	ResolvedAt   string        `json:"resolved_at,omitempty"`
+	ResolvedBy   string        `json:"resolved_by,omitempty"`
+	CreatedAt    string        `json:"created_at"`
+	UpdatedAt    string        `json:"updated_at"`
+}
+
+// handleListSuggestions lists suggestions; ?status=pending, accepted or
+// rejected narrows the list.
+func (s *Server) handleListSuggestions(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "all" {
+		status = ""
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+
+	suggestions, err := s.store.ListSuggestions(r.Context(), docID, status)
+	if err != nil {
+		writeSuggestionError(w, "list suggestions", err)
+		return
+	}
+
+	items := make([]SuggestionResponse, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		items = append(items, suggestionToResponse(suggestion))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
+	docID, suggestionID, ok := suggestionParams(w, r)
+	if !ok {
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+
+	suggestion, err := s.store.GetSuggestion(r.Context(), docID, suggestionID)
+	if err != nil {
+		writeSuggestionError(w, "get suggestion", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, suggestionToResponse(suggestion))
+}
+
+// handleAcceptSuggestion applies a pending suggestion and broadcasts its
+// update like any other edit.
+func (s *Server) handleAcceptSuggestion(w http.ResponseWriter, r *http.Request) {
+	s.resolveSuggestion(w, r, true)
+}
+
+func (s *Server) handleRejectSuggestion(w http.ResponseWriter, r *http.Request) {
+	s.resolveSuggestion(w, r, false)
+}
+
+func (s *Server) resolveSuggestion(w http.ResponseWriter, r *http.Request, accept bool) {
+	docID, suggestionID, ok := suggestionParams(w, r)
+	if !ok {
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	by := AuthorID(shareToken(r))
+
+	var suggestion Suggestion
+	var err error
+	event := SuggestionRejected
+	if accept {
+		suggestion, err = s.store.AcceptSuggestion(r.Context(), docID, suggestionID, by)
+		event = SuggestionAccepted
+	} else {
+		suggestion, err = s.store.RejectSuggestion(r.Context(), docID, suggestionID, by)
+	}
+	if err != nil {
+		writeSuggestionError(w, "resolve suggestion", err)
+		return
+	}
+	if accept {
+		if err := s.events.PublishUpdate(r.Context(), docID, suggestion.Update); err != nil {
+			log.Printf("suggestion broadcast error: %v", err)
+		}
+	}
+
+	resp := suggestionToResponse(suggestion)
+	if err := s.events.PublishSuggestion(r.Context(), docID, event, resp); err != nil {
+		log.Printf("publish suggestion error: %v", err)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func suggestionParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	suggestionID, err := uuid.Parse(chi.URLParam(r, "suggestion_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_suggestion_id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return docID, suggestionID, true
+}
+
+// writeSuggestionError answers a failed suggestion operation.
+func writeSuggestionError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	case errors.Is(err, ErrInvalidSuggestionStatus):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_status"})
+	case errors.Is(err, ErrSuggestionResolved):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "suggestion_resolved"})
+	case errors.Is(err, ErrSuggestionConflict):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "suggestion_conflict"})
+	default:
+		log.Printf("%s error: %v", action, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "suggestion_failed"})
+	}
+}
+
+func suggestionToResponse(suggestion Suggestion) SuggestionResponse {
+	resp := SuggestionResponse{
+		SuggestionID: suggestion.SuggestionID.String(),
+		DocumentID:   suggestion.DocumentID.String(),
+		AuthorID:     suggestion.AuthorID,
+		Status:       suggestion.Status,
+		ResolvedBy:   suggestion.ResolvedBy,
+		CreatedAt:    suggestion.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:    suggestion.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if len(suggestion.AnchorStart) > 0 {
+		resp.Anchor = &ThreadAnchor{
+			Start: base64.StdEncoding.EncodeToString(suggestion.AnchorStart),
+			End:   base64.StdEncoding.EncodeToString(suggestion.AnchorEnd),
+		}
+	}
+	if suggestion.ResolvedAt != nil {
+		resp.ResolvedAt = suggestion.ResolvedAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,168 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type TagsResponse struct {
+	DocumentID string   `json:"document_id"`
+	Tags       []string `json:"tags"`
+}
+
+type MetadataRequest struct {
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+
+	tags, err := s.store.ListTags(r.Context(), docID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("list tags error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TagsResponse{DocumentID: docID.String(), Tags: tags})
+}
+
+func (s *Server) handleAddTags(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	if len(req.Tags) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "tags_required"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	tags, err := s.store.AddTags(r.Context(), docID, req.Tags)
+	if err != nil {
+		writeTagError(w, "add tags", err)
+		return
+	}
+	if err := s.events.PublishTags(r.Context(), docID, tags); err != nil {
+		log.Printf("publish tags error: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, TagsResponse{DocumentID: docID.String(), Tags: tags})
+}
+
+func (s *Server) handleRemoveTag(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	tags, err := s.store.RemoveTag(r.Context(), docID, chi.URLParam(r, "tag"))
+	if err != nil {
+		writeTagError(w, "remove tag", err)
+		return
+	}
+	if err := s.events.PublishTags(r.Context(), docID, tags); err != nil {
+		log.Printf("publish tags error: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, TagsResponse{DocumentID: docID.String(), Tags: tags})
+}
+
+// writeTagError answers a failed tag change.
+func writeTagError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	case errors.Is(err, ErrInvalidTag):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_tag"})
+	case errors.Is(err, ErrTooManyTags):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "too_many_tags"})
+	default:
+		log.Printf("%s error: %v", action, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+	}
+}
+
+// handleSetMetadata replaces the document's metadata object; an empty or
+// null object clears it.
+func (s *Server) handleSetMetadata(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req MetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	if err := s.store.SetMetadata(r.Context(), docID, req.Metadata); err != nil {
+		switch {
+		case IsNotFound(err):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+		case errors.Is(err, ErrMetadataTooLarge):
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "metadata_too_large"})
+		default:
+			log.Printf("set metadata error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update_failed"})
+		}
+		return
+	}
+
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": metadata})
+}
+
+// splitTags flattens repeated and comma-separated tag parameters.
+func splitTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
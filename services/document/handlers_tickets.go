@@ -0,0 +1,67 @@
+package document
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"doclet/shared/ticket"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type CreateTicketRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleCreateTicket issues a signed collab session ticket for the caller's
+// role, which the collab service verifies without calling back.
+func (s *Server) handleCreateTicket(w http.ResponseWriter, r *http.Request) {
+	if len(s.ticketKey) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "tickets_disabled"})
+		return
+	}
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	var req CreateTicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+	req.ClientID = strings.TrimSpace(req.ClientID)
+	if req.ClientID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing_client_id"})
+		return
+	}
+	role, ok := s.resolveRole(w, r, docID)
+	if !ok {
+		return
+	}
+
+	t := ticket.Ticket{
+		DocumentID: docID.String(),
+		ClientID:   req.ClientID,
+		AuthorID:   AuthorID(shareToken(r)),
+		Role:       role,
+		ExpiresAt:  time.Now().Add(s.ticketTTL).UTC(),
+	}
+	signed, err := ticket.Sign(s.ticketKey, t)
+	if err != nil {
+		log.Printf("sign ticket error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "ticket_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TicketResponse{Ticket: signed, Role: string(role), ExpiresAt: t.ExpiresAt})
+}
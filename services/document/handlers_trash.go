@@ -0,0 +1,97 @@
+package document
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "document_id")
+	docID, err := uuid.Parse(idParam)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleOwner) {
+		return
+	}
+	if err := s.store.DeleteDocument(r.Context(), docID); err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("delete document error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete_failed"})
+		return
+	}
+	if err := s.events.PublishDeleted(r.Context(), docID); err != nil {
+		log.Printf("publish delete error: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListTrash(w http.ResponseWriter, r *http.Request) {
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+	offset := parseInt(r.URL.Query().Get("offset"), 0)
+
+	docs, err := s.store.ListTrash(r.Context(), shareTokens(r), limit, offset)
+	if err != nil {
+		log.Printf("list trash error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	items := make([]DocumentListItem, 0, len(docs))
+	for _, doc := range docs {
+		items = append(items, DocumentListItem{
+			DocumentID:  doc.DocumentID.String(),
+			DisplayName: doc.DisplayName,
+			UpdatedAt:   doc.UpdatedAt.UTC().Format(time.RFC3339),
+			DeletedAt:   doc.DeletedAt.Time.UTC().Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleRestoreDocument(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	token := shareToken(r)
+	role, err := s.store.ResolveTrashedShare(r.Context(), docID, token)
+	if !writeAccessError(w, token, err) {
+		return
+	}
+	if !role.Allows(access.RoleOwner) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	doc, err := s.store.RestoreDocument(r.Context(), docID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("restore document error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "restore_failed"})
+		return
+	}
+	if err := s.events.PublishRestored(r.Context(), docID); err != nil {
+		log.Printf("publish restore error: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, documentToResponse(doc))
+}
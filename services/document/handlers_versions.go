@@ -0,0 +1,166 @@
+package document
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"doclet/shared/access"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type CreateVersionRequest struct {
+	Name string `json:"name"`
+}
+
+type VersionResponse struct {
+	DocumentID string `json:"document_id"`
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Content    string `json:"content,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func (s *Server) handleCreateVersion(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+
+	var req CreateVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	version, err := s.store.CreateVersion(r.Context(), docID, req.Name, VersionKindNamed)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("create version error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create_failed"})
+		return
+	}
+
+	resp := versionToResponse(version)
+	resp.Content = ""
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleListVersions(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+	versions, err := s.store.ListVersions(r.Context(), docID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("list versions error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		return
+	}
+
+	items := make([]VersionResponse, 0, len(versions))
+	for _, version := range versions {
+		items = append(items, versionToResponse(version))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	versionNum, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_version"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
+	version, err := s.store.GetVersion(r.Context(), docID, versionNum)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("get version error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, versionToResponse(version))
+}
+
+func (s *Server) handleRestoreVersion(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
+		return
+	}
+	versionNum, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_version"})
+		return
+	}
+
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
+	doc, update, err := s.store.RestoreVersion(r.Context(), docID, versionNum)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("restore version error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "restore_failed"})
+		return
+	}
+	if err := s.events.PublishUpdate(r.Context(), docID, update); err != nil {
+		log.Printf("restore broadcast error: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, documentToResponse(doc))
+}
+
+func versionToResponse(version DocumentVersion) VersionResponse {
+	resp := VersionResponse{
+		DocumentID: version.DocumentID.String(),
+		Version:    version.Version,
+		Name:       version.Name,
+		Kind:       version.Kind,
+		CreatedAt:  version.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if version.Content != nil {
+		resp.Content = base64.StdEncoding.EncodeToString(version.Content)
+	}
+	return resp
+}
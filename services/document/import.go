@@ -0,0 +1,367 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"doclet/shared/yjs"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	ImportMarkdown = "markdown"
+	ImportHTML     = "html"
+)
+
+var ErrUnknownImportFormat = errors.New("unknown import format")
+
+var markdownParser = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(underlineRenderer{}, 100))),
+)
+
+// underlineRenderer renders the <u> and </u> tags Export writes for
+// underlines and omits all other inline raw HTML, as goldmark does by
+// default.
+type underlineRenderer struct{}
+
+func (underlineRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindRawHTML, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkSkipChildren, nil
+		}
+		var raw []byte
+		segments := node.(*ast.RawHTML).Segments
+		for i := range segments.Len() {
+			segment := segments.At(i)
+			raw = append(raw, segment.Value(source)...)
+		}
+		switch strings.ToLower(string(raw)) {
+		case "<u>", "</u>":
+			_, _ = w.Write(raw)
+		default:
+			_, _ = w.WriteString("<!-- raw HTML omitted -->")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// ImportFormat guesses the import format from a media type or file name,
+// returning "" when neither is recognised.
+func ImportFormat(contentType, filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".md", ".markdown":
+		return ImportMarkdown
+	case ".html", ".htm":
+		return ImportHTML
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "text/markdown", "text/x-markdown":
+		return ImportMarkdown
+	case "text/html", "application/xhtml+xml":
+		return ImportHTML
+	}
+	return ""
+}
+
+// Import converts a Markdown or HTML source into a Yjs state for the TipTap
+// schema the editor uses. It also returns the text of the first heading,
+// which makes a reasonable title.
+func Import(source []byte, format string) ([]byte, string, error) {
+	switch format {
+	case ImportMarkdown:
+		var buf bytes.Buffer
+		if err := markdownParser.Convert(source, &buf); err != nil {
+			return nil, "", fmt.Errorf("parse markdown: %w", err)
+		}
+		source = buf.Bytes()
+	case ImportHTML:
+	default:
+		return nil, "", ErrUnknownImportFormat
+	}
+	root, err := html.Parse(bytes.NewReader(source))
+	if err != nil {
+		return nil, "", fmt.Errorf("parse html: %w", err)
+	}
+	nodes := htmlToBlocks(root)
+	if len(nodes) == 0 {
+		return []byte{}, "", nil
+	}
+	return yjs.EncodeXmlFragment(fragmentName, uint64(rand.Uint32()), nodes), firstHeading(nodes), nil
+}
+
+func firstHeading(nodes []*yjs.XmlNode) string {
+	for _, n := range nodes {
+		if n.Name == "heading" {
+			return strings.TrimSpace(plainText(n.Children))
+		}
+	}
+	return ""
+}
+
+// htmlToBlocks converts the children of n into block nodes. Inline content
+// found between blocks is wrapped in paragraphs.
+func htmlToBlocks(n *html.Node) []*yjs.XmlNode {
+	var blocks []*yjs.XmlNode
+	var pending []*html.Node
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if inline := htmlToInline(pending); len(inline) > 0 {
+			blocks = append(blocks, &yjs.XmlNode{Name: "paragraph", Children: inline})
+		}
+		pending = nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || !isBlock(c.DataAtom) {
+			if c.Type == html.TextNode || c.Type == html.ElementNode {
+				pending = append(pending, c)
+			}
+			continue
+		}
+		flush()
+		blocks = append(blocks, htmlToBlock(c)...)
+	}
+	flush()
+	return blocks
+}
+
+func htmlToBlock(n *html.Node) []*yjs.XmlNode {
+	switch n.DataAtom {
+	case atom.P:
+		inline := htmlToInline(children(n))
+		if len(inline) == 0 {
+			return nil
+		}
+		return []*yjs.XmlNode{{Name: "paragraph", Children: inline}}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int64(n.Data[1] - '0')
+		return []*yjs.XmlNode{{
+			Name:     "heading",
+			Attrs:    map[string]any{"level": level},
+			Children: htmlToInline(children(n)),
+		}}
+	case atom.Ul, atom.Ol:
+		list := &yjs.XmlNode{Name: "bulletList"}
+		if n.DataAtom == atom.Ol {
+			start := int64(1)
+			if v, err := strconv.ParseInt(attr(n, "start"), 10, 64); err == nil {
+				start = v
+			}
+			list = &yjs.XmlNode{Name: "orderedList", Attrs: map[string]any{"start": start}}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+				continue
+			}
+			// TipTap list items must start with a paragraph.
+			item := htmlToBlocks(c)
+			if len(item) == 0 || item[0].Name != "paragraph" {
+				item = append([]*yjs.XmlNode{{Name: "paragraph"}}, item...)
+			}
+			list.Children = append(list.Children, &yjs.XmlNode{Name: "listItem", Children: item})
+		}
+		if len(list.Children) == 0 {
+			return nil
+		}
+		return []*yjs.XmlNode{list}
+	case atom.Blockquote:
+		inner := htmlToBlocks(n)
+		if len(inner) == 0 {
+			return nil
+		}
+		return []*yjs.XmlNode{{Name: "blockquote", Children: inner}}
+	case atom.Pre:
+		block := &yjs.XmlNode{Name: "codeBlock", Attrs: map[string]any{}}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.Code {
+				for _, class := range strings.Fields(attr(c, "class")) {
+					if lang, ok := strings.CutPrefix(class, "language-"); ok {
+						block.Attrs["language"] = lang
+					}
+				}
+			}
+		}
+		code := strings.TrimSuffix(textContent(n), "\n")
+		if code != "" {
+			block.Children = []*yjs.XmlNode{{Runs: []yjs.TextRun{{Text: code}}}}
+		}
+		return []*yjs.XmlNode{block}
+	case atom.Hr:
+		return []*yjs.XmlNode{{Name: "horizontalRule"}}
+	case atom.Head, atom.Script, atom.Style, atom.Template:
+		return nil
+	}
+	return htmlToBlocks(n)
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Blockquote, atom.Pre, atom.Hr,
+		atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Aside, atom.Nav,
+		atom.Html, atom.Head, atom.Body, atom.Script, atom.Style, atom.Template,
+		atom.Table, atom.Thead, atom.Tbody, atom.Tfoot, atom.Tr, atom.Td, atom.Th,
+		atom.Figure, atom.Details, atom.Summary, atom.Dl, atom.Dt, atom.Dd:
+		return true
+	}
+	return false
+}
+
+// htmlToInline converts inline HTML into text nodes and hard breaks, with
+// HTML whitespace collapsed and dropped at both ends.
+func htmlToInline(nodes []*html.Node) []*yjs.XmlNode {
+	b := &inlineBuilder{}
+	for _, n := range nodes {
+		b.walk(n, map[string]any{})
+	}
+	b.flush()
+	return b.nodes
+}
+
+type inlineBuilder struct {
+	nodes []*yjs.XmlNode
+	runs  []yjs.TextRun
+	// space is set when collapsed whitespace is due before the next text.
+	space bool
+}
+
+func (b *inlineBuilder) walk(n *html.Node, format map[string]any) {
+	switch n.Type {
+	case html.TextNode:
+		b.text(n.Data, format)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	var name string
+	var value any = map[string]any{}
+	switch n.DataAtom {
+	case atom.Br:
+		b.hardBreak()
+		return
+	case atom.Script, atom.Style, atom.Template:
+		return
+	case atom.Img:
+		b.text(attr(n, "alt"), format)
+		return
+	case atom.Strong, atom.B:
+		name = "bold"
+	case atom.Em, atom.I:
+		name = "italic"
+	case atom.U, atom.Ins:
+		name = "underline"
+	case atom.S, atom.Strike, atom.Del:
+		name = "strike"
+	case atom.Code, atom.Kbd, atom.Samp:
+		name = "code"
+	case atom.A:
+		// Links with other schemes than Export allows keep their text.
+		if href := attr(n, "href"); safeHref(href) {
+			name = "link"
+			value = map[string]any{"href": href}
+		}
+	}
+	if name != "" {
+		next := make(map[string]any, len(format)+1)
+		for k, v := range format {
+			next[k] = v
+		}
+		next[name] = value
+		format = next
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.walk(c, format)
+	}
+}
+
+// text appends s with whitespace collapsed. A space between two runs goes
+// to the one with fewer marks, so "a <b>b</b> c" keeps both spaces outside
+// the bold run.
+func (b *inlineBuilder) text(s string, format map[string]any) {
+	if s == "" {
+		return
+	}
+	if isHTMLSpace(s[0]) {
+		b.space = true
+	}
+	text := strings.Join(strings.Fields(s), " ")
+	if text == "" {
+		return
+	}
+	n := len(b.runs)
+	if b.space && n > 0 {
+		if len(format) <= len(b.runs[n-1].Format) {
+			text = " " + text
+		} else {
+			b.runs[n-1].Text += " "
+		}
+	}
+	b.space = isHTMLSpace(s[len(s)-1])
+	if n > 0 && reflect.DeepEqual(b.runs[n-1].Format, format) {
+		b.runs[n-1].Text += text
+		return
+	}
+	b.runs = append(b.runs, yjs.TextRun{Text: text, Format: format})
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func (b *inlineBuilder) hardBreak() {
+	b.flush()
+	b.space = false
+	b.nodes = append(b.nodes, &yjs.XmlNode{Name: "hardBreak"})
+}
+
+func (b *inlineBuilder) flush() {
+	if len(b.runs) == 0 {
+		return
+	}
+	b.nodes = append(b.nodes, &yjs.XmlNode{Runs: b.runs})
+	b.runs = nil
+}
+
+func children(n *html.Node) []*html.Node {
+	var out []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		out = append(out, c)
+	}
+	return out
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
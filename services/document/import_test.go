@@ -0,0 +1,38 @@
+package document
+
+import "testing"
+
+// importAsHTML imports source and exports the result as HTML.
+func importAsHTML(t *testing.T, source, format string) string {
+	t.Helper()
+	content, _, err := Import([]byte(source), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Export(content, ExportHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestImportDropsUnsafeHTML(t *testing.T) {
+	tests := []struct {
+		name, source, format, want string
+	}{
+		{"markdown raw html", "a <img src=x onerror=alert(1)> b <u>under</u>", ImportMarkdown, "<p>a b <u>under</u></p>\n"},
+		{"markdown html block", "<div onclick=\"alert(1)\">boom</div>\n\ntext", ImportMarkdown, "<p>text</p>\n"},
+		{"markdown javascript link", "[x](javascript:alert(1))", ImportMarkdown, "<p>x</p>\n"},
+		{"markdown link", "[x](https://example.com)", ImportMarkdown, `<p><a href="https://example.com">x</a></p>` + "\n"},
+		{"html javascript link", `<p><a href="javascript:alert(1)">x</a></p>`, ImportHTML, "<p>x</p>\n"},
+		{"html data link", `<p><a href="data:text/html,hi">x</a></p>`, ImportHTML, "<p>x</p>\n"},
+		{"html mailto link", `<p><a href="mailto:a@example.com">x</a></p>`, ImportHTML, `<p><a href="mailto:a@example.com">x</a></p>` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := importAsHTML(t, tt.source, tt.format); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
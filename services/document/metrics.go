@@ -0,0 +1,12 @@
+package document
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var snapshotWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "doclet_document_snapshot_write_seconds",
+	Help:    "Time taken to store a snapshot in UpdateContent.",
+	Buckets: prometheus.DefBuckets,
+})
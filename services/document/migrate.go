@@ -3,5 +3,14 @@ package document
 import "gorm.io/gorm"
 
 func RunMigrations(db *gorm.DB) error {
-	return db.AutoMigrate(Models()...)
+	if err := db.AutoMigrate(Models()...); err != nil {
+		return err
+	}
+	if err := ensureSearchIndex(db); err != nil {
+		return err
+	}
+	if err := mintOwnerTokens(db); err != nil {
+		return err
+	}
+	return mintWorkspaceTokens(db)
 }
@@ -0,0 +1,11 @@
+-- Create "document_updates" table
+CREATE TABLE "document_updates" (
+  "seq" bigserial NOT NULL,
+  "document_id" uuid NOT NULL,
+  "client_id" text NOT NULL,
+  "update" bytea NOT NULL,
+  "created_at" timestamptz NULL,
+  PRIMARY KEY ("seq")
+);
+-- Create index "idx_document_updates_document_id" to table: "document_updates"
+CREATE INDEX "idx_document_updates_document_id" ON "document_updates" ("document_id");
@@ -0,0 +1,10 @@
+-- Create "document_versions" table
+CREATE TABLE "document_versions" (
+  "document_id" uuid NOT NULL,
+  "version" bigint NOT NULL,
+  "name" text NOT NULL,
+  "kind" text NOT NULL,
+  "content" bytea NOT NULL,
+  "created_at" timestamptz NULL,
+  PRIMARY KEY ("document_id", "version")
+);
@@ -0,0 +1,10 @@
+-- Create "share_tokens" table
+CREATE TABLE "share_tokens" (
+  "token" text NOT NULL,
+  "document_id" uuid NOT NULL,
+  "role" text NOT NULL,
+  "created_at" timestamptz NULL,
+  PRIMARY KEY ("token")
+);
+-- Create index "idx_share_tokens_document_id" to table: "share_tokens"
+CREATE INDEX "idx_share_tokens_document_id" ON "share_tokens" ("document_id");
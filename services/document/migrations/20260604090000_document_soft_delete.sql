@@ -0,0 +1,4 @@
+-- Modify "documents" table
+ALTER TABLE "documents" ADD COLUMN "deleted_at" timestamptz NULL;
+-- Create index "idx_documents_deleted_at" to table: "documents"
+CREATE INDEX "idx_documents_deleted_at" ON "documents" ("deleted_at");
@@ -0,0 +1,6 @@
+-- Modify "documents" table
+ALTER TABLE "documents" ADD COLUMN "text_content" text NOT NULL DEFAULT '';
+-- Add generated column "search_vector" to table: "documents" (managed outside the Gorm schema, see ensureSearchIndex)
+ALTER TABLE "documents" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (setweight(to_tsvector('english', display_name), 'A') || setweight(to_tsvector('english', text_content), 'B')) STORED;
+-- Create index "idx_documents_search_vector" to table: "documents"
+CREATE INDEX "idx_documents_search_vector" ON "documents" USING GIN ("search_vector");
@@ -0,0 +1,26 @@
+-- Create "workspaces" table
+CREATE TABLE "workspaces" (
+  "workspace_id" uuid NOT NULL,
+  "name" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  PRIMARY KEY ("workspace_id")
+);
+-- Create "folders" table
+CREATE TABLE "folders" (
+  "folder_id" uuid NOT NULL,
+  "workspace_id" uuid NOT NULL,
+  "parent_id" uuid NULL,
+  "name" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  PRIMARY KEY ("folder_id")
+);
+-- Create index "idx_folders_workspace_id" to table: "folders"
+CREATE INDEX "idx_folders_workspace_id" ON "folders" ("workspace_id");
+-- Create index "idx_folders_parent_id" to table: "folders"
+CREATE INDEX "idx_folders_parent_id" ON "folders" ("parent_id");
+-- Modify "documents" table
+ALTER TABLE "documents" ADD COLUMN "folder_id" uuid NULL;
+-- Create index "idx_documents_folder_id" to table: "documents"
+CREATE INDEX "idx_documents_folder_id" ON "documents" ("folder_id");
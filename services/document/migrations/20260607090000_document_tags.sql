@@ -0,0 +1,11 @@
+-- Modify "documents" table
+ALTER TABLE "documents" ADD COLUMN "metadata" jsonb NULL;
+-- Create "document_tags" table
+CREATE TABLE "document_tags" (
+  "document_id" uuid NOT NULL,
+  "tag" text NOT NULL,
+  "created_at" timestamptz NULL,
+  PRIMARY KEY ("document_id", "tag")
+);
+-- Create index "idx_document_tags_tag" to table: "document_tags"
+CREATE INDEX "idx_document_tags_tag" ON "document_tags" ("tag");
@@ -0,0 +1,31 @@
+-- Create "comment_threads" table
+CREATE TABLE "comment_threads" (
+  "thread_id" uuid NOT NULL,
+  "document_id" uuid NOT NULL,
+  "anchor_start" bytea NOT NULL,
+  "anchor_end" bytea NOT NULL,
+  "quote" text NOT NULL DEFAULT '',
+  "resolved_at" timestamptz NULL,
+  "resolved_by" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  PRIMARY KEY ("thread_id")
+);
+-- Create index "idx_comment_threads_document_id" to table: "comment_threads"
+CREATE INDEX "idx_comment_threads_document_id" ON "comment_threads" ("document_id");
+-- Create "comments" table
+CREATE TABLE "comments" (
+  "comment_id" uuid NOT NULL,
+  "thread_id" uuid NOT NULL,
+  "document_id" uuid NOT NULL,
+  "author_id" text NOT NULL,
+  "author_name" text NOT NULL DEFAULT '',
+  "body" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  PRIMARY KEY ("comment_id")
+);
+-- Create index "idx_comments_document_id" to table: "comments"
+CREATE INDEX "idx_comments_document_id" ON "comments" ("document_id");
+-- Create index "idx_comments_thread_id" to table: "comments"
+CREATE INDEX "idx_comments_thread_id" ON "comments" ("thread_id");
@@ -0,0 +1,17 @@
+-- Create "suggestions" table
+CREATE TABLE "suggestions" (
+  "suggestion_id" uuid NOT NULL,
+  "document_id" uuid NOT NULL,
+  "author_id" text NOT NULL,
+  "update" bytea NOT NULL,
+  "anchor_start" bytea NULL,
+  "anchor_end" bytea NULL,
+  "status" text NOT NULL,
+  "resolved_at" timestamptz NULL,
+  "resolved_by" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  PRIMARY KEY ("suggestion_id")
+);
+-- Create index "idx_suggestions_document_id" to table: "suggestions"
+CREATE INDEX "idx_suggestions_document_id" ON "suggestions" ("document_id");
@@ -0,0 +1,5 @@
+-- Mint an owner token for documents created before share tokens existed
+INSERT INTO "share_tokens" ("token", "document_id", "role", "created_at")
+SELECT replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', ''), "document_id", 'owner', now()
+FROM "documents"
+WHERE "document_id" NOT IN (SELECT "document_id" FROM "share_tokens");
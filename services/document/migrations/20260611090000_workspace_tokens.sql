@@ -0,0 +1,13 @@
+-- Create "workspace_tokens" table
+CREATE TABLE "workspace_tokens" (
+  "token" text NOT NULL,
+  "workspace_id" uuid NOT NULL,
+  "created_at" timestamptz NULL,
+  PRIMARY KEY ("token")
+);
+-- Create index "idx_workspace_tokens_workspace_id" to table: "workspace_tokens"
+CREATE INDEX "idx_workspace_tokens_workspace_id" ON "workspace_tokens" ("workspace_id");
+-- Mint a token for workspaces created before workspace tokens existed
+INSERT INTO "workspace_tokens" ("token", "workspace_id", "created_at")
+SELECT replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', ''), "workspace_id", now()
+FROM "workspaces";
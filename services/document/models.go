@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 const DefaultDisplayName = "Untitled"
@@ -12,14 +13,186 @@ type Document struct {
 	DocumentID  uuid.UUID `gorm:"type:uuid;primaryKey"`
 	DisplayName string    `gorm:"type:text;not null"`
 	Content     []byte    `gorm:"type:bytea;not null"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// TextContent is the plain text of Content, kept for search.
+	TextContent string `gorm:"type:text;not null;default:''"`
+	// FolderID is nil for documents that are not filed in a folder.
+	FolderID *uuid.UUID `gorm:"type:uuid;index"`
+	// Metadata is a small free-form JSON object, nil until first set.
+	Metadata  map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt is set while the document is in the trash. GORM leaves
+	// trashed documents out of every query that does not ask for them.
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 func (Document) TableName() string {
 	return "documents"
 }
 
+// DocumentUpdate is one Yjs update from the collab stream that has not been
+// folded into Document.Content yet.
+type DocumentUpdate struct {
+	Seq        uint64    `gorm:"primaryKey;autoIncrement"`
+	DocumentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	ClientID   string    `gorm:"type:text;not null"`
+	Update     []byte    `gorm:"type:bytea;not null"`
+	CreatedAt  time.Time
+}
+
+func (DocumentUpdate) TableName() string {
+	return "document_updates"
+}
+
+const (
+	VersionKindNamed = "named"
+	VersionKindAuto  = "auto"
+)
+
+// DocumentVersion is a retained copy of a document's Yjs state. Named
+// versions are kept until the document is deleted; auto versions are taken
+// periodically and pruned to the configured retention.
+type DocumentVersion struct {
+	DocumentID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Version    int       `gorm:"primaryKey;autoIncrement:false"`
+	Name       string    `gorm:"type:text;not null"`
+	Kind       string    `gorm:"type:text;not null"`
+	Content    []byte    `gorm:"type:bytea;not null"`
+	CreatedAt  time.Time
+}
+
+func (DocumentVersion) TableName() string {
+	return "document_versions"
+}
+
+// ShareToken grants Role on a document to whoever presents Token.
+type ShareToken struct {
+	Token      string    `gorm:"type:text;primaryKey"`
+	DocumentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Role       string    `gorm:"type:text;not null"`
+	CreatedAt  time.Time
+}
+
+func (ShareToken) TableName() string {
+	return "share_tokens"
+}
+
+// DocumentTag attaches a tag to a document. Tags are stored normalized, see
+// NormalizeTag.
+type DocumentTag struct {
+	DocumentID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Tag        string    `gorm:"type:text;primaryKey;index"`
+	CreatedAt  time.Time
+}
+
+func (DocumentTag) TableName() string {
+	return "document_tags"
+}
+
+// CommentThread is a discussion anchored to a range of the document. The
+// anchors are encoded Yjs relative positions, so the range follows edits.
+type CommentThread struct {
+	ThreadID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	DocumentID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	AnchorStart []byte    `gorm:"type:bytea;not null"`
+	AnchorEnd   []byte    `gorm:"type:bytea;not null"`
+	// Quote is the text the range covered when the thread was started.
+	Quote      string `gorm:"type:text;not null;default:''"`
+	ResolvedAt *time.Time
+	ResolvedBy string `gorm:"type:text;not null;default:''"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Comments   []Comment `gorm:"-"`
+}
+
+func (CommentThread) TableName() string {
+	return "comment_threads"
+}
+
+// Comment is one message of a thread. AuthorID is the collab client ID of
+// the author, who may edit and delete it.
+type Comment struct {
+	CommentID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ThreadID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	DocumentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	AuthorID   string    `gorm:"type:text;not null"`
+	AuthorName string    `gorm:"type:text;not null;default:''"`
+	Body       string    `gorm:"type:text;not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (Comment) TableName() string {
+	return "comments"
+}
+
+// Suggestion states. Only pending suggestions can be accepted or rejected.
+const (
+	SuggestionStatusPending  = "pending"
+	SuggestionStatusAccepted = "accepted"
+	SuggestionStatusRejected = "rejected"
+)
+
+// Suggestion is a Yjs update proposed by a collab client in suggest mode,
+// held back until an editor accepts it. AuthorID is the client's collab ID;
+// the anchors bound the range it changes like CommentThread's.
+type Suggestion struct {
+	SuggestionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	DocumentID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	AuthorID     string    `gorm:"type:text;not null"`
+	Update       []byte    `gorm:"type:bytea;not null"`
+	AnchorStart  []byte    `gorm:"type:bytea"`
+	AnchorEnd    []byte    `gorm:"type:bytea"`
+	Status       string    `gorm:"type:text;not null"`
+	ResolvedAt   *time.Time
+	ResolvedBy   string `gorm:"type:text;not null;default:''"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (Suggestion) TableName() string {
+	return "suggestions"
+}
+
+// Workspace groups a tree of folders.
+type Workspace struct {
+	WorkspaceID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name        string    `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (Workspace) TableName() string {
+	return "workspaces"
+}
+
+// WorkspaceToken lets whoever presents Token manage the workspace and its
+// folders.
+type WorkspaceToken struct {
+	Token       string    `gorm:"type:text;primaryKey"`
+	WorkspaceID uuid.UUID `gorm:"type:uuid;not null;index"`
+	CreatedAt   time.Time
+}
+
+func (WorkspaceToken) TableName() string {
+	return "workspace_tokens"
+}
+
+// Folder holds documents and other folders of its workspace. Top-level
+// folders have no ParentID.
+type Folder struct {
+	FolderID    uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	WorkspaceID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ParentID    *uuid.UUID `gorm:"type:uuid;index"`
+	Name        string     `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (Folder) TableName() string {
+	return "folders"
+}
+
 func Models() []interface{} {
-	return []interface{}{Document{}}
+	return []interface{}{Document{}, DocumentUpdate{}, DocumentVersion{}, ShareToken{}, DocumentTag{}, CommentThread{}, Comment{}, Suggestion{}, Workspace{}, WorkspaceToken{}, Folder{}}
 }
@@ -0,0 +1,234 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Sort orders for ListDocuments. SortRelevance needs a query and is the
+// default when there is one; SortUpdated is the default otherwise.
+const (
+	SortUpdated   = "updated_at"
+	SortCreated   = "created_at"
+	SortTitle     = "title"
+	SortRelevance = "relevance"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ListOptions selects a page of ListDocuments. Cursor continues from the
+// NextCursor of a previous page with the same query and sort; Offset is
+// only used without one.
+type ListOptions struct {
+	Query  string
+	Sort   string
+	Limit  int
+	Offset int
+	Cursor string
+	// FolderID lists only the documents filed in that folder.
+	FolderID *uuid.UUID
+	// Tags lists only documents carrying all of them, or any of them when
+	// TagMatch is TagMatchAny.
+	Tags     []string
+	TagMatch string
+	// Total also counts every document matching the query.
+	Total bool
+	// Tokens are the caller's share tokens; only their documents are
+	// listed.
+	Tokens []string
+}
+
+// DocumentPage is one page of ListDocuments. NextCursor is empty on the last
+// page, and Total is nil unless ListOptions.Total was set.
+type DocumentPage struct {
+	Items      []DocumentMatch
+	NextCursor string
+	Total      *int64
+}
+
+// listCursor is the decoded form of an opaque page cursor. Keyset sorts
+// carry the sort key and ID of the last item; relevance, whose rank cannot
+// be compared across queries cheaply, carries an offset instead.
+type listCursor struct {
+	Sort   string    `json:"s"`
+	Key    string    `json:"k,omitempty"`
+	ID     uuid.UUID `json:"id"`
+	Offset int       `json:"o,omitempty"`
+}
+
+// keysetSorts maps keyset sorts to their column and direction.
+var keysetSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	SortUpdated: {column: "updated_at", desc: true},
+	SortCreated: {column: "created_at", desc: true},
+	SortTitle:   {column: "display_name"},
+}
+
+// ListDocuments returns a page of documents in the requested order. With a
+// query, only documents whose title or body matches are listed.
+func (s *Store) ListDocuments(ctx context.Context, opts ListOptions) (DocumentPage, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	query := strings.TrimSpace(opts.Query)
+	sort := opts.Sort
+	if sort == "" {
+		sort = SortUpdated
+		if query != "" {
+			sort = SortRelevance
+		}
+	}
+	key, keyset := keysetSorts[sort]
+	if !keyset && (sort != SortRelevance || query == "") {
+		return DocumentPage{}, ErrInvalidSort
+	}
+	match := opts.TagMatch
+	if match == "" {
+		match = TagMatchAll
+	}
+	if match != TagMatchAll && match != TagMatchAny {
+		return DocumentPage{}, ErrInvalidTagMatch
+	}
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return DocumentPage{}, err
+	}
+	var cursor *listCursor
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil || c.Sort != sort {
+			return DocumentPage{}, ErrInvalidCursor
+		}
+		cursor = &c
+	}
+
+	// Search matches and snippets come only from documents the caller's
+	// tokens open, so the token filter goes first.
+	if len(opts.Tokens) == 0 {
+		var page DocumentPage
+		if opts.Total {
+			page.Total = new(int64)
+		}
+		return page, nil
+	}
+	qb := shareFilter(s.db.WithContext(ctx).Model(&Document{}), opts.Tokens)
+	if query != "" {
+		qb = s.searchFilter(qb, query)
+	}
+	if opts.FolderID != nil {
+		qb = qb.Where("folder_id = ?", *opts.FolderID)
+	}
+	if len(tags) > 0 {
+		qb = tagFilter(qb, tags, match)
+	}
+	qb = qb.Session(&gorm.Session{})
+
+	var page DocumentPage
+	if opts.Total {
+		var total int64
+		if err := qb.Count(&total).Error; err != nil {
+			return DocumentPage{}, err
+		}
+		page.Total = &total
+	}
+
+	list := qb.Select("document_id", "display_name", "folder_id", "created_at", "updated_at")
+	if query != "" {
+		list = s.searchColumns(qb, query)
+	}
+	offset := opts.Offset
+	if keyset {
+		op, dir := ">", "ASC"
+		if key.desc {
+			op, dir = "<", "DESC"
+		}
+		if cursor != nil {
+			value, err := cursorValue(sort, cursor.Key)
+			if err != nil {
+				return DocumentPage{}, ErrInvalidCursor
+			}
+			list = list.Where(
+				"("+key.column+" "+op+" ? OR ("+key.column+" = ? AND document_id "+op+" ?))",
+				value, value, cursor.ID,
+			)
+			offset = 0
+		}
+		list = list.Order(key.column + " " + dir + ", document_id " + dir)
+	} else {
+		if cursor != nil {
+			offset = cursor.Offset
+		}
+		list = s.relevanceOrder(list, query)
+	}
+
+	var docs []DocumentMatch
+	if err := list.Limit(limit + 1).Offset(max(offset, 0)).Find(&docs).Error; err != nil {
+		return DocumentPage{}, err
+	}
+	if len(docs) > limit {
+		docs = docs[:limit]
+		next := listCursor{Sort: sort, Offset: max(offset, 0) + limit}
+		if keyset {
+			last := docs[limit-1].Document
+			next = listCursor{Sort: sort, Key: cursorKey(sort, last), ID: last.DocumentID}
+		}
+		page.NextCursor = encodeCursor(next)
+	}
+	if query != "" {
+		s.fillSnippets(docs, query)
+	}
+	if err := fillTags(s.db.WithContext(ctx), docs); err != nil {
+		return DocumentPage{}, err
+	}
+	page.Items = docs
+	return page, nil
+}
+
+func cursorKey(sort string, doc Document) string {
+	switch sort {
+	case SortUpdated:
+		return doc.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortCreated:
+		return doc.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return doc.DisplayName
+	}
+}
+
+func cursorValue(sort, key string) (interface{}, error) {
+	if sort == SortTitle {
+		return key, nil
+	}
+	return time.Parse(time.RFC3339Nano, key)
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
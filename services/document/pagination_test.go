@@ -0,0 +1,114 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// collectPages follows NextCursor from the first page to the last.
+func collectPages(t *testing.T, s *Store, opts ListOptions) []uuid.UUID {
+	t.Helper()
+	var ids []uuid.UUID
+	for range 100 {
+		page, err := s.ListDocuments(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range page.Items {
+			ids = append(ids, doc.DocumentID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		opts.Cursor = page.NextCursor
+	}
+	t.Fatal("cursor never ran out")
+	return nil
+}
+
+func TestListDocumentsCursors(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	var tokens []string
+	// Half the documents share a timestamp and a title, so paging has to
+	// break ties by ID.
+	tied := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 7 {
+		doc, owner, err := s.CreateDocument(ctx, fmt.Sprintf("Plan %d", i%3), paragraph(uint64(i+1), "plan body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, owner.Token)
+		at := tied
+		if i%2 == 0 {
+			at = tied.Add(time.Duration(i) * time.Minute)
+		}
+		if err := s.db.Model(&Document{}).Where("document_id = ?", doc.DocumentID).
+			UpdateColumns(map[string]any{"updated_at": at, "created_at": at}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []string{SortUpdated, SortCreated, SortTitle, SortRelevance} {
+		t.Run(sort, func(t *testing.T) {
+			opts := ListOptions{Sort: sort, Tokens: tokens, Query: "plan"}
+			all := collectPages(t, s, ListOptions{Sort: sort, Tokens: tokens, Query: "plan", Limit: 100})
+			if len(all) != 7 {
+				t.Fatalf("listed %d documents, want 7", len(all))
+			}
+			for _, limit := range []int{1, 2, 3, 7} {
+				opts.Limit = limit
+				if got := collectPages(t, s, opts); !slices.Equal(got, all) {
+					t.Errorf("pages of %d = %v, want %v", limit, got, all)
+				}
+			}
+		})
+	}
+}
+
+func TestListDocumentsInvalidCursor(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	var tokens []string
+	for range 3 {
+		tokens = append(tokens, ownerToken(t, s, createTestDocument(t, s, nil)))
+	}
+	page, err := s.ListDocuments(ctx, ListOptions{Tokens: tokens, Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("first page: cursor %q, error %v", page.NextCursor, err)
+	}
+
+	for name, opts := range map[string]ListOptions{
+		"garbage":        {Tokens: tokens, Cursor: "not a cursor"},
+		"other sort":     {Tokens: tokens, Cursor: page.NextCursor, Sort: SortTitle},
+		"bad key":        {Tokens: tokens, Cursor: encodeCursor(listCursor{Sort: SortUpdated, Key: "yesterday"})},
+		"unknown sort":   {Tokens: tokens, Sort: "size"},
+		"relevance bare": {Tokens: tokens, Sort: SortRelevance},
+	} {
+		_, err := s.ListDocuments(ctx, opts)
+		if !errors.Is(err, ErrInvalidCursor) && !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("%s: error = %v, want an invalid cursor or sort", name, err)
+		}
+	}
+}
+
+func TestListDocumentsTotal(t *testing.T) {
+	s := newTestStore(t)
+	var tokens []string
+	for range 5 {
+		tokens = append(tokens, ownerToken(t, s, createTestDocument(t, s, nil)))
+	}
+	page, err := s.ListDocuments(context.Background(), ListOptions{Tokens: tokens[:4], Limit: 2, Total: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Total == nil || *page.Total != 4 {
+		t.Fatalf("got %d items, total %v; want 2 of 4", len(page.Items), page.Total)
+	}
+}
@@ -0,0 +1,182 @@
+package document
+
+import (
+	"html"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DocumentMatch is a ListDocuments result. Snippet is an HTML-escaped
+// excerpt of the body with matches wrapped in <mark>, or empty when the body
+// did not match.
+type DocumentMatch struct {
+	Document
+	Snippet string
+	Tags    []string `gorm:"-"`
+}
+
+// Postgres searches the search_vector column, which weights the title above
+// the body. It is a generated column managed by ensureSearchIndex because
+// SQLite, which falls back to LIKE, has nothing like it.
+const (
+	searchConfig    = "english"
+	searchQuery     = "websearch_to_tsquery('" + searchConfig + "', ?)"
+	searchVectorSQL = "setweight(to_tsvector('" + searchConfig + "', display_name), 'A') || " +
+		"setweight(to_tsvector('" + searchConfig + "', text_content), 'B')"
+)
+
+// Highlighted matches are delimited with private use characters, which
+// survive HTML escaping and cannot be confused with document text.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+	headlineOpts   = "StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+		`, MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=" … "`
+)
+
+// snippetRadius is how many characters of context the LIKE fallback keeps
+// on each side of the first match.
+const snippetRadius = 60
+
+// likeEscaper escapes the LIKE wildcards, so a query containing % or _
+// matches those characters rather than anything.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likePattern returns a LIKE pattern, for use with ESCAPE '\', matching
+// text that contains query.
+func likePattern(query string) string {
+	return "%" + likeEscaper.Replace(query) + "%"
+}
+
+// searchFilter restricts qb to documents whose title or body matches query.
+func (s *Store) searchFilter(qb *gorm.DB, query string) *gorm.DB {
+	pattern := likePattern(query)
+	if s.dialect == dialectSQLite {
+		return qb.Where(`display_name LIKE ? ESCAPE '\' OR text_content LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	return qb.Where("search_vector @@ "+searchQuery+` OR display_name ILIKE ? ESCAPE '\'`, query, pattern)
+}
+
+// searchColumns selects the listing columns plus what fillSnippets needs.
+func (s *Store) searchColumns(qb *gorm.DB, query string) *gorm.DB {
+	if s.dialect == dialectSQLite {
+		return qb.Select("document_id", "display_name", "folder_id", "text_content", "created_at", "updated_at")
+	}
+	return qb.Select("document_id, display_name, folder_id, created_at, updated_at, "+
+		"ts_headline('"+searchConfig+"', text_content, "+searchQuery+", ?) AS snippet", query, headlineOpts)
+}
+
+// relevanceOrder sorts best matches first: by rank on Postgres, and title
+// matches before body matches on SQLite.
+func (s *Store) relevanceOrder(qb *gorm.DB, query string) *gorm.DB {
+	expr := clause.Expr{
+		SQL:                "ts_rank(search_vector, " + searchQuery + ") DESC, updated_at DESC, document_id DESC",
+		Vars:               []interface{}{query},
+		WithoutParentheses: true,
+	}
+	if s.dialect == dialectSQLite {
+		expr = clause.Expr{
+			SQL:                `CASE WHEN display_name LIKE ? ESCAPE '\' THEN 0 ELSE 1 END, updated_at DESC, document_id DESC`,
+			Vars:               []interface{}{likePattern(query)},
+			WithoutParentheses: true,
+		}
+	}
+	return qb.Order(clause.OrderBy{Expression: expr})
+}
+
+// fillSnippets turns what searchColumns selected into rendered snippets.
+func (s *Store) fillSnippets(docs []DocumentMatch, query string) {
+	for i := range docs {
+		if s.dialect == dialectSQLite {
+			docs[i].Snippet = likeSnippet(docs[i].TextContent, query)
+			docs[i].TextContent = ""
+			continue
+		}
+		docs[i].Snippet = renderSnippet(docs[i].Snippet)
+	}
+}
+
+// likeSnippet excerpts text around the first case-insensitive match of
+// query.
+func likeSnippet(text, query string) string {
+	lower := strings.ToLower(text)
+	start := strings.Index(lower, strings.ToLower(query))
+	// Lowercasing can change byte lengths; give up rather than cut runes.
+	if start < 0 || len(lower) != len(text) {
+		return ""
+	}
+	end := start + len(query)
+	from := max(start-snippetRadius, 0)
+	to := min(end+snippetRadius, len(text))
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	snippet := text[from:start] + highlightStart + text[start:end] + highlightStop + text[end:to]
+	snippet = strings.Join(strings.Fields(snippet), " ")
+	if from > 0 {
+		snippet = "… " + snippet
+	}
+	if to < len(text) {
+		snippet += " …"
+	}
+	return renderSnippet(snippet)
+}
+
+// renderSnippet escapes a snippet and turns highlight markers into <mark>
+// tags. Snippets without highlights are dropped.
+func renderSnippet(snippet string) string {
+	if !strings.Contains(snippet, highlightStart) {
+		return ""
+	}
+	snippet = html.EscapeString(strings.TrimSpace(snippet))
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
+
+// extractText returns the plain text of a Yjs state for the text_content
+// column.
+func extractText(content []byte) string {
+	text, err := Export(content, ExportText)
+	if err != nil {
+		log.Printf("extract text error: %v", err)
+		return ""
+	}
+	text = strings.ReplaceAll(text, highlightStart, "")
+	return strings.ReplaceAll(text, highlightStop, "")
+}
+
+// ensureSearchIndex adds the Postgres search_vector column and its GIN
+// index, and fills text_content for documents stored before it existed.
+func ensureSearchIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != dialectSQLite {
+		if err := db.Exec("ALTER TABLE documents ADD COLUMN IF NOT EXISTS search_vector tsvector " +
+			"GENERATED ALWAYS AS (" + searchVectorSQL + ") STORED").Error; err != nil {
+			return err
+		}
+		if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_documents_search_vector " +
+			"ON documents USING GIN (search_vector)").Error; err != nil {
+			return err
+		}
+	}
+	var docs []Document
+	return db.Unscoped().
+		Select("document_id", "content").
+		Where("text_content = '' AND length(content) > 0").
+		FindInBatches(&docs, 100, func(tx *gorm.DB, _ int) error {
+			for _, doc := range docs {
+				if err := db.Unscoped().Model(&Document{}).
+					Where("document_id = ?", doc.DocumentID).
+					UpdateColumn("text_content", extractText(doc.Content)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
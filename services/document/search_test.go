@@ -0,0 +1,119 @@
+package document
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSearchOnlyViewableDocuments(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	mine := createTestDocument(t, s, paragraph(1, "the secret launch <codes>"))
+	createTestDocument(t, s, paragraph(2, "a secret budget"))
+	token := ownerToken(t, s, mine)
+
+	tests := []struct {
+		name   string
+		tokens []string
+		want   int
+	}{
+		{"no tokens", nil, 0},
+		{"unknown token", []string{"unknown"}, 0},
+		{"own token", []string{token}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.ListDocuments(ctx, ListOptions{Query: "secret", Tokens: tt.tokens, Total: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != tt.want || page.Total == nil || *page.Total != int64(tt.want) {
+				t.Fatalf("got %d items, total %v; want %d", len(page.Items), page.Total, tt.want)
+			}
+			for _, item := range page.Items {
+				if item.DocumentID != mine.DocumentID {
+					t.Errorf("listed %s, which the token does not open", item.DocumentID)
+				}
+				if want := "the <mark>secret</mark> launch &lt;codes&gt;"; item.Snippet != want {
+					t.Errorf("snippet = %q, want %q", item.Snippet, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRelevance(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	body := createTestDocument(t, s, paragraph(1, "notes on the roadmap"))
+	title, _, err := s.CreateDocument(ctx, "Roadmap", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := createTestDocument(t, s, paragraph(2, "unrelated"))
+	tokens := []string{ownerToken(t, s, body), ownerToken(t, s, title), ownerToken(t, s, other)}
+
+	page, err := s.ListDocuments(ctx, ListOptions{Query: "roadmap", Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Items[0].DocumentID != title.DocumentID || page.Items[1].DocumentID != body.DocumentID {
+		t.Fatalf("results = %+v, want the title match before the body match", page.Items)
+	}
+	if page.Items[0].Snippet != "" {
+		t.Errorf("title-only match snippet = %q, want none", page.Items[0].Snippet)
+	}
+}
+
+// TestSearchEscapesWildcards checks that %, _ and \ in a query match
+// themselves, not any text.
+func TestSearchEscapesWildcards(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	percent := createTestDocument(t, s, paragraph(1, "100% done"))
+	underscore := createTestDocument(t, s, paragraph(3, "call snake_case"))
+	backslash := createTestDocument(t, s, paragraph(5, `path C:\temp`))
+	tokens := []string{ownerToken(t, s, percent), ownerToken(t, s, underscore), ownerToken(t, s, backslash)}
+	for i, text := range []string{"100 items done", "call snakeXcase", "path C:temp"} {
+		tokens = append(tokens, ownerToken(t, s, createTestDocument(t, s, paragraph(uint64(10+i), text))))
+	}
+
+	tests := []struct {
+		query string
+		want  Document
+	}{
+		{"100%", percent},
+		{"snake_case", underscore},
+		{`C:\temp`, backslash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			page, err := s.ListDocuments(ctx, ListOptions{Query: tt.query, Tokens: tokens})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != 1 || page.Items[0].DocumentID != tt.want.DocumentID {
+				t.Fatalf("results = %+v, want only %s", page.Items, tt.want.DocumentID)
+			}
+		})
+	}
+}
+
+func TestLikeSnippet(t *testing.T) {
+	// 60 characters of context are kept around the match.
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("c", 100)
+	tests := []struct {
+		text, query, want string
+	}{
+		{"Find the Needle here", "needle", "Find the <mark>Needle</mark> here"},
+		{"no match", "needle", ""},
+		{"a <b> & c", "<b>", "a <mark>&lt;b&gt;</mark> &amp; c"},
+		{long, "needle", "… " + strings.Repeat("a", 59) + " <mark>needle</mark> " + strings.Repeat("c", 59) + " …"},
+	}
+	for _, tt := range tests {
+		if got := likeSnippet(tt.text, tt.query); got != tt.want {
+			t.Errorf("likeSnippet(%q, %q) = %q, want %q", tt.text, tt.query, got, tt.want)
+		}
+	}
+}
@@ -9,15 +9,23 @@ import (
 	"strconv"
 	"time"
 
+	"doclet/shared/access"
+	"doclet/shared/metrics"
+	"doclet/shared/ticket"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
-	store *Store
+	store     *Store
+	events    *Publisher
+	ticketKey []byte
+	ticketTTL time.Duration
 }
 
 type CreateDocumentRequest struct {
@@ -29,21 +37,26 @@ type UpdateTitleRequest struct {
 }
 
 type DocumentResponse struct {
-	DocumentID  string `json:"document_id"`
-	DisplayName string `json:"displayName"`
-	Content     string `json:"content"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-}
-
-type DocumentListItem struct {
-	DocumentID  string `json:"document_id"`
-	DisplayName string `json:"displayName"`
-	UpdatedAt   string `json:"updated_at"`
+	DocumentID  string                 `json:"document_id"`
+	DisplayName string                 `json:"displayName"`
+	Content     string                 `json:"content"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+	FolderID    string                 `json:"folder_id,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	// ShareToken is the owner token, returned only when the document is
+	// created.
+	ShareToken string `json:"share_token,omitempty"`
 }
 
-func NewServer(store *Store) *Server {
-	return &Server{store: store}
+func NewServer(store *Store, events *Publisher, cfg Config) *Server {
+	return &Server{
+		store:     store,
+		events:    events,
+		ticketKey: []byte(cfg.TicketKey),
+		ticketTTL: cfg.TicketTTL,
+	}
 }
 
 func (s *Server) Router() http.Handler {
@@ -52,22 +65,76 @@ func (s *Server) Router() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Content-Type"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
 	}))
 
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	r.Handle("/metrics", metrics.Handler())
 
 	r.Route("/documents", func(r chi.Router) {
 		r.Post("/", s.handleCreateDocument)
+		r.Post("/import", s.handleImportDocument)
 		r.Get("/", s.handleListDocuments)
+		r.Get("/trash", s.handleListTrash)
 		r.Get("/{document_id}", s.handleGetDocument)
+		r.Get("/{document_id}/export", s.handleExportDocument)
+		r.Get("/{document_id}/state", s.handleGetState)
 		r.Put("/{document_id}/title", s.handleUpdateTitle)
 		r.Delete("/{document_id}", s.handleDeleteDocument)
+		r.Post("/{document_id}/restore", s.handleRestoreDocument)
+		r.Post("/{document_id}/versions", s.handleCreateVersion)
+		r.Get("/{document_id}/versions", s.handleListVersions)
+		r.Get("/{document_id}/versions/{version}", s.handleGetVersion)
+		r.Post("/{document_id}/versions/{version}/restore", s.handleRestoreVersion)
+		r.Get("/{document_id}/access", s.handleGetAccess)
+		r.Post("/{document_id}/tickets", s.handleCreateTicket)
+		r.Post("/{document_id}/shares", s.handleCreateShare)
+		r.Get("/{document_id}/shares", s.handleListShares)
+		r.Delete("/{document_id}/shares/{token}", s.handleDeleteShare)
+		r.Put("/{document_id}/folder", s.handleMoveDocument)
+		r.Get("/{document_id}/tags", s.handleListTags)
+		r.Post("/{document_id}/tags", s.handleAddTags)
+		r.Delete("/{document_id}/tags/{tag}", s.handleRemoveTag)
+		r.Put("/{document_id}/metadata", s.handleSetMetadata)
+		r.Get("/{document_id}/threads", s.handleListThreads)
+		r.Post("/{document_id}/threads", s.handleCreateThread)
+		r.Get("/{document_id}/threads/{thread_id}", s.handleGetThread)
+		r.Delete("/{document_id}/threads/{thread_id}", s.handleDeleteThread)
+		r.Post("/{document_id}/threads/{thread_id}/resolve", s.handleResolveThread)
+		r.Post("/{document_id}/threads/{thread_id}/reopen", s.handleReopenThread)
+		r.Post("/{document_id}/threads/{thread_id}/comments", s.handleAddComment)
+		r.Put("/{document_id}/threads/{thread_id}/comments/{comment_id}", s.handleUpdateComment)
+		r.Delete("/{document_id}/threads/{thread_id}/comments/{comment_id}", s.handleDeleteComment)
+		r.Get("/{document_id}/suggestions", s.handleListSuggestions)
+		r.Get("/{document_id}/suggestions/{suggestion_id}", s.handleGetSuggestion)
+		r.Post("/{document_id}/suggestions/{suggestion_id}/accept", s.handleAcceptSuggestion)
+		r.Post("/{document_id}/suggestions/{suggestion_id}/reject", s.handleRejectSuggestion)
+	})
+
+	// Workspaces and folders need the token returned when the workspace was
+	// created; filing a document needs an editor token of the document.
+	r.Route("/workspaces", func(r chi.Router) {
+		r.Post("/", s.handleCreateWorkspace)
+		r.Get("/", s.handleListWorkspaces)
+		r.Get("/{workspace_id}", s.handleGetWorkspace)
+		r.Put("/{workspace_id}", s.handleRenameWorkspace)
+		r.Delete("/{workspace_id}", s.handleDeleteWorkspace)
+		r.Post("/{workspace_id}/folders", s.handleCreateFolder)
+		r.Get("/{workspace_id}/folders", s.handleListFolders)
+	})
+	r.Route("/folders", func(r chi.Router) {
+		r.Get("/{folder_id}", s.handleGetFolder)
+		r.Put("/{folder_id}/name", s.handleRenameFolder)
+		r.Put("/{folder_id}/parent", s.handleMoveFolder)
+		r.Delete("/{folder_id}", s.handleDeleteFolder)
 	})
 
-	return r
+	// Spans are renamed to the matched route in logRequests.
+	return otelhttp.NewHandler(r, "document", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/healthz" && r.URL.Path != "/metrics"
+	}))
 }
 
 func logRequests(next http.Handler) http.Handler {
@@ -75,6 +142,13 @@ func logRequests(next http.Handler) http.Handler {
 		start := time.Now()
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 		next.ServeHTTP(ww, r)
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		metrics.ObserveRequest("document", r.Method, route, ww.Status(), time.Since(start))
 		log.Printf("document %s %s %d %s", r.Method, r.URL.Path, ww.Status(), time.Since(start))
 	})
 }
@@ -85,14 +159,16 @@ func (s *Server) handleCreateDocument(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json"})
 		return
 	}
-	doc, err := s.store.CreateDocument(r.Context(), req.DisplayName)
+	doc, owner, err := s.store.CreateDocument(r.Context(), req.DisplayName, nil)
 	if err != nil {
 		log.Printf("create document error: %v", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create_failed"})
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, documentToResponse(doc))
+	resp := documentToResponse(doc)
+	resp.ShareToken = owner.Token
+	writeJSON(w, http.StatusCreated, resp)
 }
 
 func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +178,9 @@ func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
 		return
 	}
+	if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
+	}
 	doc, err := s.store.GetDocument(r.Context(), docID)
 	if err != nil {
 		if IsNotFound(err) {
@@ -113,33 +192,49 @@ func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, documentToResponse(doc))
-}
+	tags, err := s.store.ListTags(r.Context(), docID)
+	if err != nil {
+		log.Printf("list tags error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return
+	}
 
-func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("query")
-	limit := parseInt(r.URL.Query().Get("limit"), 50)
-	offset := parseInt(r.URL.Query().Get("offset"), 0)
+	resp := documentToResponse(doc)
+	resp.Tags = tags
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	docs, err := s.store.ListDocuments(r.Context(), query, limit, offset)
+// handleGetState returns the document's Yjs state with the update log
+// merged in, which collab loads when a document's first client joins. Besides
+// share tokens it accepts the collab session ticket the client joined with.
+func (s *Server) handleGetState(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(chi.URLParam(r, "document_id"))
 	if err != nil {
-		log.Printf("list documents error: %v", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "list_failed"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
 		return
 	}
-
-	items := make([]DocumentListItem, 0, len(docs))
-	for _, doc := range docs {
-		items = append(items, DocumentListItem{
-			DocumentID:  doc.DocumentID.String(),
-			DisplayName: doc.DisplayName,
-			UpdatedAt:   doc.UpdatedAt.UTC().Format(time.RFC3339),
-		})
+	if raw := r.URL.Query().Get("ticket"); raw != "" && len(s.ticketKey) > 0 {
+		t, err := ticket.Verify(s.ticketKey, raw, time.Now())
+		if err != nil || t.DocumentID != docID.String() {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+	} else if !s.authorize(w, r, docID, access.RoleViewer) {
+		return
 	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"items": items,
-	})
+	doc, err := s.store.GetDocument(r.Context(), docID)
+	if err != nil {
+		if IsNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		log.Printf("get state error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "fetch_failed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc.Content)
 }
 
 func (s *Server) handleUpdateTitle(w http.ResponseWriter, r *http.Request) {
@@ -160,6 +255,9 @@ func (s *Server) handleUpdateTitle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorize(w, r, docID, access.RoleEditor) {
+		return
+	}
 	if err := s.store.UpdateTitle(r.Context(), docID, req.DisplayName); err != nil {
 		if IsNotFound(err) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
@@ -173,27 +271,6 @@ func (s *Server) handleUpdateTitle(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "document_id")
-	docID, err := uuid.Parse(idParam)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_document_id"})
-		return
-	}
-
-	if err := s.store.DeleteDocument(r.Context(), docID); err != nil {
-		if IsNotFound(err) {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
-			return
-		}
-		log.Printf("delete document error: %v", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete_failed"})
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
 func documentToResponse(doc Document) DocumentResponse {
 	return DocumentResponse{
 		DocumentID:  doc.DocumentID.String(),
@@ -201,9 +278,19 @@ func documentToResponse(doc Document) DocumentResponse {
 		Content:     base64.StdEncoding.EncodeToString(doc.Content),
 		CreatedAt:   doc.CreatedAt.UTC().Format(time.RFC3339),
 		UpdatedAt:   doc.UpdatedAt.UTC().Format(time.RFC3339),
+		FolderID:    uuidString(doc.FolderID),
+		Metadata:    doc.Metadata,
 	}
 }
 
+// uuidString formats an optional ID, returning "" for nil.
+func uuidString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -222,7 +309,3 @@ func parseInt(value string, fallback int) int {
 	}
 	return parsed
 }
-
-func OpenDatabase(dsn string) (*gorm.DB, error) {
-	return gorm.Open(openPostgres(dsn), &gorm.Config{})
-}
@@ -0,0 +1,78 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"doclet/shared/access"
+)
+
+// newTestServer serves the document API over a fresh in-memory store.
+func newTestServer(t *testing.T) (*Store, *httptest.Server) {
+	t.Helper()
+	store := newTestStore(t)
+	ts := httptest.NewServer(NewServer(store, nil, Config{}).Router())
+	t.Cleanup(ts.Close)
+	return store, ts
+}
+
+// get requests path from ts with the share token, if any.
+func get(t *testing.T, ts *httptest.Server, path, token string) *http.Response {
+	t.Helper()
+	return request(t, ts, http.MethodGet, path, token, nil)
+}
+
+// request sends body, if not nil, as JSON.
+func request(t *testing.T, ts *httptest.Server, method, path, token string, body any) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decode reads a JSON response body into v.
+func decode(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ownerToken returns an owner share token of doc.
+func ownerToken(t *testing.T, s *Store, doc Document) string {
+	t.Helper()
+	shares, err := s.ListShares(context.Background(), doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, share := range shares {
+		if share.Role == string(access.RoleOwner) {
+			return share.Token
+		}
+	}
+	t.Fatal("no owner token")
+	return ""
+}
@@ -0,0 +1,164 @@
+package document
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+
+	"doclet/shared/access"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateShare mints a new share token granting role on the document.
+func (s *Store) CreateShare(ctx context.Context, id uuid.UUID, role access.Role) (ShareToken, error) {
+	var share ShareToken
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := tx.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		var err error
+		share, err = createShare(tx, id, role)
+		return err
+	})
+	return share, err
+}
+
+func createShare(db *gorm.DB, id uuid.UUID, role access.Role) (ShareToken, error) {
+	token, err := newToken()
+	if err != nil {
+		return ShareToken{}, err
+	}
+	share := ShareToken{
+		Token:      token,
+		DocumentID: id,
+		Role:       string(role),
+	}
+	if err := db.Create(&share).Error; err != nil {
+		return ShareToken{}, err
+	}
+	return share, nil
+}
+
+// newToken returns a random token for share links and workspaces.
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (s *Store) ListShares(ctx context.Context, id uuid.UUID) ([]ShareToken, error) {
+	var shares []ShareToken
+	if err := s.db.WithContext(ctx).
+		Where("document_id = ?", id).
+		Order("created_at asc").
+		Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// ErrLastOwner is returned when revoking a document's only owner token,
+// which would leave nobody able to manage it.
+var ErrLastOwner = errors.New("last owner token")
+
+// DeleteShare revokes a share token of the document. The last owner token
+// cannot be revoked.
+func (s *Store) DeleteShare(ctx context.Context, id uuid.UUID, token string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the document so concurrent revokes cannot both pass the
+		// owner check.
+		var doc Document
+		if err := s.forUpdate(tx).Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		var share ShareToken
+		if err := tx.First(&share, "document_id = ? AND token = ?", id, token).Error; err != nil {
+			return err
+		}
+		if share.Role == string(access.RoleOwner) {
+			var owners int64
+			if err := tx.Model(&ShareToken{}).
+				Where("document_id = ? AND role = ?", id, share.Role).
+				Count(&owners).Error; err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastOwner
+			}
+		}
+		return tx.Delete(&share).Error
+	})
+}
+
+// shareFilter narrows qb to documents one of tokens is a share token of.
+func shareFilter(qb *gorm.DB, tokens []string) *gorm.DB {
+	sub := qb.Session(&gorm.Session{NewDB: true}).
+		Model(&ShareToken{}).
+		Select("document_id").
+		Where("token IN ?", tokens)
+	return qb.Where("document_id IN (?)", sub)
+}
+
+// mintOwnerTokens gives every document without share tokens, which were
+// created before tokens existed, an owner token. Operators hand these out
+// from the share_tokens table.
+func mintOwnerTokens(db *gorm.DB) error {
+	var ids []uuid.UUID
+	if err := db.Unscoped().Model(&Document{}).
+		Where("document_id NOT IN (?)", db.Model(&ShareToken{}).Select("document_id")).
+		Pluck("document_id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := createShare(db, id, access.RoleOwner); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("minted owner tokens for %d documents without share tokens", len(ids))
+	}
+	return nil
+}
+
+// ResolveShare returns the role token grants on the document, or
+// access.ErrDenied.
+func (s *Store) ResolveShare(ctx context.Context, id uuid.UUID, token string) (access.Role, error) {
+	return s.resolveShare(s.db.WithContext(ctx), id, token, false)
+}
+
+// ResolveTrashedShare is ResolveShare for a document in the trash.
+func (s *Store) ResolveTrashedShare(ctx context.Context, id uuid.UUID, token string) (access.Role, error) {
+	return s.resolveShare(s.db.WithContext(ctx), id, token, true)
+}
+
+func (s *Store) resolveShare(db *gorm.DB, id uuid.UUID, token string, trashed bool) (access.Role, error) {
+	docs := db
+	if trashed {
+		docs = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	var doc Document
+	if err := docs.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", access.ErrDenied
+	}
+	var share ShareToken
+	err := db.First(&share, "document_id = ? AND token = ?", id, token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", access.ErrDenied
+	}
+	if err != nil {
+		return "", err
+	}
+	if role, ok := access.ParseRole(share.Role); ok {
+		return role, nil
+	}
+	return "", access.ErrDenied
+}
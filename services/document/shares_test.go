@@ -0,0 +1,140 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"doclet/shared/access"
+)
+
+func TestResolveShareDeniesWithoutToken(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, nil)
+	token := ownerToken(t, s, doc)
+
+	if role, err := s.ResolveShare(ctx, doc.DocumentID, token); err != nil || role != access.RoleOwner {
+		t.Fatalf("ResolveShare(owner) = %q, %v", role, err)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if _, err := s.ResolveShare(ctx, doc.DocumentID, token); !errors.Is(err, access.ErrDenied) {
+			t.Errorf("ResolveShare(%q) error = %v, want ErrDenied", token, err)
+		}
+	}
+
+	// A document without any tokens is closed, not open.
+	if err := s.db.Where("document_id = ?", doc.DocumentID).Delete(&ShareToken{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ResolveShare(ctx, doc.DocumentID, ""); !errors.Is(err, access.ErrDenied) {
+		t.Errorf("ResolveShare without tokens error = %v, want ErrDenied", err)
+	}
+}
+
+func TestMintOwnerTokens(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	legacy := createTestDocument(t, s, nil)
+	if err := s.db.Where("document_id = ?", legacy.DocumentID).Delete(&ShareToken{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	shared := createTestDocument(t, s, nil)
+
+	for range 2 {
+		if err := mintOwnerTokens(s.db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, doc := range []Document{legacy, shared} {
+		shares, err := s.ListShares(ctx, doc.DocumentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shares) != 1 || shares[0].Role != string(access.RoleOwner) {
+			t.Errorf("shares of %s = %+v, want one owner token", doc.DocumentID, shares)
+		}
+	}
+}
+
+func TestDeleteLastOwner(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, nil)
+	first := ownerToken(t, s, doc)
+
+	if err := s.DeleteShare(ctx, doc.DocumentID, first); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("deleting the only owner token: error = %v, want ErrLastOwner", err)
+	}
+	second, err := s.CreateShare(ctx, doc.DocumentID, access.RoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer, err := s.CreateShare(ctx, doc.DocumentID, access.RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteShare(ctx, doc.DocumentID, first); err != nil {
+		t.Fatalf("deleting one of two owner tokens: %v", err)
+	}
+	if err := s.DeleteShare(ctx, doc.DocumentID, second.Token); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("deleting the remaining owner token: error = %v, want ErrLastOwner", err)
+	}
+	if err := s.DeleteShare(ctx, doc.DocumentID, viewer.Token); err != nil {
+		t.Errorf("deleting a viewer token: %v", err)
+	}
+}
+
+func TestListingsScopedToTokens(t *testing.T) {
+	s, ts := newTestServer(t)
+	one := createTestDocument(t, s, nil)
+	two := createTestDocument(t, s, nil)
+	trashed := createTestDocument(t, s, nil)
+	tokenOne, tokenTwo, tokenTrashed := ownerToken(t, s, one), ownerToken(t, s, two), ownerToken(t, s, trashed)
+	if err := s.DeleteDocument(context.Background(), trashed.DocumentID); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(path, token string) []string {
+		t.Helper()
+		resp := get(t, ts, path, token)
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+		}
+		var body DocumentListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, item := range body.Items {
+			ids = append(ids, item.DocumentID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+
+	tests := []struct {
+		path, token string
+		want        []string
+	}{
+		{"/documents", "", nil},
+		{"/documents", "unknown", nil},
+		{"/documents", tokenOne, sorted(one.DocumentID.String())},
+		{"/documents", tokenOne + ", " + tokenTwo + "," + tokenTrashed, sorted(one.DocumentID.String(), two.DocumentID.String())},
+		{"/documents?token=" + tokenTwo, "", sorted(two.DocumentID.String())},
+		{"/documents/trash", "", nil},
+		{"/documents/trash", tokenOne, nil},
+		{"/documents/trash", tokenTrashed, sorted(trashed.DocumentID.String())},
+	}
+	for _, tt := range tests {
+		if got := list(tt.path, tt.token); !slices.Equal(got, tt.want) {
+			t.Errorf("GET %s with %q = %v, want %v", tt.path, tt.token, got, tt.want)
+		}
+	}
+}
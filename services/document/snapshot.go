@@ -0,0 +1,43 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+
+	"doclet/shared/yjs"
+)
+
+var ErrStaleSnapshot = errors.New("snapshot does not contain the stored state")
+
+// snapshotCovers reports whether the Yjs state next contains every struct
+// and deletion of current, i.e. whether storing next loses nothing.
+func snapshotCovers(next, current []byte) (bool, error) {
+	if len(current) == 0 {
+		return true, nil
+	}
+	nextDoc := yjs.NewDoc()
+	if err := nextDoc.ApplyUpdate(next); err != nil {
+		return false, fmt.Errorf("decode snapshot: %w", err)
+	}
+	currentDoc := yjs.NewDoc()
+	if err := currentDoc.ApplyUpdate(current); err != nil {
+		return false, fmt.Errorf("decode stored content: %w", err)
+	}
+	return nextDoc.Covers(currentDoc), nil
+}
+
+// mergeUpdates folds logged updates into a stored Yjs state.
+func mergeUpdates(content []byte, updates []DocumentUpdate) ([]byte, error) {
+	all := make([][]byte, 0, len(updates)+1)
+	if len(content) > 0 {
+		all = append(all, content)
+	}
+	for _, u := range updates {
+		all = append(all, u.Update)
+	}
+	return yjs.MergeUpdates(all...)
+}
+
+func IsStaleSnapshot(err error) bool {
+	return errors.Is(err, ErrStaleSnapshot)
+}
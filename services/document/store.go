@@ -3,76 +3,116 @@ package document
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
+	"doclet/shared/access"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Store is the document storage over GORM. It works with Postgres and
+// SQLite; the few dialect differences are handled by forUpdate and the
+// search fallback in ListDocuments.
 type Store struct {
-	db *gorm.DB
+	db      *gorm.DB
+	dialect string
 }
 
 func NewStore(db *gorm.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: db, dialect: db.Dialector.Name()}
 }
 
-func (s *Store) CreateDocument(ctx context.Context, displayName string) (Document, error) {
+// CreateDocument stores a new document with the given Yjs state, which may
+// be nil for an empty document, together with its owner share token.
+func (s *Store) CreateDocument(ctx context.Context, displayName string, content []byte) (Document, ShareToken, error) {
 	name := displayName
 	if name == "" {
 		name = DefaultDisplayName
 	}
+	if content == nil {
+		content = []byte{}
+	}
 	doc := Document{
 		DocumentID:  uuid.New(),
 		DisplayName: name,
-		Content:     []byte{},
+		Content:     content,
+		TextContent: extractText(content),
 	}
-	if err := s.db.WithContext(ctx).Create(&doc).Error; err != nil {
-		return Document{}, err
+	var owner ShareToken
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doc).Error; err != nil {
+			return err
+		}
+		var err error
+		owner, err = createShare(tx, doc.DocumentID, access.RoleOwner)
+		return err
+	})
+	if err != nil {
+		return Document{}, ShareToken{}, err
 	}
-	return doc, nil
+	return doc, owner, nil
 }
 
+// GetDocument returns the document with any logged updates that have not
+// been compacted yet merged into its content.
 func (s *Store) GetDocument(ctx context.Context, id uuid.UUID) (Document, error) {
-	var doc Document
-	if err := s.db.WithContext(ctx).First(&doc, "document_id = ?", id).Error; err != nil {
-		return Document{}, err
-	}
-	return doc, nil
+	return s.loadDocument(s.db.WithContext(ctx), id, false)
 }
 
-func (s *Store) ListDocuments(ctx context.Context, query string, limit, offset int) ([]Document, error) {
-	if limit <= 0 {
-		limit = 50
+// loadDocument reads the document and merges pending updates into its
+// content, optionally locking the row for the rest of the transaction.
+func (s *Store) loadDocument(db *gorm.DB, id uuid.UUID, lock bool) (Document, error) {
+	query := db
+	if lock {
+		query = s.forUpdate(db)
 	}
-	if limit > 100 {
-		limit = 100
+	var doc Document
+	if err := query.First(&doc, "document_id = ?", id).Error; err != nil {
+		return Document{}, err
 	}
-	qb := s.db.WithContext(ctx).Model(&Document{})
-	if query != "" {
-		qb = qb.Where("display_name ILIKE ?", "%"+query+"%")
+	updates, err := s.pendingUpdates(db, id)
+	if err != nil {
+		return Document{}, err
 	}
-	var docs []Document
-	if err := qb.Order("updated_at desc").Limit(limit).Offset(offset).Find(&docs).Error; err != nil {
-		return nil, err
+	if len(updates) > 0 {
+		content, err := mergeUpdates(doc.Content, updates)
+		if err != nil {
+			return Document{}, err
+		}
+		doc.Content = content
 	}
-	return docs, nil
+	return doc, nil
 }
 
+// UpdateContent replaces the stored Yjs state with content, provided content
+// is a superset of it; otherwise ErrStaleSnapshot is returned.
 func (s *Store) UpdateContent(ctx context.Context, id uuid.UUID, content []byte) error {
-	result := s.db.WithContext(ctx).Model(&Document{}).
-		Where("document_id = ?", id).
-		Updates(map[string]interface{}{
-			"content":    content,
-			"updated_at": time.Now().UTC(),
-		})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	return nil
+	start := time.Now()
+	defer func() { snapshotWriteDuration.Observe(time.Since(start).Seconds()) }()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := s.forUpdate(tx).
+			Select("document_id", "content").
+			First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		covers, err := snapshotCovers(content, doc.Content)
+		if err != nil {
+			return err
+		}
+		if !covers {
+			return ErrStaleSnapshot
+		}
+		return tx.Model(&Document{}).
+			Where("document_id = ?", id).
+			Updates(map[string]interface{}{
+				"content":      content,
+				"text_content": extractText(content),
+				"updated_at":   time.Now().UTC(),
+			}).Error
+	})
 }
 
 func (s *Store) UpdateTitle(ctx context.Context, id uuid.UUID, title string) error {
@@ -91,17 +131,119 @@ func (s *Store) UpdateTitle(ctx context.Context, id uuid.UUID, title string) err
 	return nil
 }
 
+// DeleteDocument moves the document to the trash. Pending updates are
+// folded into its content first, since compaction skips trashed documents.
 func (s *Store) DeleteDocument(ctx context.Context, id uuid.UUID) error {
-	result := s.db.WithContext(ctx).Delete(&Document{}, "document_id = ?", id)
-	if result.Error != nil {
-		return result.Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		doc, err := s.loadDocument(tx, id, true)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&Document{}).
+			Where("document_id = ?", id).
+			Updates(map[string]interface{}{
+				"content":      doc.Content,
+				"text_content": extractText(doc.Content),
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&DocumentUpdate{}, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Document{}, "document_id = ?", id).Error
+	})
+}
+
+// AppendUpdate adds a Yjs update to the document's update log.
+func (s *Store) AppendUpdate(ctx context.Context, id uuid.UUID, clientID string, update []byte) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := tx.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DocumentUpdate{
+			DocumentID: id,
+			ClientID:   clientID,
+			Update:     update,
+		}).Error
+	})
+}
+
+// Compact folds the document's logged updates into its content and removes
+// them from the log.
+func (s *Store) Compact(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := s.forUpdate(tx).
+			Select("document_id", "content").
+			First(&doc, "document_id = ?", id).Error; err != nil {
+			if IsNotFound(err) {
+				// Updates that raced with a delete have nothing to fold into.
+				return tx.Delete(&DocumentUpdate{}, "document_id = ?", id).Error
+			}
+			return err
+		}
+		updates, err := s.pendingUpdates(tx, id)
+		if err != nil || len(updates) == 0 {
+			return err
+		}
+		content, err := mergeUpdates(doc.Content, updates)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&Document{}).
+			Where("document_id = ?", id).
+			Updates(map[string]interface{}{
+				"content":      content,
+				"text_content": extractText(content),
+				"updated_at":   time.Now().UTC(),
+			}).Error; err != nil {
+			return err
+		}
+		// Only remove what was folded in: updates appended since the read
+		// may have lower sequence numbers than the last one read.
+		seqs := make([]uint64, len(updates))
+		for i, u := range updates {
+			seqs[i] = u.Seq
+		}
+		for batch := range slices.Chunk(seqs, 1000) {
+			if err := tx.Where("document_id = ? AND seq IN ?", id, batch).Delete(&DocumentUpdate{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DocumentsWithPendingUpdates lists documents that have updates waiting for
+// compaction.
+func (s *Store) DocumentsWithPendingUpdates(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&DocumentUpdate{}).
+		Distinct("document_id").
+		Pluck("document_id", &ids).Error; err != nil {
+		return nil, err
 	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+	return ids, nil
+}
+
+func (s *Store) pendingUpdates(db *gorm.DB, id uuid.UUID) ([]DocumentUpdate, error) {
+	var updates []DocumentUpdate
+	if err := db.Where("document_id = ?", id).Order("seq asc").Find(&updates).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	return updates, nil
 }
 
 func IsNotFound(err error) bool {
 	return errors.Is(err, gorm.ErrRecordNotFound)
 }
+
+// forUpdate locks the selected rows until the transaction ends. SQLite has no
+// row locks; its single connection already serializes transactions.
+func (s *Store) forUpdate(db *gorm.DB) *gorm.DB {
+	if s.dialect == dialectSQLite {
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
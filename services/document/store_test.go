@@ -0,0 +1,154 @@
+package document
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"doclet/shared/yjs"
+	"gorm.io/gorm"
+)
+
+// newTestStore opens a migrated in-memory SQLite database.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := OpenDatabase("sqlite::memory:")
+	if err == nil {
+		err = RunMigrations(db)
+	}
+	if err != nil {
+		t.Skipf("sqlite unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewStore(db)
+}
+
+// paragraph returns an update by client appending a paragraph with text
+// to the default fragment.
+func paragraph(client uint64, text string) []byte {
+	return yjs.EncodeXmlFragment("default", client, []*yjs.XmlNode{{
+		Name:     "paragraph",
+		Children: []*yjs.XmlNode{{Runs: []yjs.TextRun{{Text: text}}}},
+	}})
+}
+
+func createTestDocument(t *testing.T, s *Store, content []byte) Document {
+	t.Helper()
+	doc, _, err := s.CreateDocument(context.Background(), "Test", content)
+	if err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+	return doc
+}
+
+func pendingCount(t *testing.T, s *Store, doc Document) int {
+	t.Helper()
+	updates, err := s.pendingUpdates(s.db, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(updates)
+}
+
+func TestGetDocumentIncludesUpdateLog(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, paragraph(1, "stored"))
+	if err := s.AppendUpdate(ctx, doc.DocumentID, "c1", paragraph(2, "logged")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetDocument(ctx, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := extractText(got.Content)
+	if !strings.Contains(text, "stored") || !strings.Contains(text, "logged") {
+		t.Errorf("content text = %q, want stored and logged", text)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, paragraph(1, "stored"))
+	for i, text := range []string{"first", "second"} {
+		if err := s.AppendUpdate(ctx, doc.DocumentID, "c", paragraph(uint64(10+i), text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Compact(ctx, doc.DocumentID); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingCount(t, s, doc); n != 0 {
+		t.Errorf("%d updates left after compaction", n)
+	}
+	var stored Document
+	if err := s.db.First(&stored, "document_id = ?", doc.DocumentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"stored", "first", "second"} {
+		if !strings.Contains(stored.TextContent, want) {
+			t.Errorf("compacted text %q lacks %q", stored.TextContent, want)
+		}
+	}
+	pending, err := s.DocumentsWithPendingUpdates(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("DocumentsWithPendingUpdates = %v, %v; want none", pending, err)
+	}
+}
+
+// TestCompactKeepsConcurrentUpdates appends an update with a lower
+// sequence number than the last one compaction read, as a transaction
+// committing late does on Postgres, and checks it survives.
+func TestCompactKeepsConcurrentUpdates(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, nil)
+	if err := s.AppendUpdate(ctx, doc.DocumentID, "c", paragraph(10, "early")); err != nil {
+		t.Fatal(err)
+	}
+	late := DocumentUpdate{Seq: 100, DocumentID: doc.DocumentID, ClientID: "c", Update: paragraph(11, "read")}
+	if err := s.db.Create(&late).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	injected := false
+	err := s.db.Callback().Query().After("gorm:query").Register("test:late_update", func(tx *gorm.DB) {
+		if injected || tx.Statement.Table != "document_updates" {
+			return
+		}
+		injected = true
+		raced := DocumentUpdate{Seq: 50, DocumentID: doc.DocumentID, ClientID: "c", Update: paragraph(12, "raced")}
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(&raced).Error; err != nil {
+			t.Errorf("inject update: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compact(ctx, doc.DocumentID); err != nil {
+		t.Fatal(err)
+	}
+	s.db.Callback().Query().Remove("test:late_update")
+
+	updates, err := s.pendingUpdates(s.db, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !injected || len(updates) != 1 || updates[0].Seq != 50 {
+		t.Fatalf("updates left = %+v, want the one appended during compaction", updates)
+	}
+	got, err := s.GetDocument(ctx, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := extractText(got.Content); !strings.Contains(text, "raced") || !strings.Contains(text, "read") {
+		t.Errorf("content text = %q, want raced and read", text)
+	}
+}
@@ -0,0 +1,173 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"doclet/shared/yjs"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSuggestionStatus = errors.New("invalid suggestion status")
+	// ErrSuggestionResolved is returned when accepting or rejecting a
+	// suggestion that is no longer pending.
+	ErrSuggestionResolved = errors.New("suggestion already resolved")
+	// ErrSuggestionConflict is returned when a suggestion builds on edits
+	// the document does not have, typically an earlier suggestion of the
+	// same client that was rejected or is still pending.
+	ErrSuggestionConflict = errors.New("suggestion depends on edits the document lacks")
+)
+
+// CreateSuggestion stores update as a pending suggestion by authorID. The
+// range it changes is taken from the update itself.
+func (s *Store) CreateSuggestion(ctx context.Context, docID uuid.UUID, authorID string, update []byte) (Suggestion, error) {
+	start, end, ok, err := yjs.UpdateRange(update)
+	if err != nil {
+		return Suggestion{}, err
+	}
+	suggestion := Suggestion{
+		SuggestionID: uuid.New(),
+		DocumentID:   docID,
+		AuthorID:     authorID,
+		Update:       update,
+		Status:       SuggestionStatusPending,
+	}
+	if ok {
+		suggestion.AnchorStart, suggestion.AnchorEnd = start.Encode(), end.Encode()
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := tx.Select("document_id").First(&doc, "document_id = ?", docID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&suggestion).Error
+	})
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// ListSuggestions returns the document's suggestions, oldest first. A
+// non-empty status only lists suggestions in that state.
+func (s *Store) ListSuggestions(ctx context.Context, docID uuid.UUID, status string) ([]Suggestion, error) {
+	switch status {
+	case "", SuggestionStatusPending, SuggestionStatusAccepted, SuggestionStatusRejected:
+	default:
+		return nil, ErrInvalidSuggestionStatus
+	}
+	db := s.db.WithContext(ctx)
+	var doc Document
+	if err := db.Select("document_id").First(&doc, "document_id = ?", docID).Error; err != nil {
+		return nil, err
+	}
+	query := db.Where("document_id = ?", docID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	suggestions := []Suggestion{}
+	if err := query.Order("created_at asc, suggestion_id asc").Find(&suggestions).Error; err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+func (s *Store) GetSuggestion(ctx context.Context, docID, suggestionID uuid.UUID) (Suggestion, error) {
+	var suggestion Suggestion
+	if err := s.db.WithContext(ctx).
+		First(&suggestion, "suggestion_id = ? AND document_id = ?", suggestionID, docID).Error; err != nil {
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// AcceptSuggestion appends the suggestion's update to the document's update
+// log under its author's client ID and marks it accepted. The caller
+// broadcasts suggestion.Update to connected editors.
+func (s *Store) AcceptSuggestion(ctx context.Context, docID, suggestionID uuid.UUID, by string) (Suggestion, error) {
+	var suggestion Suggestion
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		doc, err := s.loadDocument(tx, docID, true)
+		if err != nil {
+			return err
+		}
+		if suggestion, err = loadPendingSuggestion(tx, docID, suggestionID); err != nil {
+			return err
+		}
+		current := yjs.NewDoc()
+		if len(doc.Content) > 0 {
+			if err := current.ApplyUpdate(doc.Content); err != nil {
+				return err
+			}
+		}
+		ok, err := current.CanApply(suggestion.Update)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrSuggestionConflict
+		}
+		if err := tx.Create(&DocumentUpdate{
+			DocumentID: docID,
+			ClientID:   suggestion.AuthorID,
+			Update:     suggestion.Update,
+		}).Error; err != nil {
+			return err
+		}
+		return resolveSuggestion(tx, &suggestion, SuggestionStatusAccepted, by)
+	})
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// RejectSuggestion marks a pending suggestion rejected; its update is never
+// applied.
+func (s *Store) RejectSuggestion(ctx context.Context, docID, suggestionID uuid.UUID, by string) (Suggestion, error) {
+	var suggestion Suggestion
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := s.forUpdate(tx).Select("document_id").First(&doc, "document_id = ?", docID).Error; err != nil {
+			return err
+		}
+		var err error
+		if suggestion, err = loadPendingSuggestion(tx, docID, suggestionID); err != nil {
+			return err
+		}
+		return resolveSuggestion(tx, &suggestion, SuggestionStatusRejected, by)
+	})
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+func loadPendingSuggestion(db *gorm.DB, docID, suggestionID uuid.UUID) (Suggestion, error) {
+	var suggestion Suggestion
+	if err := db.First(&suggestion, "suggestion_id = ? AND document_id = ?", suggestionID, docID).Error; err != nil {
+		return Suggestion{}, err
+	}
+	if suggestion.Status != SuggestionStatusPending {
+		return Suggestion{}, ErrSuggestionResolved
+	}
+	return suggestion, nil
+}
+
+func resolveSuggestion(tx *gorm.DB, suggestion *Suggestion, status, by string) error {
+	now := time.Now().UTC()
+	suggestion.Status = status
+	suggestion.ResolvedAt, suggestion.ResolvedBy = &now, by
+	suggestion.UpdatedAt = now
+	return tx.Model(&Suggestion{}).
+		Where("suggestion_id = ?", suggestion.SuggestionID).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"resolved_at": now,
+			"resolved_by": by,
+			"updated_at":  now,
+		}).Error
+}
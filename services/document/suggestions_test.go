@@ -0,0 +1,63 @@
+package document
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"doclet/shared/access"
+	"doclet/shared/yjs"
+)
+
+// TestSuggestionIdentityIgnoresClientID checks that suggestions and their
+// resolutions are attributed to share tokens, whatever client_id the
+// messages and requests claim.
+func TestSuggestionIdentityIgnoresClientID(t *testing.T) {
+	store, ts := newTestServer(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, store, paragraph(1, "text"))
+	owner := ownerToken(t, store, doc)
+	editor, err := store.CreateShare(ctx, doc.DocumentID, access.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := yjs.EncodeXmlFragment(fragmentName, 2, []*yjs.XmlNode{{Name: "paragraph"}})
+	suggest := func(authorID string) {
+		data, err := json.Marshal(UpdateMessage{
+			Type:       "suggestion",
+			DocumentID: doc.DocumentID.String(),
+			ClientID:   "victim",
+			AuthorID:   authorID,
+			Payload:    base64.StdEncoding.EncodeToString(update),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handleSuggestion(ctx, store, nil, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	suggest("")
+	suggest(AuthorID(editor.Token))
+	suggestions, err := store.ListSuggestions(ctx, doc.DocumentID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].AuthorID != AuthorID(editor.Token) {
+		t.Fatalf("suggestions = %+v, want one by the editor token", suggestions)
+	}
+
+	path := "/documents/" + doc.DocumentID.String() + "/suggestions/" + suggestions[0].SuggestionID.String() + "/reject"
+	resp := request(t, ts, http.MethodPost, path, owner, map[string]string{"client_id": "victim"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reject: status %d", resp.StatusCode)
+	}
+	var rejected SuggestionResponse
+	decode(t, resp, &rejected)
+	if rejected.ResolvedBy != AuthorID(owner) {
+		t.Errorf("resolved_by = %q, want %q", rejected.ResolvedBy, AuthorID(owner))
+	}
+}
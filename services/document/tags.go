@@ -0,0 +1,215 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag filters of ListDocuments match documents with every tag (TagMatchAll,
+// the default) or with any of them (TagMatchAny).
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+const (
+	maxTagLength       = 64
+	maxTagsPerDocument = 32
+	// maxMetadataBytes caps the encoded size of Document.Metadata.
+	maxMetadataBytes = 4096
+)
+
+var (
+	ErrInvalidTag       = errors.New("invalid tag")
+	ErrInvalidTagMatch  = errors.New("invalid tag match")
+	ErrTooManyTags      = errors.New("too many tags")
+	ErrMetadataTooLarge = errors.New("metadata too large")
+)
+
+// NormalizeTag trims and lower-cases a tag. Tags may not be empty, longer
+// than maxTagLength, or contain commas or control characters.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > maxTagLength {
+		return "", ErrInvalidTag
+	}
+	if strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || unicode.IsControl(r) }) {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes and deduplicates tags, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			out = append(out, normalized)
+		}
+	}
+	return out, nil
+}
+
+// ListTags returns the document's tags in alphabetical order.
+func (s *Store) ListTags(ctx context.Context, id uuid.UUID) ([]string, error) {
+	db := s.db.WithContext(ctx)
+	var doc Document
+	if err := db.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return listTags(db, id)
+}
+
+// AddTags adds tags to the document and returns all of its tags. Tags it
+// already has are ignored.
+func (s *Store) AddTags(ctx context.Context, id uuid.UUID, tags []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the document keeps concurrent calls from both passing the
+		// limit check.
+		var doc Document
+		if err := s.forUpdate(tx).Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			rows := make([]DocumentTag, 0, len(tags))
+			for _, tag := range tags {
+				rows = append(rows, DocumentTag{DocumentID: id, Tag: tag})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		var err error
+		all, err = listTags(tx, id)
+		if err != nil {
+			return err
+		}
+		if len(all) > maxTagsPerDocument {
+			return ErrTooManyTags
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// RemoveTag removes a tag from the document and returns the remaining tags.
+// Removing a tag the document does not have is not an error.
+func (s *Store) RemoveTag(ctx context.Context, id uuid.UUID, tag string) ([]string, error) {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc Document
+		if err := tx.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&DocumentTag{}, "document_id = ? AND tag = ?", id, tag).Error; err != nil {
+			return err
+		}
+		var err error
+		all, err = listTags(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// SetMetadata replaces the document's metadata. A nil map clears it.
+func (s *Store) SetMetadata(ctx context.Context, id uuid.UUID, metadata map[string]interface{}) error {
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMetadataBytes {
+		return ErrMetadataTooLarge
+	}
+	result := s.db.WithContext(ctx).Model(&Document{}).
+		Where("document_id = ?", id).
+		Select("metadata").
+		Updates(&Document{Metadata: metadata})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func listTags(db *gorm.DB, id uuid.UUID) ([]string, error) {
+	tags := []string{}
+	if err := db.Model(&DocumentTag{}).
+		Where("document_id = ?", id).
+		Order("tag asc").
+		Pluck("tag", &tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// tagFilter restricts qb to documents carrying all or any of tags, which
+// must already be normalized.
+func tagFilter(qb *gorm.DB, tags []string, match string) *gorm.DB {
+	sub := qb.Session(&gorm.Session{NewDB: true}).
+		Model(&DocumentTag{}).
+		Select("document_id").
+		Where("tag IN ?", tags)
+	if match != TagMatchAny {
+		sub = sub.Group("document_id").Having("COUNT(*) = ?", len(tags))
+	}
+	return qb.Where("document_id IN (?)", sub)
+}
+
+// fillTags loads the tags of every listed document in one query.
+func fillTags(db *gorm.DB, docs []DocumentMatch) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.DocumentID)
+	}
+	var rows []DocumentTag
+	if err := db.Where("document_id IN ?", ids).Find(&rows).Error; err != nil {
+		return err
+	}
+	byDoc := make(map[uuid.UUID][]string, len(docs))
+	for _, row := range rows {
+		byDoc[row.DocumentID] = append(byDoc[row.DocumentID], row.Tag)
+	}
+	for i := range docs {
+		tags := byDoc[docs[i].DocumentID]
+		sort.Strings(tags)
+		docs[i].Tags = tags
+	}
+	return nil
+}
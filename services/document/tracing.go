@@ -0,0 +1,74 @@
+package document
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+var tracer = otel.Tracer("doclet/services/document")
+
+const tracingSpanKey = "doclet:span"
+
+// tracingPlugin wraps the statements Store runs in spans, so Store calls
+// show up under the request or message that caused them. Only statements
+// run with a context from WithContext that carries a span are traced, which
+// leaves out migrations and background jobs.
+type tracingPlugin struct{}
+
+func (tracingPlugin) Name() string { return "doclet:tracing" }
+
+func (tracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("doclet:trace_create", startStatementSpan("gorm.create")),
+		cb.Create().After("gorm:create").Register("doclet:trace_create_end", endStatementSpan),
+		cb.Query().Before("gorm:query").Register("doclet:trace_query", startStatementSpan("gorm.query")),
+		cb.Query().After("gorm:query").Register("doclet:trace_query_end", endStatementSpan),
+		cb.Update().Before("gorm:update").Register("doclet:trace_update", startStatementSpan("gorm.update")),
+		cb.Update().After("gorm:update").Register("doclet:trace_update_end", endStatementSpan),
+		cb.Delete().Before("gorm:delete").Register("doclet:trace_delete", startStatementSpan("gorm.delete")),
+		cb.Delete().After("gorm:delete").Register("doclet:trace_delete_end", endStatementSpan),
+		cb.Row().Before("gorm:row").Register("doclet:trace_row", startStatementSpan("gorm.row")),
+		cb.Row().After("gorm:row").Register("doclet:trace_row_end", endStatementSpan),
+		cb.Raw().Before("gorm:raw").Register("doclet:trace_raw", startStatementSpan("gorm.raw")),
+		cb.Raw().After("gorm:raw").Register("doclet:trace_raw_end", endStatementSpan),
+	)
+}
+
+func startStatementSpan(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if !trace.SpanContextFromContext(db.Statement.Context).IsValid() {
+			return
+		}
+		ctx, span := tracer.Start(db.Statement.Context, name, trace.WithSpanKind(trace.SpanKindClient))
+		db.Statement.Context = ctx
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endStatementSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+	span.SetAttributes(
+		semconv.DBSystemNameKey.String(db.Dialector.Name()),
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,119 @@
+package document
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListTrash lists the deleted documents tokens are share tokens of, most
+// recently deleted first.
+func (s *Store) ListTrash(ctx context.Context, tokens []string, limit, offset int) ([]Document, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	var docs []Document
+	if err := shareFilter(s.db.WithContext(ctx).Unscoped(), tokens).
+		Select("document_id", "display_name", "created_at", "updated_at", "deleted_at").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// RestoreDocument takes the document out of the trash.
+func (s *Store) RestoreDocument(ctx context.Context, id uuid.UUID) (Document, error) {
+	db := s.db.WithContext(ctx)
+	result := db.Unscoped().Model(&Document{}).
+		Where("document_id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return Document{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Document{}, gorm.ErrRecordNotFound
+	}
+	return s.loadDocument(db, id, false)
+}
+
+// PurgeDeleted permanently removes documents deleted before cutoff, with
+// their versions and share tokens, and returns their IDs.
+func (s *Store) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := s.db.WithContext(ctx).Unscoped().Model(&Document{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("document_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	purged := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		removed := false
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Unscoped().Delete(&Document{}, "document_id = ? AND deleted_at IS NOT NULL", id)
+			if result.Error != nil || result.RowsAffected == 0 {
+				// Restored since it was listed.
+				return result.Error
+			}
+			removed = true
+			if err := tx.Delete(&DocumentUpdate{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&ShareToken{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&DocumentTag{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&Comment{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&CommentThread{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&Suggestion{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&DocumentVersion{}, "document_id = ?", id).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+		if removed {
+			purged = append(purged, id)
+		}
+	}
+	return purged, nil
+}
+
+// RunPurger permanently removes documents that have been in the trash for
+// longer than retention, checking every interval until ctx is cancelled.
+func RunPurger(ctx context.Context, store *Store, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			ids, err := store.PurgeDeleted(purgeCtx, time.Now().Add(-retention))
+			cancel()
+			if err != nil {
+				log.Printf("purge error: %v", err)
+			}
+			if len(ids) > 0 {
+				log.Printf("purged %d deleted documents", len(ids))
+			}
+		}
+	}
+}
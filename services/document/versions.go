@@ -0,0 +1,215 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"doclet/shared/yjs"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateVersion stores the document's current state as a new version.
+func (s *Store) CreateVersion(ctx context.Context, id uuid.UUID, name, kind string) (DocumentVersion, error) {
+	var version DocumentVersion
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		doc, err := s.loadDocument(tx, id, true)
+		if err != nil {
+			return err
+		}
+		var last int
+		if err := tx.Model(&DocumentVersion{}).
+			Where("document_id = ?", id).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&last).Error; err != nil {
+			return err
+		}
+		version = DocumentVersion{
+			DocumentID: id,
+			Version:    last + 1,
+			Name:       name,
+			Kind:       kind,
+			Content:    doc.Content,
+		}
+		return tx.Create(&version).Error
+	})
+	if err != nil {
+		return DocumentVersion{}, err
+	}
+	return version, nil
+}
+
+// ListVersions returns the document's versions, newest first, without
+// their content.
+func (s *Store) ListVersions(ctx context.Context, id uuid.UUID) ([]DocumentVersion, error) {
+	db := s.db.WithContext(ctx)
+	var doc Document
+	if err := db.Select("document_id").First(&doc, "document_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	var versions []DocumentVersion
+	if err := db.Select("document_id", "version", "name", "kind", "created_at").
+		Where("document_id = ?", id).
+		Order("version desc").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *Store) GetVersion(ctx context.Context, id uuid.UUID, version int) (DocumentVersion, error) {
+	var v DocumentVersion
+	if err := s.db.WithContext(ctx).
+		First(&v, "document_id = ? AND version = ?", id, version).Error; err != nil {
+		return DocumentVersion{}, err
+	}
+	return v, nil
+}
+
+// RestoreVersion makes the document look like the given version again. It
+// returns the new document and the Yjs update that gets connected editors
+// there, so the caller can broadcast it.
+func (s *Store) RestoreVersion(ctx context.Context, id uuid.UUID, version int) (Document, []byte, error) {
+	var doc Document
+	var update []byte
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		doc, err = s.loadDocument(tx, id, true)
+		if err != nil {
+			return err
+		}
+		var v DocumentVersion
+		if err := tx.First(&v, "document_id = ? AND version = ?", id, version).Error; err != nil {
+			return err
+		}
+		if update, err = restoreUpdate(doc.Content, v.Content); err != nil {
+			return err
+		}
+		if doc.Content, err = mergeUpdates(doc.Content, []DocumentUpdate{{Update: update}}); err != nil {
+			return err
+		}
+		doc.UpdatedAt = time.Now().UTC()
+		return tx.Model(&Document{}).
+			Where("document_id = ?", id).
+			Updates(map[string]interface{}{
+				"content":      doc.Content,
+				"text_content": extractText(doc.Content),
+				"updated_at":   doc.UpdatedAt,
+			}).Error
+	})
+	if err != nil {
+		return Document{}, nil, err
+	}
+	return doc, update, nil
+}
+
+// DocumentsChangedSinceLastVersion lists non-empty documents updated after
+// their most recent version was taken, including documents without versions.
+func (s *Store) DocumentsChangedSinceLastVersion(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&Document{}).
+		Where("length(content) > 0").
+		Where("NOT EXISTS (SELECT 1 FROM document_versions v WHERE v.document_id = documents.document_id AND v.created_at >= documents.updated_at)").
+		Pluck("document_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// PruneAutoVersions deletes all but the newest keep auto versions.
+func (s *Store) PruneAutoVersions(ctx context.Context, id uuid.UUID, keep int) error {
+	db := s.db.WithContext(ctx)
+	var cutoff []int
+	if err := db.Model(&DocumentVersion{}).
+		Where("document_id = ? AND kind = ?", id, VersionKindAuto).
+		Order("version desc").
+		Offset(keep).
+		Limit(1).
+		Pluck("version", &cutoff).Error; err != nil {
+		return err
+	}
+	if len(cutoff) == 0 {
+		return nil
+	}
+	return db.Where("document_id = ? AND kind = ? AND version <= ?", id, VersionKindAuto, cutoff[0]).
+		Delete(&DocumentVersion{}).Error
+}
+
+// restoreUpdate builds an update that deletes everything in current and
+// re-creates target under a fresh client ID. Unlike overwriting the stored
+// content, it merges into every editor's state like any other edit. current
+// must be the live state, update log included, or edits only in the log
+// survive the restore.
+func restoreUpdate(current, target []byte) ([]byte, error) {
+	currentDoc := yjs.NewDoc()
+	if len(current) > 0 {
+		if err := currentDoc.ApplyUpdate(current); err != nil {
+			return nil, fmt.Errorf("decode stored content: %w", err)
+		}
+	}
+	targetDoc := yjs.NewDoc()
+	if len(target) > 0 {
+		if err := targetDoc.ApplyUpdate(target); err != nil {
+			return nil, fmt.Errorf("decode version content: %w", err)
+		}
+	}
+	client := unusedClientID(currentDoc, targetDoc)
+	return yjs.MergeUpdates(currentDoc.EncodeDeleteAll(), targetDoc.Rebase(client))
+}
+
+// unusedClientID picks a random 32-bit client ID, as Yjs does, that has
+// neither created nor deleted anything in docs. Reusing an ID would make
+// the restored items clash with existing ones.
+func unusedClientID(docs ...*yjs.Doc) uint64 {
+	used := make(map[uint64]bool)
+	for _, doc := range docs {
+		for _, client := range doc.Clients() {
+			used[client] = true
+		}
+	}
+	for {
+		if client := uint64(rand.Uint32()); !used[client] {
+			return client
+		}
+	}
+}
+
+// RunVersioner takes an auto version of every changed document each interval
+// and keeps the newest keep auto versions per document.
+func RunVersioner(ctx context.Context, store *Store, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshotChanged(ctx, store, keep)
+		}
+	}
+}
+
+func snapshotChanged(ctx context.Context, store *Store, keep int) {
+	ids, err := store.DocumentsChangedSinceLastVersion(ctx)
+	if err != nil {
+		log.Printf("versioning list error: %v", err)
+		return
+	}
+	for _, id := range ids {
+		versionCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		if _, err := store.CreateVersion(versionCtx, id, "", VersionKindAuto); err != nil {
+			if !IsNotFound(err) {
+				log.Printf("versioning error for %s: %v", id, err)
+			}
+			cancel()
+			continue
+		}
+		if err := store.PruneAutoVersions(versionCtx, id, keep); err != nil {
+			log.Printf("version pruning error for %s: %v", id, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,74 @@
+package document
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"doclet/shared/yjs"
+)
+
+func TestRestoreVersionDeletesLoggedEdits(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	doc := createTestDocument(t, s, paragraph(1, "kept"))
+	if _, err := s.CreateVersion(ctx, doc.DocumentID, "v1", VersionKindNamed); err != nil {
+		t.Fatal(err)
+	}
+	// An edit that only exists in the update log, not in the content.
+	if err := s.AppendUpdate(ctx, doc.DocumentID, "c", paragraph(2, "logged")); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, update, err := s.RestoreVersion(ctx, doc.DocumentID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := strings.TrimSpace(extractText(restored.Content)); text != "kept" {
+		t.Errorf("restored text = %q, want %q", text, "kept")
+	}
+	// Editors that saw the logged edit end up at the version too.
+	editor := yjs.NewDoc()
+	for _, u := range [][]byte{paragraph(1, "kept"), paragraph(2, "logged"), update} {
+		if err := editor.ApplyUpdate(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if text := strings.TrimSpace(extractText(editor.EncodeStateAsUpdate(nil))); text != "kept" {
+		t.Errorf("editor text after restore = %q, want %q", text, "kept")
+	}
+	if err := s.Compact(ctx, doc.DocumentID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetDocument(ctx, doc.DocumentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := strings.TrimSpace(extractText(got.Content)); text != "kept" {
+		t.Errorf("text after compaction = %q, want %q", text, "kept")
+	}
+}
+
+func TestRestoreUpdateUsesUnusedClient(t *testing.T) {
+	current, err := yjs.MergeUpdates(paragraph(1, "a"), paragraph(2, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, err := restoreUpdate(current, paragraph(3, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := yjs.DecodeUpdate(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.Structs) != 1 {
+		t.Fatalf("restore update has structs of %d clients, want 1", len(u.Structs))
+	}
+	for client := range u.Structs {
+		if slices.Contains([]uint64{1, 2, 3}, client) {
+			t.Errorf("restore update reuses client %d", client)
+		}
+	}
+}
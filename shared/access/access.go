@@ -0,0 +1,40 @@
+// Package access defines the roles a share token grants on a document.
+package access
+
+import "errors"
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+	RoleEditor    Role = "editor"
+	RoleOwner     Role = "owner"
+)
+
+// ErrDenied is returned when a token does not grant access to a document.
+var ErrDenied = errors.New("access denied")
+
+var levels = map[Role]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleOwner:     4,
+}
+
+// ParseRole returns the role named s and whether it exists.
+func ParseRole(s string) (Role, bool) {
+	role := Role(s)
+	_, ok := levels[role]
+	return role, ok
+}
+
+// Allows reports whether r grants everything min does.
+func (r Role) Allows(min Role) bool {
+	return levels[r] >= levels[min] && levels[r] > 0
+}
+
+// CanEdit reports whether r may change document content.
+func (r Role) CanEdit() bool {
+	return r.Allows(RoleEditor)
+}
@@ -0,0 +1,34 @@
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+// Broker is a subject-based publish/subscribe bus. Subjects follow NATS
+// syntax, and subscriptions may use the * and > wildcards. The trace
+// context of the ctx passed to Publish reaches the ctx handed to handlers.
+type Broker interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+	Subscribe(subject string, handler func(ctx context.Context, subject string, data []byte)) (Subscription, error)
+	Close()
+}
+
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Replayer is implemented by brokers that retain published messages.
+type Replayer interface {
+	// Replay hands every message stored on subject since the given time to
+	// handler, oldest first.
+	Replay(ctx context.Context, subject string, since time.Time, handler func(data []byte)) error
+}
+
+// DurableSubscriber is implemented by brokers that can track delivery for a
+// named consumer across restarts. A handler error asks for redelivery, which
+// is retried with backoff a bounded number of times; handlers return nil for
+// messages that can never succeed.
+type DurableSubscriber interface {
+	SubscribeDurable(ctx context.Context, durable, subject string, handler func(ctx context.Context, data []byte) error) error
+}
@@ -0,0 +1,181 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrClosed = errors.New("broker: closed")
+
+// Memory is an in-process Broker for single-binary installs and tests.
+// Like NATS, each subscription receives messages in publish order on its
+// own goroutine, so slow handlers never block publishers, and a
+// subscription that falls more than maxPending messages or
+// maxPendingBytes behind drops new messages until it catches up.
+type Memory struct {
+	mu     sync.RWMutex
+	subs   map[*memorySubscription]struct{}
+	closed bool
+}
+
+// Pending limits per subscription, the defaults of a NATS subscription.
+const (
+	maxPending      = 65536
+	maxPendingBytes = 64 * 1024 * 1024
+)
+
+type memoryMessage struct {
+	ctx     context.Context
+	subject string
+	data    []byte
+}
+
+type memorySubscription struct {
+	broker  *Memory
+	pattern []string
+	handler func(ctx context.Context, subject string, data []byte)
+
+	mu    sync.Mutex
+	queue []memoryMessage
+	// size is the number of bytes in queue; dropping is set while messages
+	// are being dropped, so the overflow is logged once.
+	size     int
+	dropping bool
+	wake     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: make(map[*memorySubscription]struct{})}
+}
+
+func (m *Memory) Publish(ctx context.Context, subject string, data []byte) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrClosed
+	}
+	// Handlers continue the publisher's trace but must outlive its ctx.
+	msgCtx := trace.ContextWithRemoteSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	tokens := strings.Split(subject, ".")
+	for sub := range m.subs {
+		if subjectMatches(sub.pattern, tokens) {
+			sub.enqueue(memoryMessage{ctx: msgCtx, subject: subject, data: append([]byte(nil), data...)})
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(subject string, handler func(ctx context.Context, subject string, data []byte)) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	sub := &memorySubscription{
+		broker:  m,
+		pattern: strings.Split(subject, "."),
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	m.subs[sub] = struct{}{}
+	go sub.run()
+	return sub, nil
+}
+
+func (m *Memory) Close() {
+	m.mu.Lock()
+	subs := m.subs
+	m.subs = make(map[*memorySubscription]struct{})
+	m.closed = true
+	m.mu.Unlock()
+	for sub := range subs {
+		sub.stop()
+	}
+}
+
+func (s *memorySubscription) Unsubscribe() error {
+	s.broker.mu.Lock()
+	delete(s.broker.subs, s)
+	s.broker.mu.Unlock()
+	s.stop()
+	return nil
+}
+
+func (s *memorySubscription) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *memorySubscription) enqueue(msg memoryMessage) {
+	s.mu.Lock()
+	if len(s.queue) >= maxPending || s.size+len(msg.data) > maxPendingBytes {
+		if !s.dropping {
+			log.Printf("memory broker: slow consumer on %s, dropping messages", strings.Join(s.pattern, "."))
+			s.dropping = true
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.queue = append(s.queue, msg)
+	s.size += len(msg.data)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			msg := s.queue[0]
+			s.queue[0] = memoryMessage{}
+			s.queue = s.queue[1:]
+			s.size -= len(msg.data)
+			if len(s.queue) == 0 {
+				s.dropping = false
+			}
+			s.mu.Unlock()
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handler(msg.ctx, msg.subject, msg.data)
+		}
+	}
+}
+
+// subjectMatches applies NATS wildcard rules: * matches one token and a
+// trailing > matches one or more.
+func subjectMatches(pattern, tokens []string) bool {
+	for i, p := range pattern {
+		if p == ">" {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) {
+			return false
+		}
+		if p != "*" && p != tokens[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(tokens)
+}
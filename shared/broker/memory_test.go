@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryDeliversInOrder(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+	got := make(chan string, 10)
+	if _, err := b.Subscribe("doclet.documents.*.updates", func(_ context.Context, subject string, data []byte) {
+		got <- subject + " " + string(data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range 3 {
+		_ = b.Publish(ctx, fmt.Sprintf("doclet.documents.d%d.updates", i), []byte(fmt.Sprint(i)))
+	}
+	_ = b.Publish(ctx, "doclet.documents.d0.presence", []byte("skip"))
+	for i := range 3 {
+		want := fmt.Sprintf("doclet.documents.d%d.updates %d", i, i)
+		select {
+		case msg := <-got:
+			if msg != want {
+				t.Fatalf("got %q, want %q", msg, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing %q", want)
+		}
+	}
+	select {
+	case msg := <-got:
+		t.Fatalf("unexpected %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryBoundsPending(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+	release := make(chan struct{})
+	received := make(chan struct{}, maxPending+100)
+	if _, err := b.Subscribe("a", func(context.Context, string, []byte) {
+		<-release
+		received <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for range maxPending + 100 {
+		if err := b.Publish(context.Background(), "a", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+	n := 0
+	for {
+		select {
+		case <-received:
+			n++
+			continue
+		case <-time.After(200 * time.Millisecond):
+		}
+		break
+	}
+	// The handler may have taken the first message off the queue before
+	// the rest were published.
+	if n < maxPending || n > maxPending+1 {
+		t.Errorf("received %d messages, want the %d that fit", n, maxPending)
+	}
+
+	// Once drained, the subscription accepts messages again.
+	if err := b.Publish(context.Background(), "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Error("no delivery after the queue drained")
+	}
+}
@@ -0,0 +1,242 @@
+package broker
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"doclet/shared/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const streamName = "DOCLET"
+
+// streamSubjects are the subjects kept in the stream: what the document
+// service persists through durable consumers and what collab replays.
+// Presence and other fan-out traffic stays plain NATS.
+var streamSubjects = []string{
+	"doclet.documents.*.snapshots",
+	"doclet.documents.*.updates",
+	"doclet.documents.*.suggest",
+}
+
+// Durable consumers get a message at most maxDeliver times, waiting
+// redeliveryDelay before the first retry and doubling it up to
+// maxRedeliveryDelay after that.
+const (
+	maxDeliver         = 10
+	redeliveryDelay    = time.Second
+	maxRedeliveryDelay = time.Minute
+)
+
+var tracer = otel.Tracer("doclet/shared/broker")
+
+// Nats is a Broker backed by a NATS connection, optionally storing the
+// streamSubjects in a JetStream stream.
+type Nats struct {
+	nc *nats.Conn
+	js jetstream.JetStream
+}
+
+func NewNats(url string) (*Nats, error) {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Nats{nc: nc}, nil
+}
+
+func (b *Nats) Close() {
+	if b.nc != nil {
+		b.nc.Close()
+	}
+}
+
+// EnableJetStream makes sure the DOCLET stream captures the streamSubjects
+// and switches Publish to acknowledged JetStream publishes for them.
+func (b *Nats) EnableJetStream(ctx context.Context, maxAge time.Duration) error {
+	js, err := jetstream.New(b.nc, jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+		metrics.PublishFailed(msg.Subject)
+		log.Printf("jetstream publish error on %s: %v", msg.Subject, err)
+	}))
+	if err != nil {
+		return err
+	}
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     streamName,
+		Subjects: streamSubjects,
+		MaxAge:   maxAge,
+	}); err != nil {
+		return err
+	}
+	b.js = js
+	return nil
+}
+
+// Publish sends data on subject with ctx's trace context in the message
+// headers.
+func (b *Nats) Publish(ctx context.Context, subject string, data []byte) error {
+	ctx, span := tracer.Start(ctx, "broker.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(subject, semconv.MessagingOperationTypeSend)...),
+	)
+	defer span.End()
+
+	msg := &nats.Msg{Subject: subject, Data: data, Header: nats.Header{}}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+	if len(msg.Header) == 0 {
+		msg.Header = nil
+	}
+	var err error
+	if b.js != nil && inStream(subject) {
+		_, err = b.js.PublishMsgAsync(msg)
+	} else {
+		err = b.nc.PublishMsg(msg)
+	}
+	if err != nil {
+		metrics.PublishFailed(subject)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (b *Nats) Subscribe(subject string, handler func(ctx context.Context, subject string, data []byte)) (Subscription, error) {
+	return b.nc.Subscribe(subject, func(msg *nats.Msg) {
+		ctx, span := startProcess(msg.Subject, msg.Header)
+		defer span.End()
+		handler(ctx, msg.Subject, msg.Data)
+	})
+}
+
+// Replay is a no-op unless JetStream is enabled.
+func (b *Nats) Replay(ctx context.Context, subject string, since time.Time, handler func(data []byte)) error {
+	if b.js == nil {
+		return nil
+	}
+	cons, err := b.js.OrderedConsumer(ctx, streamName, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{subject},
+		DeliverPolicy:  jetstream.DeliverByStartTimePolicy,
+		OptStartTime:   &since,
+	})
+	if err != nil {
+		return err
+	}
+	info := cons.CachedInfo()
+	if info == nil {
+		return nil
+	}
+	pending := int(info.NumPending)
+	for pending > 0 {
+		batch, err := cons.Fetch(min(pending, 256), jetstream.FetchMaxWait(2*time.Second))
+		if err != nil {
+			return err
+		}
+		received := 0
+		for msg := range batch.Messages() {
+			received++
+			handler(msg.Data())
+		}
+		if err := batch.Error(); err != nil {
+			return err
+		}
+		if received == 0 || ctx.Err() != nil {
+			break
+		}
+		pending -= received
+	}
+	return ctx.Err()
+}
+
+// SubscribeDurable consumes subject through a durable JetStream consumer.
+// Without JetStream it falls back to a plain subscription.
+func (b *Nats) SubscribeDurable(ctx context.Context, durable, subject string, handler func(ctx context.Context, data []byte) error) error {
+	if b.js == nil {
+		_, err := b.nc.Subscribe(subject, func(msg *nats.Msg) {
+			ctx, span := startProcess(msg.Subject, msg.Header)
+			defer span.End()
+			_ = handler(ctx, msg.Data)
+		})
+		return err
+	}
+	cons, err := b.js.CreateOrUpdateConsumer(ctx, streamName, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		MaxDeliver:    maxDeliver,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cons.Consume(func(msg jetstream.Msg) {
+		ctx, span := startProcess(msg.Subject(), msg.Headers())
+		defer span.End()
+		if err := handler(ctx, msg.Data()); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			delivered := uint64(1)
+			if meta, metaErr := msg.Metadata(); metaErr == nil {
+				delivered = meta.NumDelivered
+			}
+			if delivered >= maxDeliver {
+				log.Printf("giving up on %s for %s after %d attempts: %v", msg.Subject(), durable, delivered, err)
+				_ = msg.Term()
+				return
+			}
+			_ = msg.NakWithDelay(redeliveryBackoff(delivered))
+			return
+		}
+		_ = msg.Ack()
+	})
+	return err
+}
+
+// redeliveryBackoff is the delay before redelivering a message that failed
+// on its delivered-th attempt.
+func redeliveryBackoff(delivered uint64) time.Duration {
+	delay := redeliveryDelay
+	for i := uint64(1); i < delivered && delay < maxRedeliveryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRedeliveryDelay)
+}
+
+// inStream reports whether subject is one of the streamSubjects.
+func inStream(subject string) bool {
+	tokens := strings.Split(subject, ".")
+	for _, pattern := range streamSubjects {
+		if subjectMatches(strings.Split(pattern, "."), tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+// startProcess starts the span for handling a received message, continuing
+// the trace whose context the publisher put in header.
+func startProcess(subject string, header nats.Header) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	return tracer.Start(ctx, "broker.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(subject, semconv.MessagingOperationTypeProcess)...),
+	)
+}
+
+// messagingAttributes describes an operation on subject. Subjects contain
+// document IDs, so they are attributes rather than part of span names.
+func messagingAttributes(subject string, operation attribute.KeyValue) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingDestinationName(subject),
+		operation,
+	}
+}
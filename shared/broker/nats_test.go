@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		delivered uint64
+		want      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		{maxDeliver, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := redeliveryBackoff(tt.delivered); got != tt.want {
+			t.Errorf("redeliveryBackoff(%d) = %v, want %v", tt.delivered, got, tt.want)
+		}
+	}
+}
+
+func TestInStream(t *testing.T) {
+	for subject, want := range map[string]bool{
+		"doclet.documents.abc.snapshots": true,
+		"doclet.documents.abc.updates":   true,
+		"doclet.documents.abc.suggest":   true,
+		"doclet.documents.abc.presence":  false,
+		"doclet.documents.abc.deleted":   false,
+		"doclet.documents.abc.comments":  false,
+		"doclet.documents.updates":       false,
+	} {
+		if got := inStream(subject); got != want {
+			t.Errorf("inStream(%q) = %v, want %v", subject, got, want)
+		}
+	}
+}
+
+// startJetStream runs nats-server from PATH with JetStream on a free port
+// and returns a connected broker with JetStream enabled.
+func startJetStream(t *testing.T) *Nats {
+	t.Helper()
+	bin, err := exec.LookPath("nats-server")
+	if err != nil {
+		t.Skip("nats-server not on PATH")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+	cmd := exec.Command(bin, "-a", "127.0.0.1", "-p", port, "-js", "-sd", t.TempDir())
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start nats-server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	var b *Nats
+	for i := 0; i < 50; i++ {
+		if b, err = NewNats("nats://127.0.0.1:" + port); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("connect to nats-server: %v", err)
+	}
+	t.Cleanup(b.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.EnableJetStream(ctx, time.Hour); err != nil {
+		t.Fatalf("enable jetstream: %v", err)
+	}
+	return b
+}
+
+func TestSubscribeDurableRedelivers(t *testing.T) {
+	b := startJetStream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var attempts atomic.Int32
+	done := make(chan time.Duration, 1)
+	var first time.Time
+	err := b.SubscribeDurable(ctx, "test", "doclet.documents.*.updates", func(context.Context, []byte) error {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			return errors.New("try again")
+		}
+		done <- time.Since(first)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(ctx, "doclet.documents.abc.updates", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case waited := <-done:
+		if waited < redeliveryDelay/2 {
+			t.Errorf("redelivered after %v, want about %v", waited, redeliveryDelay)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("message not redelivered after %d attempts", attempts.Load())
+	}
+}
+
+func TestPresenceBypassesStream(t *testing.T) {
+	b := startJetStream(t)
+	ctx := context.Background()
+	received := make(chan string, 1)
+	if _, err := b.Subscribe("doclet.documents.*.presence", func(_ context.Context, subject string, _ []byte) {
+		received <- subject
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(ctx, "doclet.documents.abc.presence", []byte("x")); err != nil {
+		t.Fatalf("publish presence: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("presence not delivered")
+	}
+	stream, err := b.js.Stream(ctx, streamName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 0 {
+		t.Errorf("stream holds %d messages, want presence kept out", info.State.Msgs)
+	}
+}
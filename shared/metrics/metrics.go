@@ -0,0 +1,51 @@
+// Package metrics holds the Prometheus metrics shared by the doclet
+// services and serves them on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "doclet_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by service, route and status. WebSocket requests last as long as the connection.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method", "route", "status"})
+
+	publishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doclet_broker_publish_errors_total",
+		Help: "Messages the broker failed to publish, by the last subject token.",
+	}, []string{"kind"})
+)
+
+// Handler serves the metrics of every doclet service in this process.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a finished HTTP request. route is the pattern that
+// matched, so IDs in paths do not become labels; an empty route counts as
+// unmatched, and a zero status as 200.
+func ObserveRequest(service, method, route string, status int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	httpDuration.WithLabelValues(service, method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// PublishFailed counts a failed publish on subject.
+func PublishFailed(subject string) {
+	kind := subject[strings.LastIndexByte(subject, '.')+1:]
+	publishErrors.WithLabelValues(kind).Inc()
+}
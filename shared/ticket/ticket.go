@@ -0,0 +1,79 @@
+// Package ticket signs the short-lived session tickets the document service
+// issues for collab connections, so collab can check them without calling
+// back.
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"doclet/shared/access"
+)
+
+var (
+	// ErrInvalid is returned for malformed tickets and bad signatures.
+	ErrInvalid = errors.New("invalid ticket")
+	ErrExpired = errors.New("ticket expired")
+)
+
+// Ticket lets ClientID join DocumentID with Role until ExpiresAt. AuthorID
+// is the identity the document service derived from the share token the
+// ticket was issued for.
+type Ticket struct {
+	DocumentID string      `json:"document_id"`
+	ClientID   string      `json:"client_id"`
+	AuthorID   string      `json:"author_id"`
+	Role       access.Role `json:"role"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// Sign encodes t as "<payload>.<signature>", where the signature is an
+// HMAC-SHA256 of the payload under key.
+func Sign(key []byte, t Ticket) (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	payload := encoding.EncodeToString(data)
+	return payload + "." + encoding.EncodeToString(mac(key, payload)), nil
+}
+
+// Verify checks the signature and expiry of s and returns its ticket.
+func Verify(key []byte, s string, now time.Time) (Ticket, error) {
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return Ticket{}, ErrInvalid
+	}
+	got, err := encoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac(key, payload)) {
+		return Ticket{}, ErrInvalid
+	}
+	data, err := encoding.DecodeString(payload)
+	if err != nil {
+		return Ticket{}, ErrInvalid
+	}
+	var t Ticket
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Ticket{}, ErrInvalid
+	}
+	if _, ok := access.ParseRole(string(t.Role)); !ok || t.DocumentID == "" || t.ClientID == "" || t.AuthorID == "" {
+		return Ticket{}, ErrInvalid
+	}
+	if !now.Before(t.ExpiresAt) {
+		return Ticket{}, ErrExpired
+	}
+	return t, nil
+}
+
+func mac(key []byte, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,53 @@
+package ticket
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"doclet/shared/access"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("secret")
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := Ticket{DocumentID: "doc", ClientID: "alice", AuthorID: "share_alice", Role: access.RoleEditor, ExpiresAt: now.Add(time.Minute)}
+	s, err := Sign(key, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Verify(key, s, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	payload, sig, _ := strings.Cut(s, ".")
+	forged, _ := Sign(key, Ticket{DocumentID: "doc", ClientID: "alice", AuthorID: "share_alice", Role: access.RoleOwner, ExpiresAt: want.ExpiresAt})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	invalid, _ := Sign(key, Ticket{DocumentID: "doc", AuthorID: "share_alice", Role: access.RoleEditor, ExpiresAt: want.ExpiresAt})
+	anonymous, _ := Sign(key, Ticket{DocumentID: "doc", ClientID: "alice", Role: access.RoleEditor, ExpiresAt: want.ExpiresAt})
+	tests := []struct {
+		name   string
+		key    []byte
+		ticket string
+		now    time.Time
+		want   error
+	}{
+		{"expired", key, s, want.ExpiresAt, ErrExpired},
+		{"other key", []byte("other"), s, now, ErrInvalid},
+		{"swapped payload", key, forgedPayload + "." + sig, now, ErrInvalid},
+		{"no signature", key, payload, now, ErrInvalid},
+		{"bad encoding", key, payload + ".!", now, ErrInvalid},
+		{"missing client", key, invalid, now, ErrInvalid},
+		{"missing author", key, anonymous, now, ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.key, tt.ticket, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
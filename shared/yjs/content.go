@@ -0,0 +1,286 @@
+package yjs
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+const (
+	refGC      = 0
+	refDeleted = 1
+	refJSON    = 2
+	refBinary  = 3
+	refString  = 4
+	refEmbed   = 5
+	refFormat  = 6
+	refType    = 7
+	refAny     = 8
+	refDoc     = 9
+	refSkip    = 10
+)
+
+// Type refs used by ContentType.
+const (
+	TypeArray       = 0
+	TypeMap         = 1
+	TypeText        = 2
+	TypeXmlElement  = 3
+	TypeXmlFragment = 4
+	TypeXmlHook     = 5
+	TypeXmlText     = 6
+)
+
+// Content is the payload of an Item. Lengths are measured the way Yjs
+// measures them, so ContentString counts UTF-16 code units.
+type Content interface {
+	ref() uint8
+	Len() int
+	Countable() bool
+	write(e *Encoder, offset int)
+	// splice returns the part of the content starting at offset and
+	// truncates the receiver to offset.
+	splice(offset int) Content
+}
+
+type ContentDeleted struct {
+	Length int
+}
+
+type ContentJSON struct {
+	Values []string
+}
+
+type ContentBinary struct {
+	Data []byte
+}
+
+type ContentString struct {
+	units []uint16
+}
+
+type ContentEmbed struct {
+	JSON string
+}
+
+type ContentFormat struct {
+	Key   string
+	Value string
+}
+
+type ContentType struct {
+	TypeRef  uint64
+	NodeName string
+}
+
+type ContentAny struct {
+	Values []any
+}
+
+type ContentDoc struct {
+	GUID string
+	Opts any
+}
+
+func NewContentString(s string) *ContentString {
+	return &ContentString{units: utf16.Encode([]rune(s))}
+}
+
+func (c *ContentString) String() string {
+	return string(utf16.Decode(c.units))
+}
+
+func (c *ContentDeleted) ref() uint8      { return refDeleted }
+func (c *ContentDeleted) Len() int        { return c.Length }
+func (c *ContentDeleted) Countable() bool { return false }
+func (c *ContentDeleted) write(e *Encoder, offset int) {
+	e.WriteVarUint(uint64(c.Length - offset))
+}
+func (c *ContentDeleted) splice(offset int) Content {
+	right := &ContentDeleted{Length: c.Length - offset}
+	c.Length = offset
+	return right
+}
+
+func (c *ContentJSON) ref() uint8      { return refJSON }
+func (c *ContentJSON) Len() int        { return len(c.Values) }
+func (c *ContentJSON) Countable() bool { return true }
+func (c *ContentJSON) write(e *Encoder, offset int) {
+	e.WriteVarUint(uint64(len(c.Values) - offset))
+	for _, v := range c.Values[offset:] {
+		e.WriteVarString(v)
+	}
+}
+func (c *ContentJSON) splice(offset int) Content {
+	right := &ContentJSON{Values: append([]string(nil), c.Values[offset:]...)}
+	c.Values = c.Values[:offset]
+	return right
+}
+
+func (c *ContentBinary) ref() uint8      { return refBinary }
+func (c *ContentBinary) Len() int        { return 1 }
+func (c *ContentBinary) Countable() bool { return true }
+func (c *ContentBinary) write(e *Encoder, _ int) {
+	e.WriteVarBytes(c.Data)
+}
+func (c *ContentBinary) splice(int) Content { panic("yjs: binary content is not splittable") }
+
+func (c *ContentString) ref() uint8      { return refString }
+func (c *ContentString) Len() int        { return len(c.units) }
+func (c *ContentString) Countable() bool { return true }
+func (c *ContentString) write(e *Encoder, offset int) {
+	e.WriteVarString(string(utf16.Decode(c.units[offset:])))
+}
+func (c *ContentString) splice(offset int) Content {
+	right := &ContentString{units: append([]uint16(nil), c.units[offset:]...)}
+	c.units = c.units[:offset:offset]
+	// Splitting a surrogate pair leaves two invalid halves; Yjs replaces
+	// both with U+FFFD and so do we.
+	if offset > 0 && utf16.IsSurrogate(rune(c.units[offset-1])) && c.units[offset-1] < 0xdc00 {
+		c.units[offset-1] = 0xfffd
+		right.units[0] = 0xfffd
+	}
+	return right
+}
+
+func (c *ContentEmbed) ref() uint8      { return refEmbed }
+func (c *ContentEmbed) Len() int        { return 1 }
+func (c *ContentEmbed) Countable() bool { return true }
+func (c *ContentEmbed) write(e *Encoder, _ int) {
+	e.WriteVarString(c.JSON)
+}
+func (c *ContentEmbed) splice(int) Content { panic("yjs: embed content is not splittable") }
+
+func (c *ContentFormat) ref() uint8      { return refFormat }
+func (c *ContentFormat) Len() int        { return 1 }
+func (c *ContentFormat) Countable() bool { return false }
+func (c *ContentFormat) write(e *Encoder, _ int) {
+	e.WriteVarString(c.Key)
+	e.WriteVarString(c.Value)
+}
+func (c *ContentFormat) splice(int) Content { panic("yjs: format content is not splittable") }
+
+func (c *ContentType) ref() uint8      { return refType }
+func (c *ContentType) Len() int        { return 1 }
+func (c *ContentType) Countable() bool { return true }
+func (c *ContentType) write(e *Encoder, _ int) {
+	e.WriteVarUint(c.TypeRef)
+	if c.TypeRef == TypeXmlElement || c.TypeRef == TypeXmlHook {
+		e.WriteVarString(c.NodeName)
+	}
+}
+func (c *ContentType) splice(int) Content { panic("yjs: type content is not splittable") }
+
+func (c *ContentAny) ref() uint8      { return refAny }
+func (c *ContentAny) Len() int        { return len(c.Values) }
+func (c *ContentAny) Countable() bool { return true }
+func (c *ContentAny) write(e *Encoder, offset int) {
+	e.WriteVarUint(uint64(len(c.Values) - offset))
+	for _, v := range c.Values[offset:] {
+		e.WriteAny(v)
+	}
+}
+func (c *ContentAny) splice(offset int) Content {
+	right := &ContentAny{Values: append([]any(nil), c.Values[offset:]...)}
+	c.Values = c.Values[:offset]
+	return right
+}
+
+func (c *ContentDoc) ref() uint8      { return refDoc }
+func (c *ContentDoc) Len() int        { return 1 }
+func (c *ContentDoc) Countable() bool { return true }
+func (c *ContentDoc) write(e *Encoder, _ int) {
+	e.WriteVarString(c.GUID)
+	e.WriteAny(c.Opts)
+}
+func (c *ContentDoc) splice(int) Content { panic("yjs: doc content is not splittable") }
+
+func readContent(d *Decoder, info uint8) (Content, error) {
+	switch info & 0x1f {
+	case refDeleted:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		return &ContentDeleted{Length: int(n)}, nil
+	case refJSON:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		var values []string
+		for i := 0; i < n; i++ {
+			v, err := d.ReadVarString()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return &ContentJSON{Values: values}, nil
+	case refBinary:
+		b, err := d.ReadVarBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &ContentBinary{Data: append([]byte(nil), b...)}, nil
+	case refString:
+		s, err := d.ReadVarString()
+		if err != nil {
+			return nil, err
+		}
+		return NewContentString(s), nil
+	case refEmbed:
+		s, err := d.ReadVarString()
+		if err != nil {
+			return nil, err
+		}
+		return &ContentEmbed{JSON: s}, nil
+	case refFormat:
+		key, err := d.ReadVarString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.ReadVarString()
+		if err != nil {
+			return nil, err
+		}
+		return &ContentFormat{Key: key, Value: value}, nil
+	case refType:
+		typeRef, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		c := &ContentType{TypeRef: typeRef}
+		if typeRef == TypeXmlElement || typeRef == TypeXmlHook {
+			if c.NodeName, err = d.ReadVarString(); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	case refAny:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		var values []any
+		for i := 0; i < n; i++ {
+			v, err := d.ReadAny()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return &ContentAny{Values: values}, nil
+	case refDoc:
+		guid, err := d.ReadVarString()
+		if err != nil {
+			return nil, err
+		}
+		opts, err := d.ReadAny()
+		if err != nil {
+			return nil, err
+		}
+		return &ContentDoc{GUID: guid, Opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("yjs: unknown content ref %d", info&0x1f)
+	}
+}
@@ -0,0 +1,166 @@
+package yjs
+
+import "sort"
+
+type DeleteRange struct {
+	Clock  uint64
+	Length uint64
+}
+
+// DeleteSet maps a client to its sorted, non-overlapping deleted ranges.
+type DeleteSet map[uint64][]DeleteRange
+
+// StateVector maps a client to the next clock expected from it.
+type StateVector map[uint64]uint64
+
+func readDeleteSet(d *Decoder) (DeleteSet, error) {
+	ds := make(DeleteSet)
+	if !d.HasContent() {
+		return ds, nil
+	}
+	numClients, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < numClients; i++ {
+		client, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < n; j++ {
+			clock, err := d.readLength()
+			if err != nil {
+				return nil, err
+			}
+			length, err := d.readLength()
+			if err != nil {
+				return nil, err
+			}
+			if clock+length > maxClock {
+				return nil, errClockOverflow
+			}
+			if length > 0 {
+				ds[client] = append(ds[client], DeleteRange{Clock: clock, Length: length})
+			}
+		}
+	}
+	ds.normalize()
+	return ds, nil
+}
+
+func (ds DeleteSet) write(e *Encoder) {
+	clients := make([]uint64, 0, len(ds))
+	for client, ranges := range ds {
+		if len(ranges) > 0 {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a] > clients[b] })
+	e.WriteVarUint(uint64(len(clients)))
+	for _, client := range clients {
+		e.WriteVarUint(client)
+		e.WriteVarUint(uint64(len(ds[client])))
+		for _, r := range ds[client] {
+			e.WriteVarUint(r.Clock)
+			e.WriteVarUint(r.Length)
+		}
+	}
+}
+
+// Merge adds all ranges of other to ds.
+func (ds DeleteSet) Merge(other DeleteSet) {
+	for client, ranges := range other {
+		ds[client] = append(ds[client], ranges...)
+	}
+	ds.normalize()
+}
+
+// Contains reports whether id is deleted.
+func (ds DeleteSet) Contains(id ID) bool {
+	ranges := ds[id.Client]
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Clock+ranges[i].Length > id.Clock })
+	return i < len(ranges) && ranges[i].Clock <= id.Clock
+}
+
+// Covers reports whether every range in other is also deleted in ds.
+func (ds DeleteSet) Covers(other DeleteSet) bool {
+	for client, ranges := range other {
+		own := ds[client]
+		for _, r := range ranges {
+			i := sort.Search(len(own), func(i int) bool { return own[i].Clock+own[i].Length > r.Clock })
+			if i == len(own) || own[i].Clock > r.Clock || own[i].Clock+own[i].Length < r.Clock+r.Length {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ds DeleteSet) normalize() {
+	for client, ranges := range ds {
+		sort.Slice(ranges, func(a, b int) bool { return ranges[a].Clock < ranges[b].Clock })
+		merged := ranges[:0]
+		for _, r := range ranges {
+			if r.Length == 0 {
+				continue
+			}
+			if n := len(merged); n > 0 && merged[n-1].Clock+merged[n-1].Length >= r.Clock {
+				if end := r.Clock + r.Length; end > merged[n-1].Clock+merged[n-1].Length {
+					merged[n-1].Length = end - merged[n-1].Clock
+				}
+				continue
+			}
+			merged = append(merged, r)
+		}
+		if len(merged) == 0 {
+			delete(ds, client)
+			continue
+		}
+		ds[client] = merged
+	}
+}
+
+// Encode returns the binary state vector as produced by Y.encodeStateVector.
+func (sv StateVector) Encode() []byte {
+	e := NewEncoder()
+	clients := make([]uint64, 0, len(sv))
+	for client := range sv {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a] > clients[b] })
+	e.WriteVarUint(uint64(len(clients)))
+	for _, client := range clients {
+		e.WriteVarUint(client)
+		e.WriteVarUint(sv[client])
+	}
+	return e.Bytes()
+}
+
+// DecodeStateVector parses a binary state vector.
+func DecodeStateVector(data []byte) (StateVector, error) {
+	d := NewDecoder(data)
+	sv := make(StateVector)
+	if !d.HasContent() {
+		return sv, nil
+	}
+	n, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		client, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		clock, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		sv[client] = clock
+	}
+	return sv, nil
+}
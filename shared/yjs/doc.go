@@ -0,0 +1,226 @@
+package yjs
+
+import "sort"
+
+// Doc holds the merged structs and delete set of every update applied to
+// it, much like Y.mergeUpdates does, without integrating items into types.
+// That is enough to answer sync requests and to encode the full state. Doc
+// is not safe for concurrent use.
+type Doc struct {
+	structs map[uint64][]Struct
+	deletes DeleteSet
+}
+
+func NewDoc() *Doc {
+	return &Doc{
+		structs: make(map[uint64][]Struct),
+		deletes: make(DeleteSet),
+	}
+}
+
+// ApplyUpdate merges a v1 update into the document. Structs already known
+// are ignored, so applying the same update twice is a no-op.
+func (d *Doc) ApplyUpdate(update []byte) error {
+	u, err := DecodeUpdate(update)
+	if err != nil {
+		return err
+	}
+	d.merge(u)
+	return nil
+}
+
+func (d *Doc) merge(u *Update) {
+	for client, incoming := range u.Structs {
+		list := d.structs[client]
+		var added []Struct
+		for _, s := range incoming {
+			added = append(added, missingParts(list, s)...)
+		}
+		if len(added) == 0 {
+			continue
+		}
+		d.structs[client] = insertStructs(list, added)
+	}
+	d.deletes.Merge(u.Deletes)
+}
+
+// missingParts returns the pieces of s whose clock ranges are not yet in
+// list.
+func missingParts(list []Struct, s Struct) []Struct {
+	var parts []Struct
+	rem := s
+	start := s.ID().Clock
+	end := start + uint64(s.Len())
+	take := func(from, to uint64) {
+		if from > rem.ID().Clock {
+			rem = rem.splice(int(from - rem.ID().Clock))
+		}
+		piece := rem
+		if to < rem.ID().Clock+uint64(rem.Len()) {
+			rem = rem.splice(int(to - from))
+		}
+		parts = append(parts, piece)
+	}
+	cursor := start
+	for cursor < end {
+		i := sort.Search(len(list), func(i int) bool {
+			return list[i].ID().Clock+uint64(list[i].Len()) > cursor
+		})
+		if i == len(list) || list[i].ID().Clock >= end {
+			take(cursor, end)
+			break
+		}
+		if existing := list[i].ID().Clock; existing > cursor {
+			take(cursor, existing)
+			cursor = existing
+			continue
+		}
+		cursor = list[i].ID().Clock + uint64(list[i].Len())
+	}
+	return parts
+}
+
+func insertStructs(list, added []Struct) []Struct {
+	sort.Slice(added, func(a, b int) bool { return added[a].ID().Clock < added[b].ID().Clock })
+	if len(list) == 0 || added[0].ID().Clock >= list[len(list)-1].ID().Clock {
+		return append(list, added...)
+	}
+	merged := make([]Struct, 0, len(list)+len(added))
+	i, j := 0, 0
+	for i < len(list) && j < len(added) {
+		if list[i].ID().Clock < added[j].ID().Clock {
+			merged = append(merged, list[i])
+			i++
+		} else {
+			merged = append(merged, added[j])
+			j++
+		}
+	}
+	merged = append(merged, list[i:]...)
+	return append(merged, added[j:]...)
+}
+
+// StateVector returns, per client, the end of the contiguous clock range
+// starting at zero.
+func (d *Doc) StateVector() StateVector {
+	sv := make(StateVector, len(d.structs))
+	for client, list := range d.structs {
+		var clock uint64
+		for _, s := range list {
+			if s.ID().Clock != clock {
+				break
+			}
+			clock += uint64(s.Len())
+		}
+		if clock > 0 {
+			sv[client] = clock
+		}
+	}
+	return sv
+}
+
+// Clients returns every client that created or deleted something in the
+// document, in no particular order.
+func (d *Doc) Clients() []uint64 {
+	clients := make([]uint64, 0, len(d.structs)+len(d.deletes))
+	for client := range d.structs {
+		clients = append(clients, client)
+	}
+	for client := range d.deletes {
+		if _, ok := d.structs[client]; !ok {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// DeleteSet returns a copy of the document's delete set.
+func (d *Doc) DeleteSet() DeleteSet {
+	ds := make(DeleteSet, len(d.deletes))
+	ds.Merge(d.deletes)
+	return ds
+}
+
+// EncodeStateAsUpdate encodes everything the holder of sv is missing, or
+// the whole document when sv is nil.
+func (d *Doc) EncodeStateAsUpdate(sv StateVector) []byte {
+	e := NewEncoder()
+	writeStructs(e, d.structs, sv)
+	d.deletes.write(e)
+	return e.Bytes()
+}
+
+// Covers reports whether every struct and deletion in other is already
+// part of d.
+func (d *Doc) Covers(other *Doc) bool {
+	for client, list := range other.structs {
+		own := d.structs[client]
+		for _, s := range list {
+			if len(missingParts(own, &Skip{id: s.ID(), Length: s.Len()})) > 0 {
+				return false
+			}
+		}
+	}
+	return d.deletes.Covers(other.deletes)
+}
+
+// Empty reports whether no update has been applied.
+func (d *Doc) Empty() bool {
+	return len(d.structs) == 0 && len(d.deletes) == 0
+}
+
+// MergeUpdates combines several v1 updates into one.
+func MergeUpdates(updates ...[]byte) ([]byte, error) {
+	doc := NewDoc()
+	for _, update := range updates {
+		if err := doc.ApplyUpdate(update); err != nil {
+			return nil, err
+		}
+	}
+	return doc.EncodeStateAsUpdate(nil), nil
+}
+
+// CanApply reports whether everything update builds on is either in d or in
+// update itself: the preceding clock of each struct, the origins and parents
+// of its items, and the items it deletes. Applying an update that fails the
+// check would leave peers waiting for structs that may never arrive.
+func (d *Doc) CanApply(update []byte) (bool, error) {
+	u, err := DecodeUpdate(update)
+	if err != nil {
+		return false, err
+	}
+	sv := d.StateVector()
+	known := func(client, from, to uint64) bool {
+		if to <= sv[client] {
+			return true
+		}
+		return u.covers(client, max(from, sv[client]), to)
+	}
+	knownID := func(id *ID) bool {
+		return id == nil || known(id.Client, id.Clock, id.Clock+1)
+	}
+	for client, list := range u.Structs {
+		for _, s := range list {
+			if _, skip := s.(*Skip); skip {
+				continue
+			}
+			clock := s.ID().Clock
+			if clock > 0 && !known(client, clock-1, clock) {
+				return false, nil
+			}
+			if item, ok := s.(*Item); ok {
+				if !knownID(item.Origin) || !knownID(item.RightOrigin) || !knownID(item.ParentID) {
+					return false, nil
+				}
+			}
+		}
+	}
+	for client, ranges := range u.Deletes {
+		for _, r := range ranges {
+			if !known(client, r.Clock, r.Clock+r.Length) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,361 @@
+package yjs
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var ErrUnexpectedEOF = errors.New("yjs: unexpected end of update")
+
+var errClockOverflow = errors.New("yjs: clock out of range")
+
+// maxClock is the largest clock Yjs can represent (Number.MAX_SAFE_INTEGER).
+const maxClock = 1<<53 - 1
+
+// Undefined is the decoded form of the lib0 "undefined" any value.
+type Undefined struct{}
+
+// BigInt is the decoded form of a lib0 bigint any value.
+type BigInt int64
+
+// Encoder writes lib0 binary encoding.
+type Encoder struct {
+	buf []byte
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) WriteUint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *Encoder) WriteVarUint(v uint64) {
+	for v > 0x7f {
+		e.buf = append(e.buf, byte(v&0x7f)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *Encoder) WriteVarInt(v int64) {
+	negative := v < 0
+	if negative {
+		v = -v
+	}
+	b := byte(v & 0x3f)
+	if negative {
+		b |= 0x40
+	}
+	v >>= 6
+	if v > 0 {
+		b |= 0x80
+	}
+	e.buf = append(e.buf, b)
+	for v > 0 {
+		b = byte(v & 0x7f)
+		v >>= 7
+		if v > 0 {
+			b |= 0x80
+		}
+		e.buf = append(e.buf, b)
+	}
+}
+
+func (e *Encoder) WriteVarString(s string) {
+	e.WriteVarUint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) WriteVarBytes(b []byte) {
+	e.WriteVarUint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) WriteAny(v any) {
+	switch value := v.(type) {
+	case Undefined:
+		e.WriteUint8(127)
+	case nil:
+		e.WriteUint8(126)
+	case int:
+		e.writeAnyInt(int64(value))
+	case int64:
+		e.writeAnyInt(value)
+	case float32:
+		e.WriteUint8(124)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(value))
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) <= math.MaxInt32 {
+			e.writeAnyInt(int64(value))
+			return
+		}
+		e.WriteUint8(123)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(value))
+	case BigInt:
+		e.WriteUint8(122)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(value))
+	case bool:
+		if value {
+			e.WriteUint8(120)
+		} else {
+			e.WriteUint8(121)
+		}
+	case string:
+		e.WriteUint8(119)
+		e.WriteVarString(value)
+	case map[string]any:
+		e.WriteUint8(118)
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		e.WriteVarUint(uint64(len(keys)))
+		for _, key := range keys {
+			e.WriteVarString(key)
+			e.WriteAny(value[key])
+		}
+	case []any:
+		e.WriteUint8(117)
+		e.WriteVarUint(uint64(len(value)))
+		for _, item := range value {
+			e.WriteAny(item)
+		}
+	case []byte:
+		e.WriteUint8(116)
+		e.WriteVarBytes(value)
+	default:
+		e.WriteUint8(127)
+	}
+}
+
+func (e *Encoder) writeAnyInt(v int64) {
+	if v > math.MaxInt32 || v < -math.MaxInt32 {
+		e.WriteUint8(123)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(float64(v)))
+		return
+	}
+	e.WriteUint8(125)
+	e.WriteVarInt(v)
+}
+
+// Decoder reads lib0 binary encoding.
+type Decoder struct {
+	buf []byte
+	pos int
+}
+
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+func (d *Decoder) HasContent() bool {
+	return d.pos < len(d.buf)
+}
+
+func (d *Decoder) ReadUint8() (uint8, error) {
+	if d.pos >= len(d.buf) {
+		return 0, ErrUnexpectedEOF
+	}
+	v := d.buf[d.pos]
+	d.pos++
+	return v, nil
+}
+
+func (d *Decoder) ReadVarUint() (uint64, error) {
+	var v uint64
+	var shift uint
+	for {
+		b, err := d.ReadUint8()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+		shift += 7
+		if shift > 63 {
+			return 0, errors.New("yjs: varuint overflow")
+		}
+	}
+}
+
+func (d *Decoder) ReadVarInt() (int64, error) {
+	b, err := d.ReadUint8()
+	if err != nil {
+		return 0, err
+	}
+	v := int64(b & 0x3f)
+	negative := b&0x40 != 0
+	shift := uint(6)
+	for b&0x80 != 0 {
+		b, err = d.ReadUint8()
+		if err != nil {
+			return 0, err
+		}
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if shift > 63 {
+			return 0, errors.New("yjs: varint overflow")
+		}
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// readCount reads the number of elements that follow. Every element takes
+// at least one byte, so a count larger than the rest of the input is
+// rejected. Nested values all count against the same remaining input, so
+// callers append instead of sizing allocations from the count.
+func (d *Decoder) readCount() (int, error) {
+	n, err := d.ReadVarUint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.buf)-d.pos) {
+		return 0, ErrUnexpectedEOF
+	}
+	return int(n), nil
+}
+
+// readLength reads the clock length of a struct or deleted range, which
+// Yjs keeps below 2^53.
+func (d *Decoder) readLength() (uint64, error) {
+	n, err := d.ReadVarUint()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxClock {
+		return 0, errClockOverflow
+	}
+	return n, nil
+}
+
+func (d *Decoder) ReadVarBytes() ([]byte, error) {
+	n, err := d.ReadVarUint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.buf)-d.pos) < n {
+		return nil, ErrUnexpectedEOF
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *Decoder) ReadVarString() (string, error) {
+	b, err := d.ReadVarBytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *Decoder) readFixed(n int) ([]byte, error) {
+	if len(d.buf)-d.pos < n {
+		return nil, ErrUnexpectedEOF
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// maxAnyDepth bounds the nesting of arrays and objects in ReadAny.
+const maxAnyDepth = 256
+
+func (d *Decoder) ReadAny() (any, error) {
+	return d.readAny(0)
+}
+
+func (d *Decoder) readAny(depth int) (any, error) {
+	if depth > maxAnyDepth {
+		return nil, errors.New("yjs: value nested too deeply")
+	}
+	tag, err := d.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case 127:
+		return Undefined{}, nil
+	case 126:
+		return nil, nil
+	case 125:
+		v, err := d.ReadVarInt()
+		return v, err
+	case 124:
+		b, err := d.readFixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case 123:
+		b, err := d.readFixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 122:
+		b, err := d.readFixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return BigInt(binary.BigEndian.Uint64(b)), nil
+	case 121:
+		return false, nil
+	case 120:
+		return true, nil
+	case 119:
+		return d.ReadVarString()
+	case 118:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		obj := make(map[string]any)
+		for i := 0; i < n; i++ {
+			key, err := d.ReadVarString()
+			if err != nil {
+				return nil, err
+			}
+			if obj[key], err = d.readAny(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case 117:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		arr := []any{}
+		for i := 0; i < n; i++ {
+			item, err := d.readAny(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	case 116:
+		b, err := d.ReadVarBytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	default:
+		return Undefined{}, nil
+	}
+}
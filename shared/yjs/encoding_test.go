@@ -0,0 +1,170 @@
+package yjs
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAnyRoundTrip(t *testing.T) {
+	values := []any{
+		nil, Undefined{}, true, false, int64(-42), 1.5, "text", []byte{1, 2},
+		[]any{int64(1), "two"}, map[string]any{"a": []any{}, "b": map[string]any{}},
+	}
+	for _, v := range values {
+		e := NewEncoder()
+		e.WriteAny(v)
+		d := NewDecoder(e.Bytes())
+		got, err := d.ReadAny()
+		if err != nil {
+			t.Fatalf("ReadAny(%#v): %v", v, err)
+		}
+		e2 := NewEncoder()
+		e2.WriteAny(got)
+		if string(e2.Bytes()) != string(e.Bytes()) || d.HasContent() {
+			t.Errorf("round trip of %#v gave %#v", v, got)
+		}
+	}
+}
+
+// TestDecodeOversizedCounts checks that counts and lengths read from the
+// wire are validated before anything is allocated for them.
+func TestDecodeOversizedCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		update string
+		want   error
+	}{
+		// A ContentAny item claiming 2^34 values in a 12-byte update.
+		{"any count", "01 01 01 00  08 01 00 ffffffff7f", ErrUnexpectedEOF},
+		{"json count", "01 01 01 00  02 01 00 ffffffff7f", ErrUnexpectedEOF},
+		{"any array", "01 01 01 00  08 01 00 01 75 ffffffff7f", ErrUnexpectedEOF},
+		{"any object", "01 01 01 00  08 01 00 01 76 ffffffff7f", ErrUnexpectedEOF},
+		{"client count", "ffffffff7f", ErrUnexpectedEOF},
+		{"struct count", "01 ffffffff7f 01 00", ErrUnexpectedEOF},
+		{"delete set clients", "00  ffffffff7f", ErrUnexpectedEOF},
+		{"delete set ranges", "00  01 01 ffffffff7f", ErrUnexpectedEOF},
+		{"deleted length", "01 01 01 00  01 01 00 ffffffffffffffff7f", errClockOverflow},
+		{"gc length", "01 01 01 00  00 ffffffffffffff7f", errClockOverflow},
+		{"skip length", "01 01 01 00  0a ffffffffffffff7f", errClockOverflow},
+		{"clock overflow", "01 02 01 00  00 ffffffffffffff0f  00 01", errClockOverflow},
+		{"delete range", "00  01 01 01 ffffffffffffff0f 01", errClockOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeUpdate(golden(t, tt.update)); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeUpdate error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := DecodeStateVector(golden(t, "ffffffff7f")); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("DecodeStateVector error = %v, want %v", err, ErrUnexpectedEOF)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	tests := []struct {
+		fixture string
+		// deletes is the length of the trailing delete set. Dropping it
+		// leaves a valid update.
+		deletes int
+	}{
+		{goldenText, 1},
+		{goldenInsertState, 1},
+		{goldenDeleteState, 5},
+		{goldenParagraph, 1},
+	}
+	for _, tt := range tests {
+		update := golden(t, tt.fixture)
+		for n := 1; n < len(update); n++ {
+			if n == len(update)-tt.deletes {
+				continue
+			}
+			if _, err := DecodeUpdate(update[:n]); err == nil {
+				t.Errorf("DecodeUpdate(%x) succeeded on a truncated update", update[:n])
+			}
+		}
+	}
+}
+
+func TestDecodeDeepNesting(t *testing.T) {
+	update := golden(t, "01 01 01 00  08 01 00 01")
+	for i := 0; i < 100000; i++ {
+		update = append(update, 0x75, 0x01)
+	}
+	if _, err := DecodeUpdate(update); err == nil {
+		t.Error("DecodeUpdate accepted a value nested 100000 levels deep")
+	}
+}
+
+// TestIntegrateLongDeletion checks that a deleted range spanning most of the
+// clock space is not expanded clock by clock.
+func TestIntegrateLongDeletion(t *testing.T) {
+	doc := NewDoc()
+	deleted := "01 02 01 00  01 01 07 64656661756c74 ffffffffffff0f  " +
+		"87 01 feffffffffff0f 03 09 706172616772617068  00"
+	if err := doc.ApplyUpdate(golden(t, deleted)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []*XmlNode)
+	go func() { done <- doc.XmlFragment("default") }()
+	select {
+	case nodes := <-done:
+		if len(nodes) != 1 || nodes[0].Name != "paragraph" {
+			t.Errorf("XmlFragment = %#v, want one paragraph", nodes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("XmlFragment did not finish")
+	}
+}
+
+func FuzzDecodeUpdate(f *testing.F) {
+	for _, fixture := range []string{goldenText, goldenInsert, goldenInsertState, goldenDelete, goldenDeleteState, goldenParagraph} {
+		f.Add(golden(f, fixture))
+	}
+	f.Fuzz(func(t *testing.T, update []byte) {
+		if _, err := DecodeUpdate(update); err != nil {
+			return
+		}
+		doc := NewDoc()
+		if err := doc.ApplyUpdate(update); err != nil {
+			t.Fatalf("ApplyUpdate failed after DecodeUpdate succeeded: %v", err)
+		}
+		doc.XmlFragment("default")
+		merged, err := MergeUpdates(update, doc.EncodeStateAsUpdate(nil))
+		if err != nil {
+			t.Fatalf("MergeUpdates of a decodable update: %v", err)
+		}
+		if _, err := DecodeUpdate(merged); err != nil {
+			t.Fatalf("merged update does not decode: %v", err)
+		}
+	})
+}
+
+// TestDecodeNestedCountsAllocation checks that nested arrays each claiming
+// as many values as there are bytes left do not allocate for those counts
+// at every level.
+func TestDecodeNestedCountsAllocation(t *testing.T) {
+	const levels, padding = 200, 64 * 1024
+	e := NewEncoder()
+	e.buf = append(e.buf, golden(t, "01 01 01 00  08 01 00 01")...)
+	for i := 0; i < levels; i++ {
+		e.buf = append(e.buf, 0x75)
+		e.WriteVarUint(padding)
+	}
+	update := append(e.Bytes(), make([]byte, padding)...)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if _, err := DecodeUpdate(update); err == nil {
+		t.Fatal("DecodeUpdate accepted arrays longer than the update")
+	}
+	runtime.ReadMemStats(&after)
+	// Sizing every level from its count would take levels*padding*16 bytes,
+	// 200 MiB.
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("DecodeUpdate allocated %d bytes for a %d byte update", alloc, len(update))
+	}
+}
@@ -0,0 +1,320 @@
+package yjs
+
+import "sort"
+
+// unit is a single clock of an item, linked into its parent's sequence the
+// way Item.integrate does in Yjs. Splitting every item into units spares
+// the integrator the clean-start/clean-end splits Yjs performs on demand.
+// Deleted content is the exception: it is only split where other items
+// refer to it, since its length comes straight from the wire.
+type unit struct {
+	id          ID
+	origin      *ID
+	rightOrigin *ID
+	parentRoot  string
+	parentID    *ID
+	parentSub   *string
+	content     Content
+	left, right *unit
+	parent      *ytype
+	deleted     bool
+	state       uint8
+}
+
+const (
+	unitPending = iota
+	unitIntegrating
+	unitDone
+	unitDropped
+)
+
+// ytype is a shared type: a root or the type held by a ContentType item.
+type ytype struct {
+	item    *unit
+	content *ContentType
+	start   *unit
+	entries map[string]*unit
+}
+
+type integrator struct {
+	units   map[ID]*unit
+	roots   map[string]*ytype
+	types   map[*unit]*ytype
+	deletes DeleteSet
+}
+
+// integrate builds the type tree of d. Items whose parent cannot be
+// resolved, e.g. because it was garbage collected, are left out.
+func (d *Doc) integrate() *integrator {
+	it := &integrator{
+		units:   make(map[ID]*unit),
+		roots:   make(map[string]*ytype),
+		types:   make(map[*unit]*ytype),
+		deletes: d.deletes,
+	}
+	clients := make([]uint64, 0, len(d.structs))
+	for client := range d.structs {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a] < clients[b] })
+
+	cuts := d.cuts()
+	var order []*unit
+	for _, client := range clients {
+		for _, s := range d.structs[client] {
+			item, ok := s.(*Item)
+			if !ok {
+				continue
+			}
+			if _, deleted := item.Content.(*ContentDeleted); deleted {
+				order = it.addDeleted(order, item, cuts[client])
+				continue
+			}
+			for k := 0; k < item.Len(); k++ {
+				u := &unit{
+					id:          ID{Client: client, Clock: item.id.Clock + uint64(k)},
+					origin:      item.Origin,
+					rightOrigin: item.RightOrigin,
+					parentRoot:  item.ParentRoot,
+					parentID:    item.ParentID,
+					parentSub:   item.ParentSub,
+					content:     contentAt(item.Content, k),
+				}
+				if k > 0 {
+					u.origin = &ID{Client: client, Clock: u.id.Clock - 1}
+				}
+				it.units[u.id] = u
+				order = append(order, u)
+			}
+		}
+	}
+	for _, u := range order {
+		it.integrate(u)
+	}
+	return it
+}
+
+// cuts returns, per client, the sorted clocks at which a referenced unit
+// starts: the clock after each origin and each right origin.
+func (d *Doc) cuts() map[uint64][]uint64 {
+	cuts := make(map[uint64][]uint64)
+	for _, list := range d.structs {
+		for _, s := range list {
+			item, ok := s.(*Item)
+			if !ok {
+				continue
+			}
+			if item.Origin != nil {
+				cuts[item.Origin.Client] = append(cuts[item.Origin.Client], item.Origin.Clock+1)
+			}
+			if item.RightOrigin != nil {
+				cuts[item.RightOrigin.Client] = append(cuts[item.RightOrigin.Client], item.RightOrigin.Clock)
+			}
+		}
+	}
+	for _, clocks := range cuts {
+		sort.Slice(clocks, func(a, b int) bool { return clocks[a] < clocks[b] })
+	}
+	return cuts
+}
+
+// addDeleted adds the deleted item as one unit per run between cuts. Each
+// unit is registered under its first and last clock, the only clocks other
+// items can refer to.
+func (it *integrator) addDeleted(order []*unit, item *Item, cuts []uint64) []*unit {
+	start := item.id.Clock
+	end := start + uint64(item.Len())
+	i := sort.Search(len(cuts), func(i int) bool { return cuts[i] > start })
+	for from := start; from < end; {
+		to := end
+		for ; i < len(cuts) && cuts[i] < end; i++ {
+			if cuts[i] > from {
+				to = cuts[i]
+				break
+			}
+		}
+		u := &unit{
+			id:          ID{Client: item.id.Client, Clock: from},
+			origin:      item.Origin,
+			rightOrigin: item.RightOrigin,
+			parentRoot:  item.ParentRoot,
+			parentID:    item.ParentID,
+			parentSub:   item.ParentSub,
+			content:     &ContentDeleted{Length: int(to - from)},
+			deleted:     true,
+		}
+		if from > start {
+			u.origin = &ID{Client: item.id.Client, Clock: from - 1}
+		}
+		it.units[u.id] = u
+		it.units[ID{Client: item.id.Client, Clock: to - 1}] = u
+		order = append(order, u)
+		from = to
+	}
+	return order
+}
+
+// contentAt returns the single-clock content at offset k of c without
+// modifying c.
+func contentAt(c Content, k int) Content {
+	switch v := c.(type) {
+	case *ContentString:
+		return &ContentString{units: v.units[k : k+1 : k+1]}
+	case *ContentAny:
+		return &ContentAny{Values: v.Values[k : k+1 : k+1]}
+	case *ContentJSON:
+		return &ContentJSON{Values: v.Values[k : k+1 : k+1]}
+	}
+	return c
+}
+
+func (it *integrator) root(name string) *ytype {
+	t := it.roots[name]
+	if t == nil {
+		t = &ytype{entries: make(map[string]*unit)}
+		it.roots[name] = t
+	}
+	return t
+}
+
+// resolve returns the integrated unit with the given id, or nil.
+func (it *integrator) resolve(id *ID) (*unit, bool) {
+	if id == nil {
+		return nil, true
+	}
+	u := it.units[*id]
+	if u == nil || !it.integrate(u) {
+		return nil, false
+	}
+	return u, true
+}
+
+func (it *integrator) integrate(u *unit) bool {
+	switch u.state {
+	case unitDone:
+		return true
+	case unitIntegrating, unitDropped:
+		return false
+	}
+	u.state = unitIntegrating
+	ok := it.link(u)
+	if ok {
+		u.state = unitDone
+	} else {
+		u.state = unitDropped
+	}
+	return ok
+}
+
+func (it *integrator) link(u *unit) bool {
+	left, ok := it.resolve(u.origin)
+	if !ok {
+		return false
+	}
+	right, ok := it.resolve(u.rightOrigin)
+	if !ok {
+		return false
+	}
+	switch {
+	case left != nil:
+		u.parent, u.parentSub = left.parent, left.parentSub
+	case right != nil:
+		u.parent, u.parentSub = right.parent, right.parentSub
+	case u.parentID != nil:
+		p, ok := it.resolve(u.parentID)
+		if !ok {
+			return false
+		}
+		content, isType := p.content.(*ContentType)
+		if !isType {
+			return false
+		}
+		t := it.types[p]
+		if t == nil {
+			t = &ytype{item: p, content: content, entries: make(map[string]*unit)}
+			it.types[p] = t
+		}
+		u.parent = t
+	default:
+		u.parent = it.root(u.parentRoot)
+	}
+	parent := u.parent
+
+	if (left == nil && (right == nil || right.left != nil)) || (left != nil && left.right != right) {
+		var o *unit
+		switch {
+		case left != nil:
+			o = left.right
+		case u.parentSub != nil:
+			o = parent.entries[*u.parentSub]
+			for o != nil && o.left != nil {
+				o = o.left
+			}
+		default:
+			o = parent.start
+		}
+		conflicting := make(map[*unit]bool)
+		beforeOrigin := make(map[*unit]bool)
+		for o != nil && o != right {
+			beforeOrigin[o] = true
+			conflicting[o] = true
+			if sameID(u.origin, o.origin) {
+				if o.id.Client < u.id.Client {
+					left = o
+					clear(conflicting)
+				} else if sameID(u.rightOrigin, o.rightOrigin) {
+					break
+				}
+			} else if oo := it.originUnit(o); oo != nil && beforeOrigin[oo] {
+				if !conflicting[oo] {
+					left = o
+					clear(conflicting)
+				}
+			} else {
+				break
+			}
+			o = o.right
+		}
+	}
+
+	u.left = left
+	if left != nil {
+		u.right = left.right
+		left.right = u
+	} else if u.parentSub != nil {
+		r := parent.entries[*u.parentSub]
+		for r != nil && r.left != nil {
+			r = r.left
+		}
+		u.right = r
+	} else {
+		u.right = parent.start
+		parent.start = u
+	}
+	if u.right != nil {
+		u.right.left = u
+	} else if u.parentSub != nil {
+		parent.entries[*u.parentSub] = u
+		if u.left != nil {
+			u.left.deleted = true
+		}
+	}
+	if it.deletes.Contains(u.id) || (u.parentSub != nil && u.right != nil) {
+		u.deleted = true
+	}
+	return true
+}
+
+func (it *integrator) originUnit(u *unit) *unit {
+	if u.origin == nil {
+		return nil
+	}
+	return it.units[*u.origin]
+}
+
+func sameID(a, b *ID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,140 @@
+package yjs
+
+import "sort"
+
+// EncodeDeleteAll encodes an update that deletes every struct of d.
+func (d *Doc) EncodeDeleteAll() []byte {
+	ds := make(DeleteSet)
+	for client, list := range d.structs {
+		for _, s := range list {
+			ds[client] = append(ds[client], DeleteRange{Clock: s.ID().Clock, Length: uint64(s.Len())})
+		}
+	}
+	ds.normalize()
+	e := NewEncoder()
+	e.WriteVarUint(0)
+	ds.write(e)
+	return e.Bytes()
+}
+
+// Rebase encodes a copy of d in which every struct is re-created by client.
+// Structs are renumbered so that each one comes after everything it
+// references, which keeps the copy integrable in a single pass. Structs
+// whose references are missing from d are left out, along with their
+// dependents. Applied to a document whose content was deleted, the copy
+// makes it look exactly like d.
+func (d *Doc) Rebase(client uint64) []byte {
+	r := &rebaser{
+		doc:     d,
+		client:  client,
+		mapped:  make(map[Struct]uint64),
+		dropped: make(map[Struct]bool),
+	}
+	clients := make([]uint64, 0, len(d.structs))
+	for c := range d.structs {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a] < clients[b] })
+	for _, c := range clients {
+		for _, s := range d.structs[c] {
+			r.visit(s)
+		}
+	}
+
+	ds := make(DeleteSet)
+	for c, ranges := range d.deletes {
+		list := d.structs[c]
+		for _, dr := range ranges {
+			end := dr.Clock + dr.Length
+			i := sort.Search(len(list), func(i int) bool { return list[i].ID().Clock+uint64(list[i].Len()) > dr.Clock })
+			for ; i < len(list) && list[i].ID().Clock < end; i++ {
+				s := list[i]
+				newClock, ok := r.mapped[s]
+				if !ok {
+					continue
+				}
+				from := max(dr.Clock, s.ID().Clock)
+				to := min(end, s.ID().Clock+uint64(s.Len()))
+				ds[client] = append(ds[client], DeleteRange{Clock: newClock + from - s.ID().Clock, Length: to - from})
+			}
+		}
+	}
+	ds.normalize()
+
+	e := NewEncoder()
+	writeStructs(e, map[uint64][]Struct{client: r.out}, nil)
+	ds.write(e)
+	return e.Bytes()
+}
+
+type rebaser struct {
+	doc     *Doc
+	client  uint64
+	clock   uint64
+	mapped  map[Struct]uint64
+	dropped map[Struct]bool
+	out     []Struct
+}
+
+func (r *rebaser) find(id ID) Struct {
+	list := r.doc.structs[id.Client]
+	i := sort.Search(len(list), func(i int) bool { return list[i].ID().Clock+uint64(list[i].Len()) > id.Clock })
+	if i == len(list) || list[i].ID().Clock > id.Clock {
+		return nil
+	}
+	return list[i]
+}
+
+// mapID translates id into the rebased clock space, visiting the struct
+// that contains it first.
+func (r *rebaser) mapID(id *ID) (*ID, bool) {
+	if id == nil {
+		return nil, true
+	}
+	s := r.find(*id)
+	if s == nil || !r.visit(s) {
+		return nil, false
+	}
+	return &ID{Client: r.client, Clock: r.mapped[s] + id.Clock - s.ID().Clock}, true
+}
+
+func (r *rebaser) visit(s Struct) bool {
+	if _, ok := r.mapped[s]; ok {
+		return true
+	}
+	if r.dropped[s] {
+		return false
+	}
+	var copied Struct
+	switch v := s.(type) {
+	case *Item:
+		// Mark before recursing; valid updates have no reference cycles,
+		// so this only guards against malformed input.
+		r.dropped[s] = true
+		origin, ok1 := r.mapID(v.Origin)
+		rightOrigin, ok2 := r.mapID(v.RightOrigin)
+		parentID, ok3 := r.mapID(v.ParentID)
+		if !ok1 || !ok2 || !ok3 {
+			return false
+		}
+		delete(r.dropped, s)
+		copied = &Item{
+			id:          ID{Client: r.client, Clock: r.clock},
+			Origin:      origin,
+			RightOrigin: rightOrigin,
+			ParentRoot:  v.ParentRoot,
+			ParentID:    parentID,
+			HasParent:   v.HasParent,
+			ParentSub:   v.ParentSub,
+			Content:     v.Content,
+		}
+	case *GC:
+		copied = &GC{id: ID{Client: r.client, Clock: r.clock}, Length: v.Length}
+	default:
+		return false
+	}
+	r.mapped[s] = r.clock
+	r.clock += uint64(s.Len())
+	r.out = append(r.out, copied)
+	return true
+}
@@ -0,0 +1,141 @@
+package yjs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RelativePosition is a position inside a shared type that stays attached to
+// the surrounding content while the document changes, as produced by
+// Y.encodeRelativePosition. Exactly one of Item, TypeName and TypeID is set:
+// Item for a position next to an item, the others for the end of a root or
+// nested type.
+type RelativePosition struct {
+	Item     *ID
+	TypeName string
+	TypeID   *ID
+	// Assoc is negative when the position sticks to the content before it.
+	Assoc int64
+}
+
+// DecodeRelativePosition parses an encoded relative position.
+func DecodeRelativePosition(data []byte) (RelativePosition, error) {
+	d := NewDecoder(data)
+	var pos RelativePosition
+	kind, err := d.ReadVarUint()
+	if err != nil {
+		return pos, err
+	}
+	switch kind {
+	case 0, 2:
+		client, err := d.ReadVarUint()
+		if err != nil {
+			return pos, err
+		}
+		clock, err := d.ReadVarUint()
+		if err != nil {
+			return pos, err
+		}
+		id := &ID{Client: client, Clock: clock}
+		if kind == 0 {
+			pos.Item = id
+		} else {
+			pos.TypeID = id
+		}
+	case 1:
+		if pos.TypeName, err = d.ReadVarString(); err != nil {
+			return pos, err
+		}
+	default:
+		return pos, fmt.Errorf("yjs: unknown relative position kind %d", kind)
+	}
+	// Positions written before assoc existed end here.
+	if d.HasContent() {
+		if pos.Assoc, err = d.ReadVarInt(); err != nil {
+			return pos, err
+		}
+	}
+	if d.HasContent() {
+		return pos, fmt.Errorf("yjs: trailing bytes after relative position")
+	}
+	return pos, nil
+}
+
+// Encode encodes the position like Y.encodeRelativePosition.
+func (p RelativePosition) Encode() []byte {
+	e := NewEncoder()
+	switch {
+	case p.Item != nil:
+		e.WriteVarUint(0)
+		writeID(e, *p.Item)
+	case p.TypeID != nil:
+		e.WriteVarUint(2)
+		writeID(e, *p.TypeID)
+	default:
+		e.WriteVarUint(1)
+		e.WriteVarString(p.TypeName)
+	}
+	e.WriteVarInt(p.Assoc)
+	return e.Bytes()
+}
+
+// UpdateRange returns positions bounding what update inserts or deletes.
+// Insertions are bounded by the neighbours they were inserted between, so
+// the range resolves in documents that do not contain the update. ok is
+// false when the update touches no sequence content.
+func UpdateRange(update []byte) (start, end RelativePosition, ok bool, err error) {
+	u, err := DecodeUpdate(update)
+	if err != nil {
+		return start, end, false, err
+	}
+	clients := make([]uint64, 0, len(u.Structs))
+	for client := range u.Structs {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i] < clients[j] })
+	var first, last *ID
+	for _, client := range clients {
+		for _, s := range u.Structs[client] {
+			item, isItem := s.(*Item)
+			// Map entries such as formatting attributes have no place in
+			// the sequence.
+			if !isItem || item.ParentSub != nil {
+				continue
+			}
+			if first == nil && item.Origin != nil && !u.covers(item.Origin.Client, item.Origin.Clock, item.Origin.Clock+1) {
+				first = item.Origin
+			}
+			if last == nil && item.RightOrigin != nil && !u.covers(item.RightOrigin.Client, item.RightOrigin.Clock, item.RightOrigin.Clock+1) {
+				last = item.RightOrigin
+			}
+		}
+	}
+	switch {
+	case first != nil && last != nil:
+		return RelativePosition{Item: first, Assoc: -1}, RelativePosition{Item: last}, true, nil
+	case first != nil:
+		pos := RelativePosition{Item: first, Assoc: -1}
+		return pos, pos, true, nil
+	case last != nil:
+		pos := RelativePosition{Item: last}
+		return pos, pos, true, nil
+	}
+
+	// Without insertions, bound the first deleted range.
+	deleted := make([]uint64, 0, len(u.Deletes))
+	for client := range u.Deletes {
+		deleted = append(deleted, client)
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i] < deleted[j] })
+	for _, client := range deleted {
+		ranges := u.Deletes[client]
+		if len(ranges) == 0 {
+			continue
+		}
+		head, tail := ranges[0], ranges[len(ranges)-1]
+		start = RelativePosition{Item: &ID{Client: client, Clock: head.Clock}}
+		end = RelativePosition{Item: &ID{Client: client, Clock: tail.Clock + tail.Length - 1}, Assoc: -1}
+		return start, end, true, nil
+	}
+	return start, end, false, nil
+}
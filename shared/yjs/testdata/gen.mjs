@@ -0,0 +1,42 @@
+// Prints the golden updates used by update_test.go. Run with yjs installed:
+//
+//	npm install yjs && node gen.mjs
+import * as Y from 'yjs'
+
+const hex = (b) => Buffer.from(b).toString('hex')
+
+const newDoc = (clientID) => {
+  const doc = new Y.Doc()
+  doc.clientID = clientID
+  return doc
+}
+
+// text: client 1 inserts "abc" into the Y.Text "text".
+const a = newDoc(1)
+a.getText('text').insert(0, 'abc')
+const text = Y.encodeStateAsUpdate(a)
+console.log('text', hex(text))
+
+// insert: client 2 inserts "X" between "a" and "bc".
+const b = newDoc(2)
+Y.applyUpdate(b, text)
+b.getText('text').insert(1, 'X')
+console.log('insert', hex(Y.encodeStateAsUpdate(b, Y.encodeStateVector(a))))
+console.log('insertState', hex(Y.encodeStateAsUpdate(b)))
+console.log('insertStateVector', hex(Y.encodeStateVector(b)))
+console.log('insertMerged', hex(Y.mergeUpdates([text, Y.encodeStateAsUpdate(b, Y.encodeStateVector(a))])))
+
+// delete: client 1 deletes "b". The first line is the transaction's own
+// update, the second the garbage-collected state.
+let deleteUpdate
+a.once('update', (u) => { deleteUpdate = u })
+a.getText('text').delete(1, 1)
+console.log('delete', hex(deleteUpdate))
+console.log('deleteState', hex(Y.encodeStateAsUpdate(a)))
+
+// paragraph: a y-prosemirror paragraph holding "hi" in the fragment "default".
+const c = newDoc(1)
+const p = new Y.XmlElement('paragraph')
+p.insert(0, [new Y.XmlText('hi')])
+c.getXmlFragment('default').insert(0, [p])
+console.log('paragraph', hex(Y.encodeStateAsUpdate(c)))
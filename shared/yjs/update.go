@@ -0,0 +1,347 @@
+package yjs
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	bitOrigin      = 0x80
+	bitRightOrigin = 0x40
+	bitParentSub   = 0x20
+)
+
+type ID struct {
+	Client uint64
+	Clock  uint64
+}
+
+// Struct is one entry of a client's struct list: an Item, a GC range or a
+// Skip placeholder.
+type Struct interface {
+	ID() ID
+	Len() int
+	write(e *Encoder, offset int)
+	splice(offset int) Struct
+}
+
+// Item is a decoded Yjs item. Parent is set either to ParentRoot (a root type
+// name) or ParentID (the item holding the parent type); both are empty when
+// the parent is implied by Origin or RightOrigin.
+type Item struct {
+	id          ID
+	Origin      *ID
+	RightOrigin *ID
+	ParentRoot  string
+	ParentID    *ID
+	HasParent   bool
+	ParentSub   *string
+	Content     Content
+}
+
+type GC struct {
+	id     ID
+	Length int
+}
+
+type Skip struct {
+	id     ID
+	Length int
+}
+
+func (i *Item) ID() ID   { return i.id }
+func (i *Item) Len() int { return i.Content.Len() }
+
+func (i *Item) write(e *Encoder, offset int) {
+	origin := i.Origin
+	if offset > 0 {
+		origin = &ID{Client: i.id.Client, Clock: i.id.Clock + uint64(offset) - 1}
+	}
+	info := i.Content.ref() & 0x1f
+	if origin != nil {
+		info |= bitOrigin
+	}
+	if i.RightOrigin != nil {
+		info |= bitRightOrigin
+	}
+	if i.ParentSub != nil {
+		info |= bitParentSub
+	}
+	e.WriteUint8(info)
+	if origin != nil {
+		writeID(e, *origin)
+	}
+	if i.RightOrigin != nil {
+		writeID(e, *i.RightOrigin)
+	}
+	if origin == nil && i.RightOrigin == nil {
+		if i.ParentID != nil {
+			e.WriteVarUint(0)
+			writeID(e, *i.ParentID)
+		} else {
+			e.WriteVarUint(1)
+			e.WriteVarString(i.ParentRoot)
+		}
+		if i.ParentSub != nil {
+			e.WriteVarString(*i.ParentSub)
+		}
+	}
+	i.Content.write(e, offset)
+}
+
+func (i *Item) splice(offset int) Struct {
+	right := &Item{
+		id:          ID{Client: i.id.Client, Clock: i.id.Clock + uint64(offset)},
+		Origin:      &ID{Client: i.id.Client, Clock: i.id.Clock + uint64(offset) - 1},
+		RightOrigin: i.RightOrigin,
+		ParentRoot:  i.ParentRoot,
+		ParentID:    i.ParentID,
+		HasParent:   i.HasParent,
+		ParentSub:   i.ParentSub,
+	}
+	right.Content = i.Content.splice(offset)
+	return right
+}
+
+func (g *GC) ID() ID   { return g.id }
+func (g *GC) Len() int { return g.Length }
+func (g *GC) write(e *Encoder, offset int) {
+	e.WriteUint8(refGC)
+	e.WriteVarUint(uint64(g.Length - offset))
+}
+func (g *GC) splice(offset int) Struct {
+	right := &GC{id: ID{Client: g.id.Client, Clock: g.id.Clock + uint64(offset)}, Length: g.Length - offset}
+	g.Length = offset
+	return right
+}
+
+func (s *Skip) ID() ID   { return s.id }
+func (s *Skip) Len() int { return s.Length }
+func (s *Skip) write(e *Encoder, offset int) {
+	e.WriteUint8(refSkip)
+	e.WriteVarUint(uint64(s.Length - offset))
+}
+func (s *Skip) splice(offset int) Struct {
+	right := &Skip{id: ID{Client: s.id.Client, Clock: s.id.Clock + uint64(offset)}, Length: s.Length - offset}
+	s.Length = offset
+	return right
+}
+
+func writeID(e *Encoder, id ID) {
+	e.WriteVarUint(id.Client)
+	e.WriteVarUint(id.Clock)
+}
+
+func readID(d *Decoder) (ID, error) {
+	client, err := d.ReadVarUint()
+	if err != nil {
+		return ID{}, err
+	}
+	clock, err := d.ReadVarUint()
+	if err != nil {
+		return ID{}, err
+	}
+	return ID{Client: client, Clock: clock}, nil
+}
+
+// Update is a decoded v1 update: structs grouped by client in clock order,
+// plus the delete set.
+type Update struct {
+	Structs map[uint64][]Struct
+	Deletes DeleteSet
+}
+
+// DecodeUpdate parses a Yjs v1 update.
+func DecodeUpdate(data []byte) (*Update, error) {
+	d := NewDecoder(data)
+	u := &Update{Structs: make(map[uint64][]Struct)}
+	numClients, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < numClients; i++ {
+		numStructs, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		client, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		clock, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		structs := u.Structs[client]
+		for j := 0; j < numStructs; j++ {
+			s, err := readStruct(d, ID{Client: client, Clock: clock})
+			if err != nil {
+				return nil, err
+			}
+			if clock += uint64(s.Len()); clock > maxClock {
+				return nil, errClockOverflow
+			}
+			if _, skip := s.(*Skip); skip {
+				continue
+			}
+			if s.Len() == 0 {
+				continue
+			}
+			structs = append(structs, s)
+		}
+		u.Structs[client] = structs
+	}
+	if u.Deletes, err = readDeleteSet(d); err != nil {
+		return nil, err
+	}
+	for client, structs := range u.Structs {
+		sort.Slice(structs, func(a, b int) bool { return structs[a].ID().Clock < structs[b].ID().Clock })
+		u.Structs[client] = structs
+	}
+	return u, nil
+}
+
+func readStruct(d *Decoder, id ID) (Struct, error) {
+	info, err := d.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+	switch info & 0x1f {
+	case refGC:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		return &GC{id: id, Length: int(n)}, nil
+	case refSkip:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		return &Skip{id: id, Length: int(n)}, nil
+	}
+	item := &Item{id: id}
+	if info&bitOrigin != 0 {
+		origin, err := readID(d)
+		if err != nil {
+			return nil, err
+		}
+		item.Origin = &origin
+	}
+	if info&bitRightOrigin != 0 {
+		rightOrigin, err := readID(d)
+		if err != nil {
+			return nil, err
+		}
+		item.RightOrigin = &rightOrigin
+	}
+	if info&(bitOrigin|bitRightOrigin) == 0 {
+		item.HasParent = true
+		isRoot, err := d.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if isRoot == 1 {
+			if item.ParentRoot, err = d.ReadVarString(); err != nil {
+				return nil, err
+			}
+		} else {
+			parentID, err := readID(d)
+			if err != nil {
+				return nil, err
+			}
+			item.ParentID = &parentID
+		}
+		if info&bitParentSub != 0 {
+			sub, err := d.ReadVarString()
+			if err != nil {
+				return nil, err
+			}
+			item.ParentSub = &sub
+		}
+	}
+	if item.Content, err = readContent(d, info); err != nil {
+		return nil, fmt.Errorf("item %d:%d: %w", id.Client, id.Clock, err)
+	}
+	return item, nil
+}
+
+// writeStructs encodes per-client struct lists, starting each client at
+// the clock given by sv and filling clock gaps with Skip structs.
+func writeStructs(e *Encoder, structs map[uint64][]Struct, sv StateVector) {
+	clients := make([]uint64, 0, len(structs))
+	for client, list := range structs {
+		if len(list) == 0 {
+			continue
+		}
+		last := list[len(list)-1]
+		if last.ID().Clock+uint64(last.Len()) <= sv[client] {
+			continue
+		}
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a] > clients[b] })
+
+	e.WriteVarUint(uint64(len(clients)))
+	for _, client := range clients {
+		list := structs[client]
+		start := sv[client]
+		first := sort.Search(len(list), func(i int) bool {
+			return list[i].ID().Clock+uint64(list[i].Len()) > start
+		})
+		list = list[first:]
+		clock := list[0].ID().Clock
+		offset := 0
+		if start > clock {
+			offset = int(start - clock)
+			clock = start
+		}
+
+		type entry struct {
+			s      Struct
+			offset int
+		}
+		entries := make([]entry, 0, len(list))
+		next := clock
+		for i, s := range list {
+			o := 0
+			if i == 0 {
+				o = offset
+			}
+			if s.ID().Clock > next {
+				entries = append(entries, entry{s: &Skip{id: ID{Client: client, Clock: next}, Length: int(s.ID().Clock - next)}})
+			}
+			entries = append(entries, entry{s: s, offset: o})
+			next = s.ID().Clock + uint64(s.Len())
+		}
+
+		e.WriteVarUint(uint64(len(entries)))
+		e.WriteVarUint(client)
+		e.WriteVarUint(clock)
+		for _, en := range entries {
+			en.s.write(e, en.offset)
+		}
+	}
+}
+
+// covers reports whether the update holds items or GC ranges for every
+// clock of client in [from, to).
+func (u *Update) covers(client, from, to uint64) bool {
+	for _, s := range u.Structs[client] {
+		if from >= to {
+			break
+		}
+		if _, skip := s.(*Skip); skip {
+			continue
+		}
+		start := s.ID().Clock
+		end := start + uint64(s.Len())
+		if start > from {
+			return false
+		}
+		if end > from {
+			from = end
+		}
+	}
+	return from >= to
+}
@@ -0,0 +1,158 @@
+package yjs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Golden updates as yjs writes them; testdata/gen.mjs prints the same
+// values from a real Y.Doc, one per line under the same names.
+const (
+	// Client 1 inserts "abc" into the Y.Text "text".
+	goldenText = "01 01 01 00  04 01 04 74657874 03 616263  00"
+	// Client 2 inserts "X" between "a" and "bc", encoded against the state
+	// vector of client 1.
+	goldenInsert            = "01 01 02 00  c4 0100 0101 01 58  00"
+	goldenInsertState       = "02 01 02 00  c4 0100 0101 01 58  02 01 00  04 01 04 74657874 01 61  84 0100 02 6263  00"
+	goldenInsertStateVector = "02 02 01 01 03"
+	goldenInsertMerged      = "02 01 02 00  c4 0100 0101 01 58  01 01 00  04 01 04 74657874 03 616263  00"
+	// Client 1 deletes "b": the transaction's update, then the
+	// garbage-collected state.
+	goldenDelete      = "00  01 01 01 01 01"
+	goldenDeleteState = "01 03 01 00  04 01 04 74657874 01 61  81 0100 01  84 0101 01 63  01 01 01 01 01"
+	// A y-prosemirror paragraph holding "hi" in the XmlFragment "default".
+	goldenParagraph = "01 03 01 00  07 01 07 64656661756c74 03 09 706172616772617068  07 00 0100 06  04 00 0101 02 6869  00"
+)
+
+func golden(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad fixture %q: %v", s, err)
+	}
+	return b
+}
+
+func docOf(t *testing.T, updates ...string) *Doc {
+	t.Helper()
+	doc := NewDoc()
+	for _, u := range updates {
+		if err := doc.ApplyUpdate(golden(t, u)); err != nil {
+			t.Fatalf("apply %s: %v", u, err)
+		}
+	}
+	return doc
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, fixture := range []string{goldenText, goldenInsertState, goldenDeleteState, goldenParagraph} {
+		got := docOf(t, fixture).EncodeStateAsUpdate(nil)
+		if want := golden(t, fixture); !bytes.Equal(got, want) {
+			t.Errorf("round trip of %s\n got %x\nwant %x", fixture, got, want)
+		}
+	}
+}
+
+func TestMergeUpdates(t *testing.T) {
+	got, err := MergeUpdates(golden(t, goldenText), golden(t, goldenInsert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := golden(t, goldenInsertMerged); !bytes.Equal(got, want) {
+		t.Errorf("merged\n got %x\nwant %x", got, want)
+	}
+
+	// Merging is idempotent and does not depend on order.
+	again, err := MergeUpdates(golden(t, goldenInsert), got, golden(t, goldenText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, got) {
+		t.Errorf("remerged\n got %x\nwant %x", again, got)
+	}
+}
+
+func TestEncodeStateAsUpdateDiff(t *testing.T) {
+	doc := docOf(t, goldenInsertState)
+
+	sv := doc.StateVector()
+	if want := (StateVector{1: 3, 2: 1}); !reflect.DeepEqual(sv, want) {
+		t.Fatalf("state vector = %v, want %v", sv, want)
+	}
+	if got, want := sv.Encode(), golden(t, goldenInsertStateVector); !bytes.Equal(got, want) {
+		t.Errorf("encoded state vector\n got %x\nwant %x", got, want)
+	}
+	decoded, err := DecodeStateVector(golden(t, goldenInsertStateVector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sv) {
+		t.Errorf("decoded state vector = %v, want %v", decoded, sv)
+	}
+
+	if got, want := doc.EncodeStateAsUpdate(StateVector{1: 3}), golden(t, goldenInsert); !bytes.Equal(got, want) {
+		t.Errorf("diff against {1: 3}\n got %x\nwant %x", got, want)
+	}
+	if got := doc.EncodeStateAsUpdate(sv); !bytes.Equal(got, []byte{0, 0}) {
+		t.Errorf("diff against own state = %x, want empty update", got)
+	}
+
+	// A diff from the middle of a merged item starts at the requested
+	// clock with the preceding clock as origin.
+	merged := docOf(t, goldenInsertMerged)
+	want := golden(t, "02 01 02 00  c4 0100 0101 01 58  01 01 01  84 0100 02 6263  00")
+	if got := merged.EncodeStateAsUpdate(StateVector{1: 1}); !bytes.Equal(got, want) {
+		t.Errorf("diff against {1: 1}\n got %x\nwant %x", got, want)
+	}
+}
+
+func TestDeleteSet(t *testing.T) {
+	want := DeleteSet{1: {{Clock: 1, Length: 1}}}
+
+	doc := docOf(t, goldenText, goldenDelete)
+	if got := doc.DeleteSet(); !reflect.DeepEqual(got, want) {
+		t.Errorf("delete set = %v, want %v", got, want)
+	}
+	if !doc.DeleteSet().Contains(ID{Client: 1, Clock: 1}) || doc.DeleteSet().Contains(ID{Client: 1, Clock: 2}) {
+		t.Error("Contains disagrees with the delete set")
+	}
+	merged, err := MergeUpdates(golden(t, goldenText), golden(t, goldenDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := golden(t, "01 01 01 00  04 01 04 74657874 03 616263  01 01 01 01 01"); !bytes.Equal(merged, want) {
+		t.Errorf("merged delete\n got %x\nwant %x", merged, want)
+	}
+
+	gc := docOf(t, goldenDeleteState)
+	if got := gc.DeleteSet(); !reflect.DeepEqual(got, want) {
+		t.Errorf("gc delete set = %v, want %v", got, want)
+	}
+	if !gc.Covers(doc) || !doc.Covers(gc) {
+		t.Error("garbage-collected and live states should cover each other")
+	}
+
+	// Overlapping and adjacent ranges are normalized.
+	ds := DeleteSet{1: {{Clock: 4, Length: 2}, {Clock: 0, Length: 2}}}
+	ds.Merge(DeleteSet{1: {{Clock: 1, Length: 3}}, 2: {{Clock: 0, Length: 0}}})
+	if want := (DeleteSet{1: {{Clock: 0, Length: 6}}}); !reflect.DeepEqual(ds, want) {
+		t.Errorf("normalized delete set = %v, want %v", ds, want)
+	}
+}
+
+func TestXmlFragment(t *testing.T) {
+	paragraph := []*XmlNode{{
+		Name:     "paragraph",
+		Attrs:    map[string]any{},
+		Children: []*XmlNode{{Runs: []TextRun{{Text: "hi", Format: map[string]any{}}}}},
+	}}
+	if got, want := EncodeXmlFragment("default", 1, paragraph), golden(t, goldenParagraph); !bytes.Equal(got, want) {
+		t.Errorf("encoded paragraph\n got %x\nwant %x", got, want)
+	}
+	if got := docOf(t, goldenParagraph).XmlFragment("default"); !reflect.DeepEqual(got, paragraph) {
+		t.Errorf("decoded paragraph = %#v", got)
+	}
+}
@@ -0,0 +1,242 @@
+package yjs
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"unicode/utf16"
+)
+
+// XmlNode is a node of an XmlFragment. Elements have a Name, attributes and
+// children; text nodes have no Name and hold formatted runs instead.
+type XmlNode struct {
+	Name     string
+	Attrs    map[string]any
+	Children []*XmlNode
+	Runs     []TextRun
+}
+
+// TextRun is a span of text with the same formatting attributes. Format
+// values are decoded JSON.
+type TextRun struct {
+	Text   string
+	Format map[string]any
+}
+
+// IsText reports whether n is a text node.
+func (n *XmlNode) IsText() bool {
+	return n.Name == ""
+}
+
+// XmlFragment integrates the document and returns the visible children of
+// the root XmlFragment called name.
+func (d *Doc) XmlFragment(name string) []*XmlNode {
+	it := d.integrate()
+	root := it.roots[name]
+	if root == nil {
+		return nil
+	}
+	return it.children(root)
+}
+
+func (it *integrator) children(t *ytype) []*XmlNode {
+	var nodes []*XmlNode
+	for u := t.start; u != nil; u = u.right {
+		if u.deleted {
+			continue
+		}
+		content, ok := u.content.(*ContentType)
+		if !ok {
+			continue
+		}
+		child := it.types[u]
+		if child == nil {
+			child = &ytype{item: u, content: content, entries: make(map[string]*unit)}
+		}
+		switch content.TypeRef {
+		case TypeXmlElement:
+			nodes = append(nodes, &XmlNode{
+				Name:     content.NodeName,
+				Attrs:    attributes(child),
+				Children: it.children(child),
+			})
+		case TypeXmlText, TypeText:
+			nodes = append(nodes, &XmlNode{Runs: textRuns(child)})
+		}
+	}
+	return nodes
+}
+
+func attributes(t *ytype) map[string]any {
+	attrs := make(map[string]any, len(t.entries))
+	for key, u := range t.entries {
+		if u.deleted {
+			continue
+		}
+		if content, ok := u.content.(*ContentAny); ok && len(content.Values) > 0 {
+			attrs[key] = content.Values[0]
+		}
+	}
+	return attrs
+}
+
+func textRuns(t *ytype) []TextRun {
+	var runs []TextRun
+	var text []uint16
+	format := map[string]any{}
+	flush := func() {
+		if len(text) == 0 {
+			return
+		}
+		s := string(utf16.Decode(text))
+		text = text[:0]
+		if n := len(runs); n > 0 && reflect.DeepEqual(runs[n-1].Format, format) {
+			runs[n-1].Text += s
+			return
+		}
+		runs = append(runs, TextRun{Text: s, Format: copyFormat(format)})
+	}
+	for u := t.start; u != nil; u = u.right {
+		if u.deleted {
+			continue
+		}
+		switch content := u.content.(type) {
+		case *ContentString:
+			text = append(text, content.units...)
+		case *ContentFormat:
+			flush()
+			var value any
+			if err := json.Unmarshal([]byte(content.Value), &value); err != nil || value == nil {
+				delete(format, content.Key)
+			} else {
+				format[content.Key] = value
+			}
+		}
+	}
+	flush()
+	return runs
+}
+
+func copyFormat(format map[string]any) map[string]any {
+	c := make(map[string]any, len(format))
+	for k, v := range format {
+		c[k] = v
+	}
+	return c
+}
+
+// EncodeXmlFragment encodes an update that fills the root XmlFragment
+// called name with nodes, laid out the way y-prosemirror writes them. All
+// items are created by client, which should be fresh.
+func EncodeXmlFragment(name string, client uint64, nodes []*XmlNode) []byte {
+	x := &xmlEncoder{client: client}
+	x.sequence(&Item{HasParent: true, ParentRoot: name}, nodes)
+	e := NewEncoder()
+	writeStructs(e, map[uint64][]Struct{client: x.items}, nil)
+	DeleteSet{}.write(e)
+	return e.Bytes()
+}
+
+type xmlEncoder struct {
+	client uint64
+	clock  uint64
+	items  []Struct
+}
+
+// add appends an item after prev, or as the first child described by
+// parent when prev is nil, and returns the ID of its last clock.
+func (x *xmlEncoder) add(parent *Item, prev *ID, content Content) ID {
+	item := &Item{id: ID{Client: x.client, Clock: x.clock}, Content: content}
+	if prev != nil {
+		item.Origin = prev
+	} else {
+		item.HasParent = true
+		item.ParentRoot = parent.ParentRoot
+		item.ParentID = parent.ParentID
+	}
+	x.items = append(x.items, item)
+	x.clock += uint64(content.Len())
+	return ID{Client: x.client, Clock: x.clock - 1}
+}
+
+func (x *xmlEncoder) sequence(parent *Item, nodes []*XmlNode) {
+	var prev *ID
+	for _, n := range nodes {
+		if n.IsText() {
+			id := x.add(parent, prev, &ContentType{TypeRef: TypeXmlText})
+			prev = &id
+			x.text(&Item{ParentID: &id}, n.Runs)
+			continue
+		}
+		id := x.add(parent, prev, &ContentType{TypeRef: TypeXmlElement, NodeName: n.Name})
+		prev = &id
+		keys := make([]string, 0, len(n.Attrs))
+		for key := range n.Attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			x.items = append(x.items, &Item{
+				id:        ID{Client: x.client, Clock: x.clock},
+				HasParent: true,
+				ParentID:  &id,
+				ParentSub: &key,
+				Content:   &ContentAny{Values: []any{n.Attrs[key]}},
+			})
+			x.clock++
+		}
+		x.sequence(&Item{ParentID: &id}, n.Children)
+	}
+}
+
+// text inserts runs like Y.Text.insert with attributes: format items open
+// each change of formatting and the last ones are closed with null.
+func (x *xmlEncoder) text(parent *Item, runs []TextRun) {
+	var prev *ID
+	insert := func(content Content) {
+		id := x.add(parent, prev, content)
+		prev = &id
+	}
+	current := map[string]any{}
+	setFormat := func(key string, value any, ok bool) {
+		old, had := current[key]
+		if had == ok && reflect.DeepEqual(old, value) {
+			return
+		}
+		raw := []byte("null")
+		if ok {
+			current[key] = value
+			raw, _ = json.Marshal(value)
+		} else {
+			delete(current, key)
+		}
+		insert(&ContentFormat{Key: key, Value: string(raw)})
+	}
+	for _, run := range runs {
+		if run.Text == "" {
+			continue
+		}
+		for _, key := range sortedKeys(current, run.Format) {
+			value, ok := run.Format[key]
+			setFormat(key, value, ok)
+		}
+		insert(NewContentString(run.Text))
+	}
+	for _, key := range sortedKeys(current, nil) {
+		setFormat(key, nil, false)
+	}
+}
+
+func sortedKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}